@@ -0,0 +1,52 @@
+package main
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/txn"
+	"time"
+)
+
+// EngineOption configures a KeyValueDB created with NewKeyValueDB, and its storage engine.
+type EngineOption func(options *engineOptions)
+
+type engineOptions struct {
+	engine            mvcc.StorageEngine
+	versionGCInterval time.Duration
+	isolationLevel    txn.IsolationLevel
+	memoryLimit       int64
+}
+
+func defaultEngineOptions() engineOptions {
+	return engineOptions{versionGCInterval: DefaultVersionGCInterval, isolationLevel: txn.Serializable}
+}
+
+// WithStorageEngine makes the database keep its versions in the given engine instead of an in-memory lsm.Tree.
+// The database closes the engine when it stops. The version GC and the memory limit are features of lsm.Tree,
+// a database on another engine runs without them.
+func WithStorageEngine(engine mvcc.StorageEngine) EngineOption {
+	return func(options *engineOptions) {
+		options.engine = engine
+	}
+}
+
+// WithVersionGCInterval sets the interval of the version GC, DefaultVersionGCInterval by default; 0 disables it.
+func WithVersionGCInterval(interval time.Duration) EngineOption {
+	return func(options *engineOptions) {
+		options.versionGCInterval = interval
+	}
+}
+
+// WithIsolationLevel sets the isolation level of the transactions, txn.Serializable by default.
+func WithIsolationLevel(isolationLevel txn.IsolationLevel) EngineOption {
+	return func(options *engineOptions) {
+		options.isolationLevel = isolationLevel
+	}
+}
+
+// WithMemoryLimit caps the bytes held by the memtable, 0 (the default) leaves it uncapped. Nothing is flushed out of
+// an in-memory database: once it is full, the commits fail with errors.MemTableFullErr till the version GC removes enough shadowed versions.
+func WithMemoryLimit(bytes int64) EngineOption {
+	return func(options *engineOptions) {
+		options.memoryLimit = bytes
+	}
+}
@@ -1,49 +1,368 @@
 package main
 
 import (
+	"IsoTransact/lsm"
 	"IsoTransact/mvcc"
 	"IsoTransact/txn"
+	txnErrors "IsoTransact/txn/errors"
+	"IsoTransact/wal"
+	"context"
 	"errors"
+	"os"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var DbAlreadyStoppedErr = errors.New("Db is stopped, can not perform the operation")
 
 type KeyValueDB struct {
-	stopped atomic.Bool
-	oracle  *txn.Oracle
+	stopped   atomic.Bool
+	beginLock sync.RWMutex //transactions begin under the read lock, Close stops the database under the write lock
+	oracle    *txn.Oracle
+	tree      *lsm.Tree //nil if the database runs on an engine other than lsm.Tree
 }
 
-func NewKeyValueDB(skipListMaxLevel uint8) *KeyValueDB {
-	return &KeyValueDB{
-		oracle: txn.NewOracle(txn.NewTransactionExecutor(mvcc.NewMemTable(skipListMaxLevel))),
+// NewKeyValueDB creates an in-memory KeyValueDB, on an in-memory lsm.Tree unless an engine is given with WithStorageEngine.
+// The transactions are Serializable unless another isolation level is given with WithIsolationLevel.
+func NewKeyValueDB(skipListMaxLevel uint8, options ...EngineOption) *KeyValueDB {
+	engineOptions := defaultEngineOptions()
+	for _, option := range options {
+		option(&engineOptions)
 	}
+	engine := engineOptions.engine
+	if engine == nil {
+		engine = lsm.NewInMemoryTree(mvcc.NewMemTable(skipListMaxLevel))
+	}
+
+	oracle := txn.NewOracleWithIsolationLevel(txn.NewDurableTransactionExecutor(engine, nil), engineOptions.isolationLevel)
+	tree, ok := engine.(*lsm.Tree)
+	if !ok {
+		return &KeyValueDB{oracle: oracle}
+	}
+	tree.SetDiscardWatermark(oracle.ClaimDiscardWatermark)
+	tree.SetMemoryLimit(engineOptions.memoryLimit)
+	if engineOptions.versionGCInterval > 0 {
+		tree.StartVersionGC(engineOptions.versionGCInterval)
+	}
+	return &KeyValueDB{oracle: oracle, tree: tree}
 }
 
-func (db *KeyValueDB) Get(callback func(transaction *txn.ReadOnlyTransaction)) error {
-	if db.stopped.Load() {
-		return DbAlreadyStoppedErr
+// OpenKeyValueDB opens a durable KeyValueDB in options.Directory.
+// The tables recorded in the manifest are opened, the batches in the write-ahead log that are not yet flushed
+// to the tables are replayed into the memtable, and the oracle resumes handing out commit timestamps after the last one.
+func OpenKeyValueDB(options Options) (*KeyValueDB, error) {
+	if err := os.MkdirAll(options.Directory, 0755); err != nil {
+		return nil, err
 	}
-	transaction := txn.NewReadOnlyTransaction(db.oracle)
+	tree, err := lsm.Open(lsm.Options{
+		Directory:        options.Directory,
+		SkipListMaxLevel: options.SkipListMaxLevel,
+		MemTableSize:     options.MemTableSize,
+		BlockSize:        options.BlockSize,
+		Compaction:       options.Compaction,
+		MemoryLimit:      options.MemoryLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	flushedTill := tree.FlushedTill()
+	lastCommitTimestamp := flushedTill
+
+	log, err := wal.Open(options.Directory, options.Durability, func(record *wal.Record) {
+		if record.GetTimestamp() <= flushedTill {
+			return
+		}
+		for _, entry := range record.GetEntries() {
+			tree.PutOrUpdate(*mvcc.NewVersionedKey(entry.GetKey(), record.GetTimestamp()), entry.GetValue())
+		}
+		if record.GetTimestamp() > lastCommitTimestamp {
+			lastCommitTimestamp = record.GetTimestamp()
+		}
+	})
+	if err != nil {
+		tree.Close()
+		return nil, err
+	}
+	tree.OnFlush(func(flushedTill uint64) {
+		_ = log.RemoveSegmentsTill(flushedTill)
+	})
+	oracle := txn.NewRecoveredOracle(txn.NewDurableTransactionExecutor(tree, log), lastCommitTimestamp, tree.DiscardedTill(), options.IsolationLevel)
+	oracle.SetBatchLimits(options.MaxBatchPairs, options.MaxBatchBytes)
+	oracle.SetLockWaitTimeout(options.LockWaitTimeout)
+	tree.SetDiscardWatermark(oracle.ClaimDiscardWatermark)
+	//the version GC starts only once the discard watermark comes from the oracle
+	if options.VersionGCInterval > 0 {
+		tree.StartVersionGC(options.VersionGCInterval)
+	}
+	return &KeyValueDB{oracle: oracle, tree: tree}, nil
+}
+
+// Get runs the callback in a ReadOnlyTransaction and returns the error returned by the callback,
+// or else the error of a read that failed (see txn.ReadOnlyTransaction.Err).
+func (db *KeyValueDB) Get(callback func(transaction *txn.ReadOnlyTransaction) error) error {
+	transaction, err := db.beginReadOnly(context.Background())
+	if err != nil {
+		return err
+	}
+	//deferred, so that a panicking callback does not hold back the beginTimestampMark forever
 	defer transaction.FinishBeginTimestampForReadonlyTransaction()
 
-	callback(transaction)
-	return nil
+	if err := callback(transaction); err != nil {
+		return err
+	}
+	return transaction.Err()
 }
 
-func (db *KeyValueDB) PutOrUpdate(callback func(transaction *txn.ReadWriteTransaction)) (<-chan struct{}, error) {
-	if db.stopped.Load() {
-		return nil, DbAlreadyStoppedErr
+// ViewAt runs the callback in a ReadOnlyTransaction that reads at a past commit timestamp, and returns the error returned by the callback,
+// or else the error of a read that failed.
+// The versions at the timestamp are kept till the callback returns. It returns errors.DiscardedTimestampErr once the version GC
+// (or a compaction) may have discarded the versions at the timestamp, and errors.UncommittedTimestampErr for a timestamp
+// beyond CommittedTimestamp. The context bounds the wait for the commits till the timestamp to be applied.
+func (db *KeyValueDB) ViewAt(ctx context.Context, timestamp uint64, callback func(transaction *txn.ReadOnlyTransaction) error) error {
+	transaction, err := begin(db, func() (*txn.ReadOnlyTransaction, error) {
+		return txn.NewReadOnlyTransactionAt(ctx, db.oracle, timestamp)
+	})
+	if err != nil {
+		return err
+	}
+	defer transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	if err := callback(transaction); err != nil {
+		return err
 	}
-	transaction := txn.NewReadWriteTransaction(db.oracle)
+	return transaction.Err()
+}
+
+// CommittedTimestamp returns the timestamp of the last commit, waiting till it is applied. Several ViewAt calls at this timestamp
+// read the same snapshot, as long as the version GC does not pass it in between.
+func (db *KeyValueDB) CommittedTimestamp() uint64 {
+	return db.oracle.CommittedTimestamp()
+}
+
+// CommittedTimestampWithContext is CommittedTimestamp bounded by the context, it returns ctx.Err() if the context is done
+// before the last commit is applied.
+func (db *KeyValueDB) CommittedTimestampWithContext(ctx context.Context) (uint64, error) {
+	timestamp, err := db.oracle.CommittedTimestampWithContext(ctx)
+	return timestamp, beginErr(err)
+}
+
+// PutOrUpdate runs the callback in a ReadWriteTransaction and commits it.
+// If the callback returns an error, or discards the transaction, the batch is dropped without a commit timestamp
+// and the error (or errors.DiscardedTxnErr) is returned.
+// The returned channel fires once the batch is written to the write-ahead log and applied to the memtable;
+// whether it is also fsynced by then depends on Options.Durability and ReadWriteTransaction.RequireSync.
+// For a database created with NewKeyValueDB, it only means that the batch is applied.
+func (db *KeyValueDB) PutOrUpdate(callback func(transaction *txn.ReadWriteTransaction) error) (<-chan error, error) {
+	return db.PutOrUpdateWithContext(context.Background(), callback)
+}
+
+// PutOrUpdateWithContext is PutOrUpdate bounded by the context: it returns ctx.Err() if the context is done before the commits
+// till the begin timestamp are applied, or before the batch is queued for the executor (see txn.ReadWriteTransaction.Commit).
+func (db *KeyValueDB) PutOrUpdateWithContext(ctx context.Context, callback func(transaction *txn.ReadWriteTransaction) error) (<-chan error, error) {
+	transaction, err := db.beginReadWrite(ctx)
+	if err != nil {
+		return nil, err
+	}
+	//deferred, so that a panicking callback does not hold back the beginTimestampMark forever
 	defer transaction.FinishBeginTimestampForReadWriteTransaction()
 
-	callback(transaction)
-	return transaction.Commit()
+	if err := callback(transaction); err != nil {
+		transaction.Discard()
+		return nil, err
+	}
+	return transaction.Commit(ctx)
+}
+
+// Update runs the callback in a ReadWriteTransaction and commits it, waiting until the batch is applied.
+// If the commit fails with errors.ConflictErr, or a key lock fails with errors.DeadlockErr, the callback is run again in a fresh transaction after a backoff,
+// up to the maximum attempts (see UpdateOption). An error returned by the callback is returned as is, without committing
+// and without a retry. A callback that writes nothing commits nothing and succeeds.
+// Update returns the number of attempts made along with the error, which is ctx.Err() if the context is done before a successful commit;
+// the context bounds the wait for the begin timestamp, for a place in the executor's queue, and for the apply.
+func (db *KeyValueDB) Update(ctx context.Context, callback func(transaction *txn.ReadWriteTransaction) error, options ...UpdateOption) (int, error) {
+	updateOptions := defaultUpdateOptions()
+	for _, option := range options {
+		option(&updateOptions)
+	}
+
+	attempts := 0
+	for {
+		if db.stopped.Load() {
+			return attempts, DbAlreadyStoppedErr
+		}
+		if err := ctx.Err(); err != nil {
+			return attempts, err
+		}
+		attempts++
+		err := db.tryUpdate(ctx, callback)
+		if !retryable(err) || attempts >= updateOptions.maxAttempts {
+			return attempts, err
+		}
+
+		timer := time.NewTimer(updateOptions.backoffBefore(attempts))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// CompareAndSwap writes the value if the key holds the expected value, a nil expected value expecting the key not to exist,
+// and returns true if it wrote. See txn.ReadWriteTransaction.CompareAndSwap.
+func (db *KeyValueDB) CompareAndSwap(ctx context.Context, key, expected, value []byte) (bool, error) {
+	result, err := db.executeOperation(ctx, func(transaction *txn.ReadWriteTransaction) (*txn.Operation, error) {
+		return transaction.CompareAndSwap(key, expected, value)
+	})
+	return result.Applied, err
+}
+
+// Increment adds the delta to the int64 held by the key, and returns the incremented value. See txn.ReadWriteTransaction.Increment.
+func (db *KeyValueDB) Increment(ctx context.Context, key []byte, delta int64) (int64, error) {
+	result, err := db.executeOperation(ctx, func(transaction *txn.ReadWriteTransaction) (*txn.Operation, error) {
+		return transaction.Increment(key, delta)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return txn.DecodeInt64(result.Value)
+}
+
+// PutIfAbsent writes the value if the key does not exist, and returns true if it wrote. See txn.ReadWriteTransaction.PutIfAbsent.
+func (db *KeyValueDB) PutIfAbsent(ctx context.Context, key, value []byte) (bool, error) {
+	result, err := db.executeOperation(ctx, func(transaction *txn.ReadWriteTransaction) (*txn.Operation, error) {
+		return transaction.PutIfAbsent(key, value)
+	})
+	return result.Applied, err
+}
+
+// executeOperation commits a transaction with the single operation, and returns its result once the commit is applied.
+func (db *KeyValueDB) executeOperation(ctx context.Context, operate func(transaction *txn.ReadWriteTransaction) (*txn.Operation, error)) (txn.OperationResult, error) {
+	var operation *txn.Operation
+	_, err := db.Update(ctx, func(transaction *txn.ReadWriteTransaction) error {
+		var err error
+		operation, err = operate(transaction)
+		return err
+	})
+	if err != nil {
+		return txn.OperationResult{}, err
+	}
+	return operation.Result(ctx)
+}
+
+// retryable returns true for the errors of a transaction that may succeed in a fresh transaction.
+func retryable(err error) bool {
+	return errors.Is(err, txnErrors.ConflictErr) || errors.Is(err, txnErrors.DeadlockErr)
+}
+
+func (db *KeyValueDB) tryUpdate(ctx context.Context, callback func(transaction *txn.ReadWriteTransaction) error) error {
+	transaction, err := db.beginReadWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer transaction.FinishBeginTimestampForReadWriteTransaction()
+
+	if err := callback(transaction); err != nil {
+		transaction.Discard()
+		return err
+	}
+	doneChannel, err := transaction.Commit(ctx)
+	if errors.Is(err, txnErrors.EmptyTxnError) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return waitForApply(ctx, doneChannel)
+}
+
+func (db *KeyValueDB) beginReadWrite(ctx context.Context) (*txn.ReadWriteTransaction, error) {
+	return begin(db, func() (*txn.ReadWriteTransaction, error) {
+		return txn.NewReadWriteTransactionWithContext(ctx, db.oracle)
+	})
+}
+
+func (db *KeyValueDB) beginReadOnly(ctx context.Context) (*txn.ReadOnlyTransaction, error) {
+	return begin(db, func() (*txn.ReadOnlyTransaction, error) {
+		return txn.NewReadOnlyTransactionWithContext(ctx, db.oracle)
+	})
+}
+
+// begin begins a transaction unless the database is stopped. The transaction is registered with the oracle under the begin lock,
+// so it is either refused or among the open transactions that Close drains.
+func begin[T any](db *KeyValueDB, newTransaction func() (T, error)) (T, error) {
+	db.beginLock.RLock()
+	defer db.beginLock.RUnlock()
+
+	if db.stopped.Load() {
+		var none T
+		return none, DbAlreadyStoppedErr
+	}
+	transaction, err := newTransaction()
+	if err != nil {
+		return transaction, beginErr(err)
+	}
+	return transaction, nil
+}
+
+// beginErr returns DbAlreadyStoppedErr for a transaction that could not begin as the database was stopped while it waited
+// for the commits till its begin timestamp to be applied.
+func beginErr(err error) error {
+	if errors.Is(err, txn.TimestampMarkStoppedErr) {
+		return DbAlreadyStoppedErr
+	}
+	return err
+}
+
+// waitForApply waits for the batch to be applied, or for the context to be done. A batch that is queued for the executor
+// is applied even if the context is done, so ctx.Err() here does not mean that the transaction did not commit.
+func waitForApply(ctx context.Context, doneChannel <-chan error) error {
+	select {
+	case err := <-doneChannel:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// VersionGCStats returns the number of old versions, and their bytes, reclaimed from the memtable by the version GC.
+// A database on an engine other than lsm.Tree reclaims nothing.
+func (db *KeyValueDB) VersionGCStats() lsm.VersionGCStats {
+	if db.tree == nil {
+		return lsm.VersionGCStats{}
+	}
+	return db.tree.VersionGCStats()
+}
+
+// OpenTransactionsOlderThan reports the transactions, managed or not, that began more than the given duration ago
+// and are neither committed nor discarded; a managed transaction that is never finished shows up here.
+func (db *KeyValueDB) OpenTransactionsOlderThan(age time.Duration) []txn.OpenTransaction {
+	return db.oracle.OpenTransactionsOlderThan(age)
+}
+
+// Close rejects new transactions, waits for the transactions in flight to finish and for their batches to be applied,
+// and then stops the background work, syncing the write-ahead log of a durable database.
+// If the context is done before the transactions in flight finish, the database is torn down anyway
+// (the transactions still running fail to commit) and ctx.Err() is returned.
+func (db *KeyValueDB) Close(ctx context.Context) error {
+	db.beginLock.Lock()
+	stopping := db.stopped.CompareAndSwap(false, true)
+	db.beginLock.Unlock()
+	if !stopping {
+		return DbAlreadyStoppedErr
+	}
+	drainErr := db.oracle.Drain(ctx)
+	if err := db.oracle.Stop(); err != nil {
+		return err
+	}
+	return drainErr
 }
 
+// Stop tears the database down without waiting for the transactions in flight, see Close.
 func (db *KeyValueDB) Stop() {
 	if db.stopped.CompareAndSwap(false, true) {
-		db.oracle.Stop()
+		_ = db.oracle.Stop()
 	}
 }
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"IsoTransact/lsm"
+	"IsoTransact/mvcc"
+	"IsoTransact/mvcc/enginetest"
 	"IsoTransact/txn"
 	"IsoTransact/txn/errors"
+	"IsoTransact/wal"
+	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
@@ -12,57 +20,64 @@ import (
 
 func TestGetsTheValueOfANonExistingKey(t *testing.T) {
 	db := NewKeyValueDB(10)
-	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) {
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
 		_, exists := transaction.Get([]byte("non-existing"))
 		assert.Equal(t, false, exists)
+		return nil
 	})
 }
 
 func TestGetsTheValueOfAnExistingKey(t *testing.T) {
 	db := NewKeyValueDB(10)
-	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
-	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
-	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) {
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
 		value, exists := transaction.Get([]byte("HDD"))
 		assert.Equal(t, true, exists)
-		assert.Equal(t, []byte("Hard disk"), value.Slice())
+		assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+		return nil
 	})
 }
 
 func TestPutsMultipleKeyValuesInATransaction(t *testing.T) {
 	db := NewKeyValueDB(10)
-	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
 		for count := 1; count <= 100; count++ {
 			_ = transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count)), []byte("Value:"+strconv.Itoa(count)))
 		}
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
-	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
 		for count := 1; count <= 100; count++ {
 			_ = transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count)), []byte("Value#"+strconv.Itoa(count)))
 		}
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
-	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) {
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
 		for count := 1; count <= 100; count++ {
 			value, exists := transaction.Get([]byte("Key:" + strconv.Itoa(count)))
 			assert.Equal(t, true, exists)
-			assert.Equal(t, []byte("Value:"+strconv.Itoa(count)), value.Slice())
+			assert.Equal(t, []byte("Value#"+strconv.Itoa(count)), value.Slice())
 		}
+		return nil
 	})
 }
 
@@ -73,13 +88,14 @@ func TestInvolvesConflictingTransactions(t *testing.T) {
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		_, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+		_, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
 			delayCommit := func() {
 				time.Sleep(25 * time.Millisecond)
 			}
 			_, _ = transaction.Get([]byte("HDD"))
 			_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
 			delayCommit()
+			return nil
 		})
 		assert.Error(t, err)
 		assert.Equal(t, errors.ConflictErr, err)
@@ -87,12 +103,13 @@ func TestInvolvesConflictingTransactions(t *testing.T) {
 
 	go func() {
 		defer wg.Done()
-		waitChannelTwo, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+		waitChannelTwo, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
 			delayCommit := func() {
 				time.Sleep(10 * time.Millisecond)
 			}
 			_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
 			delayCommit()
+			return nil
 		})
 		assert.Nil(t, err)
 		<-waitChannelTwo
@@ -102,22 +119,24 @@ func TestInvolvesConflictingTransactions(t *testing.T) {
 
 func TestCommitTransactionAndCheckTheCommittedTransactionsInOracle(t *testing.T) {
 	db := NewKeyValueDB(10)
-	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
 	time.Sleep(10 * time.Millisecond) //allow transactionBeginTimestamp mark to be processed
 
-	_, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {})
+	_, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error { return nil })
 	assert.Error(t, err)
 	assert.Equal(t, errors.EmptyTxnError, err)
 
 	time.Sleep(10 * time.Millisecond) //allow transactionBeginTimestamp mark to be processed
 
-	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("isolation"), []byte("Snapshot"))
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
@@ -129,8 +148,9 @@ func TestAttemptsToGetFromAStoppedDb(t *testing.T) {
 	db := NewKeyValueDB(10)
 	db.Stop()
 
-	err := db.Get(func(transaction *txn.ReadOnlyTransaction) {
+	err := db.Get(func(transaction *txn.ReadOnlyTransaction) error {
 		_, _ = transaction.Get([]byte("non-existing"))
+		return nil
 	})
 
 	assert.Error(t, err)
@@ -141,8 +161,9 @@ func TestAttemptsToPutInAStoppedDb(t *testing.T) {
 	db := NewKeyValueDB(10)
 	db.Stop()
 
-	_, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	_, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("isolation"), []byte("Snapshot"))
+		return nil
 	})
 
 	assert.Error(t, err)
@@ -165,9 +186,865 @@ func TestStopsTheDbConcurrently(t *testing.T) {
 	}()
 
 	wg.Wait()
-	err := db.Get(func(transaction *txn.ReadOnlyTransaction) {
+	err := db.Get(func(transaction *txn.ReadOnlyTransaction) error {
 		_, _ = transaction.Get([]byte("HDD"))
+		return nil
 	})
 	assert.Error(t, err)
 	assert.Equal(t, DbAlreadyStoppedErr, err)
 }
+
+func TestRecoversCommittedBatchesFromTheWriteAheadLogOnReopen(t *testing.T) {
+	directory := t.TempDir()
+	db, err := OpenKeyValueDB(DefaultOptions(directory))
+	assert.Nil(t, err)
+
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, <-waitChannel)
+	db.Stop()
+
+	db, err = OpenKeyValueDB(DefaultOptions(directory))
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	//the commit timestamp after reopen must be greater than the replayed one, else the new version of HDD would be lost
+	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, <-waitChannel)
+
+	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("NVMe"), []byte("Non-volatile memory"))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, <-waitChannel)
+
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		value, exists := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+
+		value, exists = transaction.Get([]byte("SSD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Solid state drive"), value.Slice())
+		return nil
+	})
+}
+
+func TestRecoversACommitThatRequiredASyncWithNoSyncDurability(t *testing.T) {
+	directory := t.TempDir()
+	options := DefaultOptions(directory)
+	options.Durability = wal.Durability{Mode: wal.NoSync}
+
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		transaction.RequireSync()
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, <-waitChannel)
+	db.Stop()
+
+	db, err = OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, <-waitChannel)
+
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		value, exists := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Hard disk"), value.Slice())
+		return nil
+	})
+}
+
+func TestReadsTheKeysFlushedToTablesAfterReopen(t *testing.T) {
+	directory := t.TempDir()
+	options := DefaultOptions(directory)
+	options.MemTableSize = 512
+	options.BlockSize = 128
+	options.Durability = wal.Durability{Mode: wal.NoSync}
+
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	for count := 1; count <= 200; count++ {
+		waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+			_ = transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count%50)), []byte("Value:"+strconv.Itoa(count)))
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, <-waitChannel)
+	}
+	db.Stop()
+
+	tables, _ := filepath.Glob(filepath.Join(directory, "*.sst"))
+	assert.True(t, len(tables) > 0)
+
+	db, err = OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		for count := 151; count <= 200; count++ {
+			value, exists := transaction.Get([]byte("Key:" + strconv.Itoa(count%50)))
+			assert.Equal(t, true, exists)
+			assert.Equal(t, []byte("Value:"+strconv.Itoa(count)), value.Slice())
+		}
+		return nil
+	})
+}
+
+func TestDeletesAKey(t *testing.T) {
+	db := NewKeyValueDB(10)
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.Delete([]byte("HDD"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		_, exists := transaction.Get([]byte("HDD"))
+		assert.Equal(t, false, exists)
+		return nil
+	})
+}
+
+func TestReadsTheOldValueOfADeletedKeyInASnapshotBeganBeforeTheDelete(t *testing.T) {
+	db := NewKeyValueDB(10)
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+			_ = transaction.Delete([]byte("HDD"))
+			return nil
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+
+		value, exists := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Hard disk"), value.Slice())
+		return nil
+	})
+}
+
+func TestDoesNotFindAKeyDeletedEarlierInTheSameTransaction(t *testing.T) {
+	db := NewKeyValueDB(10)
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.Delete([]byte("HDD"))
+		_, exists := transaction.Get([]byte("HDD"))
+		assert.Equal(t, false, exists)
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+}
+
+func TestRecoversADeleteFromTheWriteAheadLogAndTheTables(t *testing.T) {
+	directory := t.TempDir()
+	options := DefaultOptions(directory)
+	options.MemTableSize = 256
+	options.Durability = wal.Durability{Mode: wal.NoSync}
+
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	for count := 1; count <= 50; count++ {
+		waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+			_ = transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count)), []byte("Value:"+strconv.Itoa(count)))
+			return nil
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+	}
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.Delete([]byte("Key:1"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+	db.Stop()
+
+	db, err = OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		_, exists := transaction.Get([]byte("Key:1"))
+		assert.Equal(t, false, exists)
+
+		value, exists := transaction.Get([]byte("Key:2"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Value:2"), value.Slice())
+		return nil
+	})
+}
+
+func TestUpdateRetriesATransactionThatConflicts(t *testing.T) {
+	db := NewKeyValueDB(10)
+	attempts, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		value, _ := transaction.Get([]byte("Counter"))
+		if value.Slice() == nil {
+			//a concurrent transaction writes the key read by the first attempt
+			_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+				return transaction.PutOrUpdate([]byte("Counter"), []byte("10"))
+			})
+			assert.Nil(t, err)
+		}
+		counter, _ := strconv.Atoi(string(value.Slice()))
+		return transaction.PutOrUpdate([]byte("Counter"), []byte(strconv.Itoa(counter+1)))
+	}, WithBackoff(time.Microsecond, time.Millisecond))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		value, _ := transaction.Get([]byte("Counter"))
+		assert.Equal(t, []byte("11"), value.Slice())
+		return nil
+	})
+}
+
+func TestUpdateGivesUpAfterTheMaximumAttempts(t *testing.T) {
+	db := NewKeyValueDB(10)
+	attempts, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		transaction.Get([]byte("Counter"))
+		_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("Counter"), []byte("10"))
+		})
+		assert.Nil(t, err)
+		return transaction.PutOrUpdate([]byte("Counter"), []byte("1"))
+	}, WithMaxAttempts(3), WithBackoff(time.Microsecond, time.Millisecond))
+
+	assert.Equal(t, errors.ConflictErr, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestUpdateReturnsTheErrorOfTheCallbackWithoutCommitting(t *testing.T) {
+	db := NewKeyValueDB(10)
+	callbackErr := fmt.Errorf("insufficient balance")
+	attempts, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return callbackErr
+	})
+
+	assert.Equal(t, callbackErr, err)
+	assert.Equal(t, 1, attempts)
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		_, exists := transaction.Get([]byte("HDD"))
+		assert.Equal(t, false, exists)
+		return nil
+	})
+}
+
+func TestUpdateStopsRetryingOnceTheContextIsCancelled(t *testing.T) {
+	db := NewKeyValueDB(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts, err := db.Update(ctx, func(transaction *txn.ReadWriteTransaction) error {
+		transaction.Get([]byte("Counter"))
+		_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("Counter"), []byte("10"))
+		})
+		assert.Nil(t, err)
+		cancel()
+		return transaction.PutOrUpdate([]byte("Counter"), []byte("1"))
+	}, WithBackoff(time.Second, time.Second))
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestUpdatesConcurrentlyWithoutLosingAnIncrement(t *testing.T) {
+	db := NewKeyValueDB(10)
+	var wg sync.WaitGroup
+	for count := 1; count <= 20; count++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+				value, _ := transaction.Get([]byte("Counter"))
+				counter, _ := strconv.Atoi(string(value.Slice()))
+				return transaction.PutOrUpdate([]byte("Counter"), []byte(strconv.Itoa(counter+1)))
+			}, WithMaxAttempts(1000))
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		value, _ := transaction.Get([]byte("Counter"))
+		assert.Equal(t, []byte("20"), value.Slice())
+		return nil
+	})
+}
+
+func TestBacksOffExponentiallyWithJitterUpToTheMaximum(t *testing.T) {
+	options := updateOptions{initialBackoff: 8 * time.Millisecond, maxBackoff: 50 * time.Millisecond}
+	for count := 0; count < 100; count++ {
+		first, third, tenth := options.backoffBefore(1), options.backoffBefore(3), options.backoffBefore(10)
+		assert.True(t, first >= 4*time.Millisecond && first <= 8*time.Millisecond)
+		assert.True(t, third >= 16*time.Millisecond && third <= 32*time.Millisecond)
+		assert.True(t, tenth >= 25*time.Millisecond && tenth <= 50*time.Millisecond)
+	}
+}
+
+func TestDoesNotCommitTheBatchOfACallbackThatReturnsAnError(t *testing.T) {
+	db := NewKeyValueDB(10)
+	callbackErr := fmt.Errorf("insufficient balance")
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return callbackErr
+	})
+	assert.Nil(t, waitChannel)
+	assert.Equal(t, callbackErr, err)
+	assert.Equal(t, 0, db.oracle.CommittedTransactionLength())
+
+	err = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		_, exists := transaction.Get([]byte("HDD"))
+		assert.Equal(t, false, exists)
+		return callbackErr
+	})
+	assert.Equal(t, callbackErr, err)
+}
+
+func TestDoesNotCommitADiscardedTransaction(t *testing.T) {
+	db := NewKeyValueDB(10)
+	_, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		transaction.Rollback()
+		return nil
+	})
+	assert.Equal(t, errors.DiscardedTxnErr, err)
+	assert.Equal(t, 0, db.oracle.CommittedTransactionLength())
+}
+
+func TestFinishesTheBeginTimestampOfAPanickingCallback(t *testing.T) {
+	db := NewKeyValueDB(10)
+	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	assert.Panics(t, func() {
+		_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+			panic("unexpected")
+		})
+	})
+	assert.Panics(t, func() {
+		_, _ = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+			panic("unexpected")
+		})
+	})
+	assert.Eventually(t, func() bool {
+		return db.oracle.DiscardWatermark() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestUpdateDoesNotRunTheCallbackWithADoneContext(t *testing.T) {
+	db := NewKeyValueDB(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts, err := db.Update(ctx, func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, attempts)
+}
+
+func TestReadsTheValueOfAnOpenOldSnapshotAcrossTheVersionGC(t *testing.T) {
+	db := NewKeyValueDB(10)
+	defer db.Stop()
+	_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk:0"))
+	})
+	assert.Nil(t, err)
+
+	snapshot, _ := db.NewTransaction(context.Background(), false)
+	for count := 1; count <= 10; count++ {
+		_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk:"+strconv.Itoa(count)))
+		})
+		assert.Nil(t, err)
+	}
+
+	db.tree.CollectVersions()
+	assert.Equal(t, uint64(0), db.VersionGCStats().ReclaimedVersions)
+
+	value, _, _ := snapshot.Get([]byte("HDD"))
+	assert.Equal(t, []byte("Hard disk:0"), value.Slice())
+	snapshot.Discard()
+
+	assert.Eventually(t, func() bool {
+		db.tree.CollectVersions()
+		//the last update began at 10, the version written at 10 is the oldest one a new transaction can read
+		return db.VersionGCStats().ReclaimedVersions == 9
+	}, time.Second, time.Millisecond)
+	assert.True(t, db.VersionGCStats().ReclaimedBytes > 0)
+
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		value, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, []byte("Hard disk:10"), value.Slice())
+		return nil
+	})
+}
+
+func TestCollectsTheOldVersionsInTheBackground(t *testing.T) {
+	options := DefaultOptions(t.TempDir())
+	options.VersionGCInterval = time.Millisecond
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	for count := 1; count <= 10; count++ {
+		_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk:"+strconv.Itoa(count)))
+		})
+		assert.Nil(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		return db.VersionGCStats().ReclaimedVersions == 8
+	}, time.Second, time.Millisecond)
+}
+
+func TestDoesNotCollectTheOldVersionsWithTheVersionGCDisabled(t *testing.T) {
+	db := NewKeyValueDB(10, WithVersionGCInterval(0))
+	defer db.Stop()
+
+	for count := 1; count <= 10; count++ {
+		updateForTest(t, db, "HDD", "Hard disk:"+strconv.Itoa(count))
+	}
+	time.Sleep(DefaultVersionGCInterval + 100*time.Millisecond)
+	assert.Equal(t, lsm.VersionGCStats{}, db.VersionGCStats())
+
+	db.tree.CollectVersions()
+	assert.Equal(t, uint64(8), db.VersionGCStats().ReclaimedVersions)
+}
+
+func TestFailsTheCommitsOnceTheInMemoryDbIsFull(t *testing.T) {
+	db := NewKeyValueDB(10, WithMemoryLimit(1024))
+	defer db.Stop()
+
+	var err error
+	for count := 0; count < 100 && err == nil; count++ {
+		_, err = db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count)), []byte("Value:"+strconv.Itoa(count)))
+		})
+	}
+	assert.ErrorIs(t, err, errors.MemTableFullErr)
+
+	err = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		value, ok := transaction.Get([]byte("Key:0"))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("Value:0"), value.Slice())
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestAcceptsTheCommitsAgainOnceTheVersionGCMakesRoomInTheInMemoryDb(t *testing.T) {
+	db := NewKeyValueDB(10, WithMemoryLimit(4096), WithVersionGCInterval(0))
+	defer db.Stop()
+
+	var err error
+	for count := 0; count < 1000 && err == nil; count++ {
+		_, err = db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk:"+strconv.Itoa(count)))
+		})
+	}
+	assert.ErrorIs(t, err, errors.MemTableFullErr)
+
+	db.tree.CollectVersions()
+	_, err = db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.Nil(t, err)
+}
+
+func TestAcceptsTheCommitsAgainOnceTheDurableDbFlushesTheMemTables(t *testing.T) {
+	options := DefaultOptions(t.TempDir())
+	options.MemTableSize = 1024
+	options.MemoryLimit = 4096
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	for count := 0; count < 200; count++ {
+		assert.Eventually(t, func() bool {
+			_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+				return transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count)), []byte("Value:"+strconv.Itoa(count)))
+			})
+			return err == nil
+		}, time.Second, time.Millisecond)
+	}
+	assert.True(t, db.tree.NumberOfTables() > 0)
+}
+
+func TestRunsTransactionsOnAPluggedStorageEngine(t *testing.T) {
+	db := NewKeyValueDB(10, WithStorageEngine(enginetest.NewMapEngine()))
+	defer db.Stop()
+
+	_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+	})
+	assert.Nil(t, err)
+	_, err = db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.Delete([]byte("SSD"))
+	})
+	assert.Nil(t, err)
+
+	err = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		value, ok := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+		_, ok = transaction.Get([]byte("SSD"))
+		assert.Equal(t, false, ok)
+
+		iterator := transaction.Iterator(nil, nil)
+		defer iterator.Close()
+		assert.Equal(t, true, iterator.Next())
+		assert.Equal(t, []byte("HDD"), iterator.Key())
+		assert.Equal(t, false, iterator.Next())
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, lsm.VersionGCStats{}, db.VersionGCStats())
+}
+
+// blockingEngine holds the batches back till released, keeping their commits pending.
+type blockingEngine struct {
+	*enginetest.MapEngine
+	release chan struct{}
+}
+
+func (engine *blockingEngine) ApplyBatch(version uint64, entries []mvcc.Entry) {
+	<-engine.release
+	engine.MapEngine.ApplyBatch(version, entries)
+}
+
+func TestReturnsTheErrorOfAPutWhoseContextIsDoneBeforeThePendingCommitsAreApplied(t *testing.T) {
+	engine := &blockingEngine{MapEngine: enginetest.NewMapEngine(), release: make(chan struct{})}
+	db := NewKeyValueDB(10, WithStorageEngine(engine))
+	defer db.Stop()
+
+	pending, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = db.PutOrUpdateWithContext(ctx, func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(engine.release)
+	assert.Nil(t, <-pending)
+}
+
+func updateForTest(t *testing.T, db *KeyValueDB, key, value string) uint64 {
+	_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte(key), []byte(value))
+	})
+	assert.Nil(t, err)
+	return db.CommittedTimestamp()
+}
+
+func TestViewsTheValuesAtAPastCommitTimestamp(t *testing.T) {
+	db := NewKeyValueDB(10)
+	defer db.Stop()
+
+	firstTimestamp := updateForTest(t, db, "HDD", "Hard disk")
+	secondTimestamp := updateForTest(t, db, "HDD", "Hard disk drive")
+	assert.True(t, secondTimestamp > firstTimestamp)
+
+	err := db.ViewAt(context.Background(), firstTimestamp, func(transaction *txn.ReadOnlyTransaction) error {
+		value, ok := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("Hard disk"), value.Slice())
+		return nil
+	})
+	assert.Nil(t, err)
+
+	err = db.ViewAt(context.Background(), secondTimestamp, func(transaction *txn.ReadOnlyTransaction) error {
+		value, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestKeepsTheVersionsAtAPastTimestampWhileViewingThem(t *testing.T) {
+	db := NewKeyValueDB(10)
+	defer db.Stop()
+
+	timestamp := updateForTest(t, db, "HDD", "Hard disk:0")
+	err := db.ViewAt(context.Background(), timestamp, func(transaction *txn.ReadOnlyTransaction) error {
+		for count := 1; count <= 10; count++ {
+			updateForTest(t, db, "HDD", "Hard disk:"+strconv.Itoa(count))
+		}
+		db.tree.CollectVersions()
+
+		value, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, []byte("Hard disk:0"), value.Slice())
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(db.OpenTransactionsOlderThan(0)))
+}
+
+func TestFailsToViewAtATimestampThatTheVersionGCPassed(t *testing.T) {
+	db := NewKeyValueDB(10)
+	defer db.Stop()
+
+	timestamp := updateForTest(t, db, "HDD", "Hard disk:0")
+	for count := 1; count <= 3; count++ {
+		updateForTest(t, db, "HDD", "Hard disk:"+strconv.Itoa(count))
+	}
+	db.tree.CollectVersions()
+
+	err := db.ViewAt(context.Background(), timestamp, func(transaction *txn.ReadOnlyTransaction) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, errors.DiscardedTimestampErr)
+}
+
+func TestViewsAtAPastTimestampKeptAcrossAReopen(t *testing.T) {
+	options := DefaultOptions(t.TempDir())
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	timestamp := updateForTest(t, db, "HDD", "Hard disk")
+	updateForTest(t, db, "HDD", "Hard disk drive")
+	assert.Nil(t, db.Close(context.Background()))
+
+	db, err = OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	err = db.ViewAt(context.Background(), timestamp, func(transaction *txn.ReadOnlyTransaction) error {
+		value, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, []byte("Hard disk"), value.Slice())
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestReturnsTheErrorOfAViewWhoseContextIsDoneBeforeTheTimestampIsApplied(t *testing.T) {
+	engine := &blockingEngine{MapEngine: enginetest.NewMapEngine(), release: make(chan struct{})}
+	db := NewKeyValueDB(10, WithStorageEngine(engine))
+	defer db.Stop()
+
+	pending, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = db.ViewAt(ctx, 1, func(transaction *txn.ReadOnlyTransaction) error {
+		return nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, err = db.CommittedTimestampWithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(engine.release)
+	assert.Nil(t, <-pending)
+}
+
+func TestFailsToViewAtATimestampThatIsNotCommittedYet(t *testing.T) {
+	db := NewKeyValueDB(10)
+	defer db.Stop()
+
+	timestamp := updateForTest(t, db, "HDD", "Hard disk")
+	err := db.ViewAt(context.Background(), timestamp+1, func(transaction *txn.ReadOnlyTransaction) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, errors.UncommittedTimestampErr)
+}
+
+func TestRefusesATransactionBeyondTheBatchLimits(t *testing.T) {
+	options := DefaultOptions(t.TempDir())
+	options.MaxBatchPairs = 2
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	attempts, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		for count := 0; count < 3; count++ {
+			if err := transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count)), []byte("Value")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.Equal(t, 1, attempts)
+	assert.ErrorIs(t, err, errors.TransactionTooLargeErr)
+}
+
+func TestExecutesTheAtomicOperationsAndReplaysTheirValues(t *testing.T) {
+	directory := t.TempDir()
+	db, err := OpenKeyValueDB(DefaultOptions(directory))
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for goroutine := 0; goroutine < 10; goroutine++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.Increment(context.Background(), []byte("counter"), 3)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	put, err := db.PutIfAbsent(context.Background(), []byte("HDD"), []byte("Hard disk"))
+	assert.Nil(t, err)
+	assert.True(t, put)
+	put, err = db.PutIfAbsent(context.Background(), []byte("HDD"), []byte("Hard disk drive"))
+	assert.Nil(t, err)
+	assert.False(t, put)
+
+	swapped, err := db.CompareAndSwap(context.Background(), []byte("HDD"), []byte("Hard disk"), []byte("Hard disk drive"))
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	assert.Nil(t, db.Close(context.Background()))
+
+	db, err = OpenKeyValueDB(DefaultOptions(directory))
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	counter, err := db.Increment(context.Background(), []byte("counter"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), counter)
+
+	swapped, err = db.CompareAndSwap(context.Background(), []byte("HDD"), []byte("Hard disk"), []byte("HDD"))
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+}
+
+func TestFoldsTheMergeOperandsAcrossTheTablesAfterReopen(t *testing.T) {
+	directory := t.TempDir()
+	options := DefaultOptions(directory)
+	options.MemTableSize = 512
+	options.BlockSize = 128
+	options.Durability = wal.Durability{Mode: wal.NoSync}
+	options.VersionGCInterval = time.Millisecond
+
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	for count := 1; count <= 200; count++ {
+		_, err := db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			_ = transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count%50)), []byte("Value:"+strconv.Itoa(count)))
+			return transaction.Merge([]byte("counter"), mvcc.NewMergeOperand(mvcc.SumOperator, txn.EncodeInt64(int64(count))))
+		})
+		assert.Nil(t, err)
+	}
+	db.Stop()
+
+	tables, _ := filepath.Glob(filepath.Join(directory, "*.sst"))
+	assert.True(t, len(tables) > 0)
+
+	db, err = OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	_ = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		value, exists := transaction.Get([]byte("counter"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, txn.EncodeInt64(200*201/2), value.Slice())
+		return nil
+	})
+}
+
+func TestReturnsTheErrorOfReadingATableFromTheReads(t *testing.T) {
+	directory := t.TempDir()
+	options := DefaultOptions(directory)
+	options.MemTableSize = 512
+	options.BlockSize = 128
+	options.Compaction.L0CompactionTrigger = 1000
+	options.Durability = wal.Durability{Mode: wal.NoSync}
+
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	for count := 1; count <= 200; count++ {
+		waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count)), []byte("Value:"+strconv.Itoa(count)))
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, <-waitChannel)
+	}
+	db.Stop()
+
+	db, err = OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	tables, _ := filepath.Glob(filepath.Join(directory, "*.sst"))
+	assert.True(t, len(tables) > 0)
+	for _, table := range tables {
+		assert.Nil(t, os.Truncate(table, 0))
+	}
+
+	err = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		_, exists := transaction.Get([]byte("Key:1"))
+		assert.Equal(t, false, exists)
+		return nil
+	})
+	assert.NotNil(t, err)
+
+	err = db.Get(func(transaction *txn.ReadOnlyTransaction) error {
+		iterator := transaction.Iterator(nil, nil)
+		defer iterator.Close()
+		for iterator.Next() {
+		}
+		assert.NotNil(t, iterator.Err())
+		return nil
+	})
+	assert.NotNil(t, err)
+
+	_, err = db.Update(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_, _ = transaction.Get([]byte("Key:1"))
+		return transaction.PutOrUpdate([]byte("Key:1"), []byte("Value"))
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"IsoTransact/lsm"
+	"IsoTransact/txn"
+	"IsoTransact/wal"
+	"time"
+)
+
+// Options configures a durable KeyValueDB opened with OpenKeyValueDB.
+type Options struct {
+	Directory        string
+	SkipListMaxLevel uint8
+	Durability       wal.Durability
+	//MemTableSize is the size in bytes after which the memtable is frozen and flushed to a table
+	MemTableSize int64
+	//BlockSize is the size in bytes of the data blocks of a table
+	BlockSize  int
+	Compaction lsm.CompactionOptions
+	//MemoryLimit caps the bytes held by the memtables, the commits fail with errors.MemTableFullErr till the flushes or the version GC make room; 0 leaves them uncapped
+	MemoryLimit int64
+	//MaxBatchPairs and MaxBatchBytes limit the keys, and the bytes of keys and values, written by a transaction; 0 takes the default
+	MaxBatchPairs int
+	MaxBatchBytes int64
+	//LockWaitTimeout bounds the wait for a key lock taken with ReadWriteTransaction.GetForUpdate; 0 takes the default
+	LockWaitTimeout time.Duration
+	//IsolationLevel decides which concurrent commits conflict, Serializable by default
+	IsolationLevel txn.IsolationLevel
+	//VersionGCInterval is the interval of the removal of the old versions no transaction can read from the memtable, 0 disables it
+	VersionGCInterval time.Duration
+}
+
+// DefaultVersionGCInterval is also the interval of the version GC of a database created with NewKeyValueDB, see WithVersionGCInterval.
+const DefaultVersionGCInterval = time.Second
+
+func DefaultOptions(directory string) Options {
+	return Options{
+		Directory:         directory,
+		SkipListMaxLevel:  16,
+		Durability:        wal.DefaultDurability(),
+		MemTableSize:      4 << 20,
+		BlockSize:         4 << 10,
+		Compaction:        lsm.DefaultCompactionOptions(),
+		MaxBatchPairs:     txn.DefaultMaxBatchPairs,
+		MaxBatchBytes:     txn.DefaultMaxBatchBytes,
+		LockWaitTimeout:   txn.DefaultLockWaitTimeout,
+		IsolationLevel:    txn.Serializable,
+		VersionGCInterval: DefaultVersionGCInterval,
+	}
+}
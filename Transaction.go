@@ -0,0 +1,127 @@
+package main
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/txn"
+	txnErrors "IsoTransact/txn/errors"
+	"context"
+	"errors"
+	"sync"
+)
+
+var TransactionFinishedErr = errors.New("transaction is already committed or discarded")
+var ReadOnlyTransactionWriteErr = errors.New("can not write in a read-only transaction")
+
+// Transaction is a managed transaction, created by KeyValueDB.NewTransaction and finished by the caller
+// with either Commit or Discard. It can be passed across functions and goroutines, but it is not meant to be used
+// by several goroutines at the same time.
+// A transaction that is never finished holds back the beginTimestampMark, see KeyValueDB.OpenTransactionsOlderThan.
+type Transaction struct {
+	lock      sync.Mutex
+	readOnly  *txn.ReadOnlyTransaction
+	readWrite *txn.ReadWriteTransaction
+	finished  bool
+}
+
+// NewTransaction begins a managed transaction, a read-write one if readWrite is set.
+// It returns ctx.Err() if the context is done before the commits till the begin timestamp are applied.
+func (db *KeyValueDB) NewTransaction(ctx context.Context, readWrite bool) (*Transaction, error) {
+	if readWrite {
+		readWriteTransaction, err := db.beginReadWrite(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Transaction{readWrite: readWriteTransaction}, nil
+	}
+	readOnlyTransaction, err := db.beginReadOnly(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Transaction{readOnly: readOnlyTransaction}, nil
+}
+
+func (transaction *Transaction) Get(key []byte) (mvcc.Value, bool, error) {
+	transaction.lock.Lock()
+	defer transaction.lock.Unlock()
+
+	if transaction.finished {
+		return mvcc.Value{}, false, TransactionFinishedErr
+	}
+	if transaction.readWrite != nil {
+		value, ok := transaction.readWrite.Get(key)
+		return value, ok, transaction.readWrite.Err()
+	}
+	value, ok := transaction.readOnly.Get(key)
+	return value, ok, transaction.readOnly.Err()
+}
+
+func (transaction *Transaction) PutOrUpdate(key []byte, value []byte) error {
+	return transaction.write(func(readWrite *txn.ReadWriteTransaction) error {
+		return readWrite.PutOrUpdate(key, value)
+	})
+}
+
+func (transaction *Transaction) Delete(key []byte) error {
+	return transaction.write(func(readWrite *txn.ReadWriteTransaction) error {
+		return readWrite.Delete(key)
+	})
+}
+
+func (transaction *Transaction) write(operation func(readWrite *txn.ReadWriteTransaction) error) error {
+	transaction.lock.Lock()
+	defer transaction.lock.Unlock()
+
+	if transaction.finished {
+		return TransactionFinishedErr
+	}
+	if transaction.readWrite == nil {
+		return ReadOnlyTransactionWriteErr
+	}
+	return operation(transaction.readWrite)
+}
+
+// Commit commits the writes of a read-write transaction and waits until the batch is applied, or the context is done.
+// If the context is done before the batch is queued for the executor, nothing is committed;
+// if it is done after, the batch is still applied although Commit returns ctx.Err().
+// A transaction without writes (including a read-only one) commits nothing and succeeds.
+// The transaction is finished after Commit, whatever the outcome; a conflicting transaction has to be run again in a new transaction.
+func (transaction *Transaction) Commit(ctx context.Context) error {
+	transaction.lock.Lock()
+	defer transaction.lock.Unlock()
+
+	if transaction.finished {
+		return TransactionFinishedErr
+	}
+	transaction.finished = true
+	if transaction.readOnly != nil {
+		transaction.readOnly.FinishBeginTimestampForReadonlyTransaction()
+		return nil
+	}
+
+	defer transaction.readWrite.FinishBeginTimestampForReadWriteTransaction()
+	doneChannel, err := transaction.readWrite.Commit(ctx)
+	if errors.Is(err, txnErrors.EmptyTxnError) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return waitForApply(ctx, doneChannel)
+}
+
+// Discard drops the writes of the transaction. It is a no-op on a finished transaction,
+// so that it can be deferred right after NewTransaction.
+func (transaction *Transaction) Discard() {
+	transaction.lock.Lock()
+	defer transaction.lock.Unlock()
+
+	if transaction.finished {
+		return
+	}
+	transaction.finished = true
+	if transaction.readOnly != nil {
+		transaction.readOnly.FinishBeginTimestampForReadonlyTransaction()
+		return
+	}
+	transaction.readWrite.Discard()
+}
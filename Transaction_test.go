@@ -0,0 +1,203 @@
+package main
+
+import (
+	"IsoTransact/txn"
+	"IsoTransact/txn/errors"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCommitsAManagedReadWriteTransaction(t *testing.T) {
+	db := NewKeyValueDB(10)
+	transaction, err := db.NewTransaction(context.Background(), true)
+	assert.Nil(t, err)
+
+	assert.Nil(t, transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk")))
+	value, exists, err := transaction.Get([]byte("HDD"))
+	assert.Nil(t, err)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+	assert.Nil(t, transaction.Commit(context.Background()))
+
+	reader, err := db.NewTransaction(context.Background(), false)
+	assert.Nil(t, err)
+	defer reader.Discard()
+
+	value, exists, err = reader.Get([]byte("HDD"))
+	assert.Nil(t, err)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+}
+
+func TestErrorsOnTheUseOfAManagedTransactionAfterCommit(t *testing.T) {
+	db := NewKeyValueDB(10)
+	transaction, _ := db.NewTransaction(context.Background(), true)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	assert.Nil(t, transaction.Commit(context.Background()))
+
+	_, _, err := transaction.Get([]byte("HDD"))
+	assert.Equal(t, TransactionFinishedErr, err)
+	assert.Equal(t, TransactionFinishedErr, transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state")))
+	assert.Equal(t, TransactionFinishedErr, transaction.Commit(context.Background()))
+	transaction.Discard()
+}
+
+func TestErrorsOnAWriteInAManagedReadOnlyTransaction(t *testing.T) {
+	db := NewKeyValueDB(10)
+	transaction, _ := db.NewTransaction(context.Background(), false)
+	defer transaction.Discard()
+
+	assert.Equal(t, ReadOnlyTransactionWriteErr, transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk")))
+}
+
+func TestDoesNotCommitADiscardedManagedTransaction(t *testing.T) {
+	db := NewKeyValueDB(10)
+	transaction, _ := db.NewTransaction(context.Background(), true)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	transaction.Discard()
+	assert.Equal(t, TransactionFinishedErr, transaction.Commit(context.Background()))
+
+	reader, _ := db.NewTransaction(context.Background(), false)
+	defer reader.Discard()
+	_, exists, _ := reader.Get([]byte("HDD"))
+	assert.Equal(t, false, exists)
+}
+
+func TestReturnsAConflictForAManagedTransaction(t *testing.T) {
+	db := NewKeyValueDB(10)
+	aTransaction, _ := db.NewTransaction(context.Background(), true)
+	anotherTransaction, _ := db.NewTransaction(context.Background(), true)
+
+	_, _, _ = aTransaction.Get([]byte("HDD"))
+	_ = aTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	_ = anotherTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+
+	assert.Nil(t, anotherTransaction.Commit(context.Background()))
+	assert.Equal(t, errors.ConflictErr, aTransaction.Commit(context.Background()))
+	assert.Empty(t, db.OpenTransactionsOlderThan(0))
+}
+
+func TestDoesNotConflictOnTheReadsOfAManagedTransactionWithSnapshotIsolation(t *testing.T) {
+	db := NewKeyValueDB(10, WithIsolationLevel(txn.SnapshotIsolation))
+	aTransaction, _ := db.NewTransaction(context.Background(), true)
+	anotherTransaction, _ := db.NewTransaction(context.Background(), true)
+
+	_, _, _ = aTransaction.Get([]byte("HDD"))
+	_ = aTransaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	_ = anotherTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+
+	assert.Nil(t, anotherTransaction.Commit(context.Background()))
+	assert.Nil(t, aTransaction.Commit(context.Background()))
+}
+
+func TestReportsTheManagedTransactionsThatAreNeverFinished(t *testing.T) {
+	db := NewKeyValueDB(10)
+	finished, _ := db.NewTransaction(context.Background(), true)
+	leaked, _ := db.NewTransaction(context.Background(), false)
+	_ = finished.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	assert.Nil(t, finished.Commit(context.Background()))
+
+	time.Sleep(5 * time.Millisecond)
+	openTransactions := db.OpenTransactionsOlderThan(time.Millisecond)
+	assert.Equal(t, 1, len(openTransactions))
+	assert.Equal(t, false, openTransactions[0].ReadWrite)
+	assert.Empty(t, db.OpenTransactionsOlderThan(time.Hour))
+
+	leaked.Discard()
+	assert.Empty(t, db.OpenTransactionsOlderThan(0))
+}
+
+func TestFinishesTheBeginTimestampOfAManagedTransactionOnlyOnce(t *testing.T) {
+	db := NewKeyValueDB(10)
+	transaction, _ := db.NewTransaction(context.Background(), true)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	assert.Nil(t, transaction.Commit(context.Background()))
+	transaction.Discard()
+
+	//a transaction at the same begin timestamp must keep holding back the mark
+	reader, _ := db.NewTransaction(context.Background(), false)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, uint64(0), db.oracle.DiscardWatermark())
+
+	reader.Discard()
+	assert.Eventually(t, func() bool {
+		return db.oracle.DiscardWatermark() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestClosesOnceTheTransactionsInFlightAreCommitted(t *testing.T) {
+	options := DefaultOptions(t.TempDir())
+	db, err := OpenKeyValueDB(options)
+	assert.Nil(t, err)
+
+	transaction, _ := db.NewTransaction(context.Background(), true)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	closeErrChannel := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		closeErrChannel <- db.Close(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := db.NewTransaction(context.Background(), false)
+		return err == DbAlreadyStoppedErr
+	}, time.Second, time.Millisecond)
+
+	assert.Nil(t, transaction.Commit(context.Background()))
+	assert.Nil(t, <-closeErrChannel)
+
+	db, err = OpenKeyValueDB(options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	reader, _ := db.NewTransaction(context.Background(), false)
+	defer reader.Discard()
+	value, exists, _ := reader.Get([]byte("HDD"))
+	assert.Equal(t, true, exists)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+}
+
+func TestDrainsEveryTransactionThatBeganWhileClosing(t *testing.T) {
+	db := NewKeyValueDB(10)
+
+	var wg sync.WaitGroup
+	for writer := 0; writer < 8; writer++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for count := 0; ; count++ {
+				transaction, err := db.NewTransaction(context.Background(), true)
+				if err != nil {
+					assert.Equal(t, DbAlreadyStoppedErr, err)
+					return
+				}
+				_ = transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(writer)), []byte("Value:"+strconv.Itoa(count)))
+				assert.Nil(t, transaction.Commit(context.Background()))
+			}
+		}(writer)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, db.Close(ctx))
+	wg.Wait()
+}
+
+func TestTearsDownOnceTheContextOfCloseIsDone(t *testing.T) {
+	db := NewKeyValueDB(10)
+	transaction, _ := db.NewTransaction(context.Background(), true)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, db.Close(ctx))
+
+	assert.Equal(t, txn.ExecutorStoppedErr, transaction.Commit(context.Background()))
+	assert.Equal(t, DbAlreadyStoppedErr, db.Close(context.Background()))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// UpdateOption configures the retries of KeyValueDB.Update.
+type UpdateOption func(options *updateOptions)
+
+type updateOptions struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func defaultUpdateOptions() updateOptions {
+	return updateOptions{maxAttempts: 10, initialBackoff: time.Millisecond, maxBackoff: 100 * time.Millisecond}
+}
+
+// WithMaxAttempts limits the number of times the callback is run, including the first attempt.
+func WithMaxAttempts(maxAttempts int) UpdateOption {
+	return func(options *updateOptions) {
+		if maxAttempts > 0 {
+			options.maxAttempts = maxAttempts
+		}
+	}
+}
+
+// WithBackoff sets the wait before the first retry, which doubles on every further retry up to maxBackoff.
+func WithBackoff(initialBackoff time.Duration, maxBackoff time.Duration) UpdateOption {
+	return func(options *updateOptions) {
+		options.initialBackoff, options.maxBackoff = initialBackoff, maxBackoff
+	}
+}
+
+// backoffBefore returns the wait before the given retry (1 for the first retry): a random duration between half of
+// and the whole of the exponential backoff, so that the transactions that conflicted with each other do not retry in lockstep.
+func (options updateOptions) backoffBefore(retry int) time.Duration {
+	backoff := options.initialBackoff
+	for count := 1; count < retry && backoff < options.maxBackoff; count++ {
+		backoff = backoff * 2
+	}
+	if backoff > options.maxBackoff {
+		backoff = options.maxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
@@ -0,0 +1,418 @@
+package lsm
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/table"
+	"bytes"
+	"errors"
+	"os"
+	"sort"
+	"time"
+)
+
+var InvalidCompactionOptionsErr = errors.New("compaction needs at least 2 levels, and positive trigger, sizes and multiplier")
+
+type CompactionOptions struct {
+	//MaxLevels is the number of levels, including level 0
+	MaxLevels int
+	//L0CompactionTrigger is the number of level 0 tables that triggers a compaction of level 0 into level 1
+	L0CompactionTrigger int
+	//BaseLevelSize is the target size in bytes of level 1, every next level is LevelSizeMultiplier times the previous one
+	BaseLevelSize       int64
+	LevelSizeMultiplier int
+	//TableSize is the size in bytes after which the table being written by a compaction is cut
+	TableSize int64
+	//Interval is how often the compactor checks the levels, besides after every flush; zero checks after flushes only
+	Interval time.Duration
+}
+
+func DefaultCompactionOptions() CompactionOptions {
+	return CompactionOptions{
+		MaxLevels:           7,
+		L0CompactionTrigger: 4,
+		BaseLevelSize:       40 << 20,
+		LevelSizeMultiplier: 10,
+		TableSize:           4 << 20,
+		Interval:            time.Second,
+	}
+}
+
+func (options CompactionOptions) validate() error {
+	if options.MaxLevels < 2 || options.L0CompactionTrigger <= 0 || options.BaseLevelSize <= 0 ||
+		options.LevelSizeMultiplier <= 1 || options.TableSize <= 0 {
+		return InvalidCompactionOptionsErr
+	}
+	return nil
+}
+
+func (options CompactionOptions) targetSize(level int) int64 {
+	targetSize := options.BaseLevelSize
+	for count := 1; count < level; count++ {
+		targetSize = targetSize * int64(options.LevelSizeMultiplier)
+	}
+	return targetSize
+}
+
+// compaction merges the inputs picked from a level with the overlapping tables of the next level,
+// and replaces all of them with the merged tables in the next level.
+type compaction struct {
+	level       int
+	inputs      []*table.Reader
+	overlapping []*table.Reader
+	//bottommost is set when no level below the target level holds the keys being compacted,
+	//so a tombstone shadowing everything below the discard watermark has nothing left to shadow
+	bottommost bool
+}
+
+func (compaction *compaction) targetLevel() int {
+	return compaction.level + 1
+}
+
+func (compaction *compaction) allTables() []*table.Reader {
+	return append(append([]*table.Reader{}, compaction.inputs...), compaction.overlapping...)
+}
+
+func (tree *Tree) spinCompactions() {
+	defer tree.workers.Done()
+
+	var tick <-chan time.Time
+	if tree.options.Compaction.Interval > 0 {
+		ticker := time.NewTicker(tree.options.Compaction.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tree.compactionChannel:
+			tree.compactWhileNeeded()
+		case <-tick:
+			tree.compactWhileNeeded()
+		case <-tree.stopChannel:
+			return
+		}
+	}
+}
+
+// compactWhileNeeded runs compactions until no level is beyond its target, or a compaction fails.
+// A failed compaction leaves the levels as they were; it is retried on the next check.
+func (tree *Tree) compactWhileNeeded() {
+	for {
+		select {
+		case <-tree.stopChannel:
+			return
+		default:
+		}
+		compaction, ok := tree.pickCompaction()
+		if !ok {
+			return
+		}
+		if err := tree.runCompaction(compaction); err != nil {
+			return
+		}
+	}
+}
+
+// pickCompaction picks the level with the highest score, if the score is at least 1.
+// The score of level 0 is its number of tables relative to L0CompactionTrigger, the score of the other levels
+// is their size relative to their target size. The last level is never compacted.
+// The picked tables are referenced, and released once the compaction is done.
+func (tree *Tree) pickCompaction() (*compaction, bool) {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+
+	options := tree.options.Compaction
+	pickedLevel, highestScore := -1, 1.0
+	for level := 0; level < len(tree.levels)-1; level++ {
+		var score float64
+		if level == 0 {
+			score = float64(len(tree.levels[0])) / float64(options.L0CompactionTrigger)
+		} else {
+			score = float64(levelSize(tree.levels[level])) / float64(options.targetSize(level))
+		}
+		if score >= highestScore {
+			pickedLevel, highestScore = level, score
+		}
+	}
+	if pickedLevel < 0 {
+		return nil, false
+	}
+
+	compaction := &compaction{level: pickedLevel}
+	if pickedLevel == 0 {
+		//level 0 tables overlap each other, all of them are compacted together to keep the newer versions above the older ones
+		compaction.inputs = append(compaction.inputs, tree.levels[0]...)
+	} else {
+		cursor := tree.compactionCursors[pickedLevel] % len(tree.levels[pickedLevel])
+		tree.compactionCursors[pickedLevel] = cursor + 1
+		compaction.inputs = []*table.Reader{tree.levels[pickedLevel][cursor]}
+	}
+	smallestKey, largestKey := keyRange(compaction.inputs)
+	for _, reader := range tree.levels[compaction.targetLevel()] {
+		if bytes.Compare(reader.LargestKey().GetKey(), smallestKey) >= 0 && bytes.Compare(reader.SmallestKey().GetKey(), largestKey) <= 0 {
+			compaction.overlapping = append(compaction.overlapping, reader)
+		}
+	}
+	compaction.bottommost = true
+	for level := compaction.targetLevel() + 1; level < len(tree.levels); level++ {
+		for _, reader := range tree.levels[level] {
+			if bytes.Compare(reader.LargestKey().GetKey(), smallestKey) >= 0 && bytes.Compare(reader.SmallestKey().GetKey(), largestKey) <= 0 {
+				compaction.bottommost = false
+			}
+		}
+	}
+	for _, reader := range compaction.allTables() {
+		reader.IncrementReference()
+	}
+	return compaction, true
+}
+
+func levelSize(tables []*table.Reader) int64 {
+	size := int64(0)
+	for _, reader := range tables {
+		size = size + reader.Size()
+	}
+	return size
+}
+
+func keyRange(tables []*table.Reader) ([]byte, []byte) {
+	smallestKey, largestKey := tables[0].SmallestKey().GetKey(), tables[0].LargestKey().GetKey()
+	for _, reader := range tables[1:] {
+		if bytes.Compare(reader.SmallestKey().GetKey(), smallestKey) < 0 {
+			smallestKey = reader.SmallestKey().GetKey()
+		}
+		if bytes.Compare(reader.LargestKey().GetKey(), largestKey) > 0 {
+			largestKey = reader.LargestKey().GetKey()
+		}
+	}
+	return smallestKey, largestKey
+}
+
+func (tree *Tree) runCompaction(compaction *compaction) error {
+	defer releaseTables(compaction.allTables())
+
+	discardWatermark := tree.claimDiscardWatermark()
+
+	tableIterators := make([]*table.Iterator, 0, len(compaction.allTables()))
+	iterators := make([]mvcc.Iterator, 0, len(compaction.allTables()))
+	for _, reader := range compaction.allTables() {
+		tableIterator := reader.NewIterator()
+		tableIterators = append(tableIterators, tableIterator)
+		iterators = append(iterators, tableIterator)
+	}
+
+	outputs, err := tree.writeCompactedTables(newVersionDiscardingIterator(NewMergeIterator(iterators), discardWatermark, compaction.bottommost))
+	if err == nil {
+		for _, tableIterator := range tableIterators {
+			if err = tableIterator.Err(); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		discardTables(outputs)
+		return err
+	}
+	return tree.installCompaction(compaction, outputs)
+}
+
+// writeCompactedTables writes the iterator out as tables of about TableSize each.
+// A table is only cut in between two keys, never in between two versions of a key, so that the tables of a level
+// have disjoint key ranges and all the versions of a key are in one table of a level.
+func (tree *Tree) writeCompactedTables(iterator mvcc.Iterator) ([]*table.Reader, error) {
+	var outputs []*table.Reader
+	var writer *table.Writer
+	var tableId uint64
+	var previousKey []byte
+
+	finishTable := func() error {
+		if err := writer.Finish(); err != nil {
+			writer.Abort()
+			return err
+		}
+		reader, err := table.Open(tree.tablePath(tableId))
+		if err != nil {
+			_ = os.Remove(tree.tablePath(tableId))
+			return err
+		}
+		outputs = append(outputs, reader)
+		writer = nil
+		return nil
+	}
+
+	for iterator.Next() {
+		key := iterator.Key()
+		if writer != nil && writer.EstimatedSize() >= tree.options.Compaction.TableSize && !bytes.Equal(previousKey, key.GetKey()) {
+			if err := finishTable(); err != nil {
+				return outputs, err
+			}
+		}
+		if writer == nil {
+			tree.lock.Lock()
+			tableId = tree.nextTableId()
+			tree.lock.Unlock()
+
+			var err error
+			if writer, err = table.NewWriter(tree.tablePath(tableId), tree.options.BlockSize); err != nil {
+				return outputs, err
+			}
+		}
+		if err := writer.Add(key, iterator.Value()); err != nil {
+			writer.Abort()
+			return outputs, err
+		}
+		previousKey = key.GetKey()
+	}
+	if writer != nil {
+		if err := finishTable(); err != nil {
+			return outputs, err
+		}
+	}
+	return outputs, nil
+}
+
+func discardTables(tables []*table.Reader) {
+	for _, reader := range tables {
+		reader.MarkForDeletion()
+		_ = reader.Close()
+	}
+}
+
+// installCompaction replaces the compacted tables with the outputs in the manifest and in the levels.
+// The replaced tables are removed once the readers that still reference them are done.
+func (tree *Tree) installCompaction(compaction *compaction, outputs []*table.Reader) error {
+	compacted := make(map[*table.Reader]bool)
+	for _, reader := range compaction.allTables() {
+		compacted[reader] = true
+	}
+
+	tree.lock.Lock()
+	levels := make([][]*table.Reader, len(tree.levels))
+	for level, tables := range tree.levels {
+		for _, reader := range tables {
+			if !compacted[reader] {
+				levels[level] = append(levels[level], reader)
+			}
+		}
+	}
+	targetLevel := compaction.targetLevel()
+	levels[targetLevel] = append(levels[targetLevel], outputs...)
+	sort.Slice(levels[targetLevel], func(i, j int) bool {
+		return bytes.Compare(levels[targetLevel][i].SmallestKey().GetKey(), levels[targetLevel][j].SmallestKey().GetKey()) < 0
+	})
+
+	updatedManifest := tree.manifest
+	updatedManifest.discardedTill = tree.discardedTill.Load()
+	updatedManifest.tables = nil
+	for level, tables := range levels {
+		for _, reader := range tables {
+			updatedManifest.tables = append(updatedManifest.tables, tableInfo{id: tableIdOf(reader), level: uint8(level)})
+		}
+	}
+	if err := writeManifest(tree.options.Directory, updatedManifest); err != nil {
+		tree.lock.Unlock()
+		discardTables(outputs)
+		return err
+	}
+	tree.manifest = updatedManifest
+	tree.levels = levels
+	tree.lock.Unlock()
+
+	discardTables(compaction.allTables())
+	return nil
+}
+
+// versionDiscardingIterator drops the versions that no reader can observe.
+// Every current and future reader reads at or above the discard watermark, so for every key it keeps
+// all the versions above the watermark and the highest version at or below it, which is what the readers at the watermark see.
+// If that highest version is a tombstone and there are no older versions below the compacted levels, the tombstone is dropped as well.
+// A highest version that is a merge operand is collapsed with the versions below it, down to a regular value or a tombstone;
+// without one in the compacted levels, the operands collapse into a single one, unless nothing is below the compacted levels.
+type versionDiscardingIterator struct {
+	source           mvcc.Iterator
+	discardWatermark uint64
+	dropTombstones   bool
+	pending          []pendingEntry
+	pendingVisible   *pendingEntry
+	current          pendingEntry
+	exhausted        bool
+}
+
+type pendingEntry struct {
+	key   mvcc.VersionedKey
+	value mvcc.Value
+}
+
+func newVersionDiscardingIterator(source mvcc.Iterator, discardWatermark uint64, dropTombstones bool) *versionDiscardingIterator {
+	return &versionDiscardingIterator{source: source, discardWatermark: discardWatermark, dropTombstones: dropTombstones}
+}
+
+func (iterator *versionDiscardingIterator) Next() bool {
+	for len(iterator.pending) == 0 {
+		if iterator.exhausted {
+			return false
+		}
+		iterator.fill()
+	}
+	iterator.current = iterator.pending[0]
+	iterator.pending = iterator.pending[1:]
+	return true
+}
+
+// fill reads from the source until at least one entry can be emitted.
+func (iterator *versionDiscardingIterator) fill() {
+	if !iterator.source.Next() {
+		iterator.exhausted = true
+		iterator.flushVisible()
+		return
+	}
+	entry := pendingEntry{key: iterator.source.Key(), value: iterator.source.Value()}
+	if iterator.pendingVisible != nil && !bytes.Equal(iterator.pendingVisible.key.GetKey(), entry.key.GetKey()) {
+		iterator.flushVisible()
+	}
+	if entry.key.GetVersion() <= iterator.discardWatermark {
+		//a higher version at or below the watermark shadows the one held so far, which is dropped, or collapses it
+		if iterator.pendingVisible != nil {
+			merged, ok := mvcc.MergeOnto(iterator.pendingVisible.value, entry.value)
+			if !ok && iterator.dropTombstones {
+				//the operands held so far have nothing below them, the held one is merged onto nothing first
+				if held, resolved := mvcc.MergeOnto(mvcc.NewTombstone(), iterator.pendingVisible.value); resolved {
+					merged, ok = mvcc.MergeOnto(held, entry.value)
+				}
+			}
+			if !ok {
+				//operands that do not collapse are kept
+				iterator.pending = append(iterator.pending, *iterator.pendingVisible)
+				merged = entry.value
+			}
+			entry.value = merged
+		}
+		iterator.pendingVisible = &entry
+		return
+	}
+	iterator.flushVisible()
+	iterator.pending = append(iterator.pending, entry)
+}
+
+func (iterator *versionDiscardingIterator) flushVisible() {
+	if iterator.pendingVisible != nil && iterator.dropTombstones && iterator.pendingVisible.value.IsMergeOperand() {
+		//nothing is below the operand for it to merge onto
+		if merged, ok := mvcc.MergeOnto(mvcc.NewTombstone(), iterator.pendingVisible.value); ok {
+			iterator.pendingVisible.value = merged
+		}
+	}
+	if iterator.pendingVisible != nil && iterator.dropTombstones && iterator.pendingVisible.value.IsTombstone() {
+		iterator.pendingVisible = nil
+	}
+	if iterator.pendingVisible != nil {
+		iterator.pending = append(iterator.pending, *iterator.pendingVisible)
+		iterator.pendingVisible = nil
+	}
+}
+
+func (iterator *versionDiscardingIterator) Key() mvcc.VersionedKey {
+	return iterator.current.key
+}
+
+func (iterator *versionDiscardingIterator) Value() mvcc.Value {
+	return iterator.current.value
+}
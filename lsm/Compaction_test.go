@@ -0,0 +1,212 @@
+package lsm
+
+import (
+	"IsoTransact/mvcc"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type sliceIterator struct {
+	keys       []mvcc.VersionedKey
+	tombstones map[int]bool
+	values     map[int]mvcc.Value
+	position   int
+}
+
+func (iterator *sliceIterator) Next() bool {
+	iterator.position++
+	return iterator.position < len(iterator.keys)
+}
+
+func (iterator *sliceIterator) Key() mvcc.VersionedKey {
+	return iterator.keys[iterator.position]
+}
+
+func (iterator *sliceIterator) Value() mvcc.Value {
+	if iterator.tombstones[iterator.position] {
+		return mvcc.NewTombstone()
+	}
+	if value, ok := iterator.values[iterator.position]; ok {
+		return value
+	}
+	return mvcc.NewValue([]byte(strconv.Itoa(int(iterator.keys[iterator.position].GetVersion()))))
+}
+
+func newSliceIterator(keys ...mvcc.VersionedKey) *sliceIterator {
+	return &sliceIterator{keys: keys, position: -1, tombstones: make(map[int]bool), values: make(map[int]mvcc.Value)}
+}
+
+func versionedKey(key string, version uint64) mvcc.VersionedKey {
+	return *mvcc.NewVersionedKey([]byte(key), version)
+}
+
+func collect(iterator mvcc.Iterator) []mvcc.VersionedKey {
+	var keys []mvcc.VersionedKey
+	for iterator.Next() {
+		keys = append(keys, iterator.Key())
+	}
+	return keys
+}
+
+func compactionOptionsForTest() CompactionOptions {
+	return CompactionOptions{
+		MaxLevels:           3,
+		L0CompactionTrigger: 2,
+		BaseLevelSize:       2 << 10,
+		LevelSizeMultiplier: 4,
+		TableSize:           512,
+	}
+}
+
+func TestMergesSortedIterators(t *testing.T) {
+	merged := NewMergeIterator([]mvcc.Iterator{
+		newSliceIterator(versionedKey("HDD", 1), versionedKey("SSD", 2)),
+		newSliceIterator(versionedKey("HDD", 3), versionedKey("NVMe", 1)),
+		newSliceIterator(),
+	})
+
+	assert.Equal(t, []mvcc.VersionedKey{
+		versionedKey("HDD", 1), versionedKey("HDD", 3), versionedKey("NVMe", 1), versionedKey("SSD", 2),
+	}, collect(merged))
+}
+
+func TestKeepsTheHighestVersionAtOrBelowTheDiscardWatermarkAndAllTheVersionsAboveIt(t *testing.T) {
+	source := newSliceIterator(
+		versionedKey("HDD", 1), versionedKey("HDD", 3), versionedKey("HDD", 5), versionedKey("HDD", 8),
+		versionedKey("NVMe", 2),
+		versionedKey("SSD", 6), versionedKey("SSD", 7),
+	)
+
+	assert.Equal(t, []mvcc.VersionedKey{
+		versionedKey("HDD", 5), versionedKey("HDD", 8),
+		versionedKey("NVMe", 2),
+		versionedKey("SSD", 6), versionedKey("SSD", 7),
+	}, collect(newVersionDiscardingIterator(source, 5, false)))
+}
+
+func TestKeepsAllTheVersionsWithAZeroDiscardWatermark(t *testing.T) {
+	source := newSliceIterator(versionedKey("HDD", 1), versionedKey("HDD", 3))
+
+	assert.Equal(t, []mvcc.VersionedKey{
+		versionedKey("HDD", 1), versionedKey("HDD", 3),
+	}, collect(newVersionDiscardingIterator(source, 0, false)))
+}
+
+func TestDropsATombstoneAtOrBelowTheDiscardWatermarkOnlyInABottommostCompaction(t *testing.T) {
+	newSource := func() *sliceIterator {
+		source := newSliceIterator(versionedKey("HDD", 1), versionedKey("HDD", 3), versionedKey("SSD", 2), versionedKey("SSD", 6))
+		source.tombstones[1] = true
+		source.tombstones[3] = true
+		return source
+	}
+
+	assert.Equal(t, []mvcc.VersionedKey{
+		versionedKey("SSD", 2), versionedKey("SSD", 6),
+	}, collect(newVersionDiscardingIterator(newSource(), 5, true)))
+
+	assert.Equal(t, []mvcc.VersionedKey{
+		versionedKey("HDD", 3), versionedKey("SSD", 2), versionedKey("SSD", 6),
+	}, collect(newVersionDiscardingIterator(newSource(), 5, false)))
+}
+
+func TestCollapsesTheMergeOperandsAtOrBelowTheDiscardWatermark(t *testing.T) {
+	newSource := func() *sliceIterator {
+		source := newSliceIterator(
+			versionedKey("counter", 1), versionedKey("counter", 2), versionedKey("counter", 3), versionedKey("counter", 6),
+			versionedKey("list", 2), versionedKey("list", 4),
+		)
+		source.values[0] = mvcc.NewValue([]byte{0, 0, 0, 0, 0, 0, 0, 10})
+		source.values[1] = mvcc.NewMergeOperand(mvcc.SumOperator, []byte{0, 0, 0, 0, 0, 0, 0, 5})
+		source.values[2] = mvcc.NewMergeOperand(mvcc.SumOperator, []byte{0, 0, 0, 0, 0, 0, 0, 1})
+		source.values[3] = mvcc.NewMergeOperand(mvcc.SumOperator, []byte{0, 0, 0, 0, 0, 0, 0, 1})
+		source.values[4] = mvcc.NewMergeOperand(mvcc.AppendOperator, mvcc.EncodeList([]byte("HDD")))
+		source.values[5] = mvcc.NewMergeOperand(mvcc.AppendOperator, mvcc.EncodeList([]byte("SSD")))
+		return source
+	}
+	collectValues := func(iterator mvcc.Iterator) []mvcc.Value {
+		var values []mvcc.Value
+		for iterator.Next() {
+			values = append(values, iterator.Value())
+		}
+		return values
+	}
+
+	compacted := newVersionDiscardingIterator(newSource(), 5, false)
+	assert.Equal(t, []mvcc.Value{
+		mvcc.NewValue([]byte{0, 0, 0, 0, 0, 0, 0, 16}),
+		mvcc.NewMergeOperand(mvcc.SumOperator, []byte{0, 0, 0, 0, 0, 0, 0, 1}),
+		mvcc.NewMergeOperand(mvcc.AppendOperator, mvcc.EncodeList([]byte("HDD"), []byte("SSD"))),
+	}, collectValues(compacted))
+	assert.Equal(t, []mvcc.VersionedKey{
+		versionedKey("counter", 3), versionedKey("counter", 6), versionedKey("list", 4),
+	}, collect(newVersionDiscardingIterator(newSource(), 5, false)))
+
+	bottommost := newVersionDiscardingIterator(newSource(), 5, true)
+	assert.Equal(t, []mvcc.Value{
+		mvcc.NewValue([]byte{0, 0, 0, 0, 0, 0, 0, 16}),
+		mvcc.NewMergeOperand(mvcc.SumOperator, []byte{0, 0, 0, 0, 0, 0, 0, 1}),
+		mvcc.NewValue(mvcc.EncodeList([]byte("HDD"), []byte("SSD"))),
+	}, collectValues(bottommost))
+}
+
+func TestCompactsLevel0TablesIntoTheLowerLevels(t *testing.T) {
+	directory := t.TempDir()
+	options := optionsForTest(directory)
+	options.Compaction = compactionOptionsForTest()
+
+	tree, err := Open(options)
+	assert.Nil(t, err)
+
+	putKeysForTest(tree, 1, 400)
+	waitForFlushes(t, tree)
+	assert.Eventually(t, func() bool {
+		return tree.NumberOfTablesAt(0) < options.Compaction.L0CompactionTrigger
+	}, time.Second, time.Millisecond)
+	assert.True(t, tree.NumberOfTablesAt(1)+tree.NumberOfTablesAt(2) > 0)
+
+	for version := 1; version <= 400; version++ {
+		value, ok, _ := tree.Get(*mvcc.NewVersionedKey([]byte("Key:"+strconv.Itoa(version%10)), uint64(version)))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("Value:"+strconv.Itoa(version)), value.Slice())
+	}
+	tree.Close()
+
+	tree, err = Open(options)
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	for version := 1; version <= int(tree.FlushedTill()); version++ {
+		value, ok, _ := tree.Get(*mvcc.NewVersionedKey([]byte("Key:"+strconv.Itoa(version%10)), uint64(version)))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("Value:"+strconv.Itoa(version)), value.Slice())
+	}
+}
+
+func TestDiscardsTheVersionsBelowTheDiscardWatermarkDuringCompaction(t *testing.T) {
+	options := optionsForTest(t.TempDir())
+	options.Compaction = compactionOptionsForTest()
+
+	tree, err := Open(options)
+	assert.Nil(t, err)
+	defer tree.Close()
+	tree.SetDiscardWatermark(func() uint64 {
+		return 300
+	})
+
+	putKeysForTest(tree, 1, 400)
+	waitForFlushes(t, tree)
+	assert.Eventually(t, func() bool {
+		return tree.NumberOfTablesAt(0) < options.Compaction.L0CompactionTrigger
+	}, time.Second, time.Millisecond)
+
+	//the versions at or above the watermark are all retained
+	value, ok, _ := tree.Get(*mvcc.NewVersionedKey([]byte("Key:7"), 300))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Value:297"), value.Slice())
+
+	//the versions shadowed by the highest version at or below the watermark are gone from the compacted levels
+	_, ok, _ = tree.Get(*mvcc.NewVersionedKey([]byte("Key:7"), 7))
+	assert.Equal(t, false, ok)
+}
@@ -0,0 +1,128 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+const (
+	manifestFileName          = "MANIFEST"
+	temporaryManifestFileName = "MANIFEST.tmp"
+)
+
+var CorruptManifestErr = errors.New("manifest is corrupt")
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+type tableInfo struct {
+	id    uint64
+	level uint8
+}
+
+// manifest records the tables that make up the tree, the highest commit timestamp flushed to them,
+// and the highest discard watermark the versions in them may have been discarded below.
+// It is rewritten as a whole (write to a temporary file and rename) every time the set of tables changes.
+type manifest struct {
+	flushedTill   uint64
+	nextFileId    uint64
+	discardedTill uint64
+	tables        []tableInfo
+}
+
+func newManifest() manifest {
+	return manifest{nextFileId: 1}
+}
+
+// encode lays out the manifest as:
+// flushedTill (8 bytes) | nextFileId (8 bytes) | discardedTill (8 bytes) | number of tables (uvarint) | [table id (uvarint) | level (1 byte)]... | checksum (4 bytes)
+func (manifest manifest) encode() []byte {
+	buffer := binary.BigEndian.AppendUint64(nil, manifest.flushedTill)
+	buffer = binary.BigEndian.AppendUint64(buffer, manifest.nextFileId)
+	buffer = binary.BigEndian.AppendUint64(buffer, manifest.discardedTill)
+	buffer = binary.AppendUvarint(buffer, uint64(len(manifest.tables)))
+	for _, table := range manifest.tables {
+		buffer = binary.AppendUvarint(buffer, table.id)
+		buffer = append(buffer, table.level)
+	}
+	return binary.BigEndian.AppendUint32(buffer, crc32.Checksum(buffer, castagnoliTable))
+}
+
+func decodeManifest(buffer []byte) (manifest, error) {
+	if len(buffer) < 28 {
+		return manifest{}, CorruptManifestErr
+	}
+	contents := buffer[:len(buffer)-4]
+	if crc32.Checksum(contents, castagnoliTable) != binary.BigEndian.Uint32(buffer[len(contents):]) {
+		return manifest{}, CorruptManifestErr
+	}
+	decoded := manifest{
+		flushedTill:   binary.BigEndian.Uint64(contents),
+		nextFileId:    binary.BigEndian.Uint64(contents[8:]),
+		discardedTill: binary.BigEndian.Uint64(contents[16:]),
+	}
+	offset := 24
+	numberOfTables, read := binary.Uvarint(contents[offset:])
+	if read <= 0 {
+		return manifest{}, CorruptManifestErr
+	}
+	offset = offset + read
+	for count := uint64(0); count < numberOfTables; count++ {
+		id, read := binary.Uvarint(contents[offset:])
+		if read <= 0 || offset+read >= len(contents) {
+			return manifest{}, CorruptManifestErr
+		}
+		offset = offset + read
+		decoded.tables = append(decoded.tables, tableInfo{id: id, level: contents[offset]})
+		offset++
+	}
+	if offset != len(contents) {
+		return manifest{}, CorruptManifestErr
+	}
+	return decoded, nil
+}
+
+func readManifest(directory string) (manifest, error) {
+	buffer, err := os.ReadFile(filepath.Join(directory, manifestFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return newManifest(), nil
+		}
+		return manifest{}, err
+	}
+	return decodeManifest(buffer)
+}
+
+func writeManifest(directory string, manifest manifest) error {
+	temporaryPath := filepath.Join(directory, temporaryManifestFileName)
+	file, err := os.OpenFile(temporaryPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(manifest.encode()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temporaryPath, filepath.Join(directory, manifestFileName)); err != nil {
+		return err
+	}
+	return syncDirectory(directory)
+}
+
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
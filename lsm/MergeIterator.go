@@ -0,0 +1,61 @@
+package lsm
+
+import "IsoTransact/mvcc"
+
+// MergeIterator merges sorted iterators into a single sorted iterator.
+// A versioned key is expected to be present in at most one of the iterators, as every commit timestamp writes a key once.
+type MergeIterator struct {
+	iterators []mvcc.Iterator
+	valid     []bool
+	current   int
+	started   bool
+	reverse   bool
+}
+
+func NewMergeIterator(iterators []mvcc.Iterator) *MergeIterator {
+	return &MergeIterator{iterators: iterators, valid: make([]bool, len(iterators)), current: -1}
+}
+
+// NewReverseMergeIterator merges iterators sorted in the decreasing order into a single one in the decreasing order.
+func NewReverseMergeIterator(iterators []mvcc.Iterator) *MergeIterator {
+	iterator := NewMergeIterator(iterators)
+	iterator.reverse = true
+	return iterator
+}
+
+func (iterator *MergeIterator) Next() bool {
+	if !iterator.started {
+		for index, source := range iterator.iterators {
+			iterator.valid[index] = source.Next()
+		}
+		iterator.started = true
+	} else if iterator.current >= 0 {
+		iterator.valid[iterator.current] = iterator.iterators[iterator.current].Next()
+	}
+
+	iterator.current = -1
+	for index, source := range iterator.iterators {
+		if !iterator.valid[index] {
+			continue
+		}
+		if iterator.current < 0 || iterator.precedes(source.Key(), iterator.iterators[iterator.current].Key()) {
+			iterator.current = index
+		}
+	}
+	return iterator.current >= 0
+}
+
+func (iterator *MergeIterator) precedes(key, other mvcc.VersionedKey) bool {
+	if iterator.reverse {
+		return key.Compare(other) > 0
+	}
+	return key.Compare(other) < 0
+}
+
+func (iterator *MergeIterator) Key() mvcc.VersionedKey {
+	return iterator.iterators[iterator.current].Key()
+}
+
+func (iterator *MergeIterator) Value() mvcc.Value {
+	return iterator.iterators[iterator.current].Value()
+}
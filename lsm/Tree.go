@@ -0,0 +1,459 @@
+package lsm
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/table"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const tableSuffix = ".sst"
+
+type Options struct {
+	//Directory holds the tables and the manifest, an empty Directory keeps the tree in memory and never freezes the memtable
+	Directory        string
+	SkipListMaxLevel uint8
+	//MemTableSize is the size in bytes after which the active memtable is frozen and queued for a flush
+	MemTableSize int64
+	BlockSize    int
+	Compaction   CompactionOptions
+	//MemoryLimit caps the bytes held by the active and the frozen memtables, 0 leaves them uncapped (see Tree.IsFull)
+	MemoryLimit int64
+}
+
+// Tree is the storage the TransactionExecutor applies the committed batches to.
+// Writes go to the active memtable. Once the active memtable grows beyond Options.MemTableSize, it is frozen
+// and a new memtable takes the writes, while a background flusher writes the frozen memtable out as a level 0 table.
+// A background compactor merges the tables down the levels (see Compaction.go).
+// Commit timestamps only increase, so the active memtable holds newer versions than the frozen ones,
+// which in turn hold newer versions than the tables, and a level holds newer versions than the levels below it;
+// reads consult them in that order.
+type Tree struct {
+	lock              sync.RWMutex
+	options           Options
+	active            *mvcc.MemTable
+	frozen            []*mvcc.MemTable  //oldest first
+	levels            [][]*table.Reader //level 0 newest first, the other levels in the increasing order of their keys
+	manifest          manifest
+	onFlush           func(flushedTill uint64)
+	discardWatermark  func() uint64
+	discardedTill     atomic.Uint64 //the highest discard watermark taken, see claimDiscardWatermark
+	compactionCursors []int
+	flushChannel      chan struct{}
+	compactionChannel chan struct{}
+	stopChannel       chan struct{}
+	workers           sync.WaitGroup
+	reclaimedVersions atomic.Uint64
+	reclaimedBytes    atomic.Uint64
+	memoryLimit       atomic.Int64
+}
+
+// NewInMemoryTree creates a tree that keeps everything in the given memtable.
+func NewInMemoryTree(memTable *mvcc.MemTable) *Tree {
+	return &Tree{
+		active:           memTable,
+		manifest:         newManifest(),
+		levels:           make([][]*table.Reader, 1),
+		discardWatermark: func() uint64 { return 0 },
+		stopChannel:      make(chan struct{}),
+	}
+}
+
+// Open opens the tables recorded in the manifest of options.Directory and starts the background flusher and compactor.
+// Tables left behind by a flush or a compaction that did not make it to the manifest are removed.
+func Open(options Options) (*Tree, error) {
+	if err := options.Compaction.validate(); err != nil {
+		return nil, err
+	}
+	manifest, err := readManifest(options.Directory)
+	if err != nil {
+		return nil, err
+	}
+	tree := &Tree{
+		options:           options,
+		active:            mvcc.NewMemTable(options.SkipListMaxLevel),
+		levels:            make([][]*table.Reader, options.Compaction.MaxLevels),
+		manifest:          manifest,
+		onFlush:           func(flushedTill uint64) {},
+		discardWatermark:  func() uint64 { return 0 },
+		compactionCursors: make([]int, options.Compaction.MaxLevels),
+		flushChannel:      make(chan struct{}, 1),
+		compactionChannel: make(chan struct{}, 1),
+		stopChannel:       make(chan struct{}),
+	}
+	tree.memoryLimit.Store(options.MemoryLimit)
+	tree.discardedTill.Store(manifest.discardedTill)
+	if err := tree.removeUnknownTables(); err != nil {
+		return nil, err
+	}
+	for _, tableInfo := range manifest.tables {
+		if int(tableInfo.level) >= options.Compaction.MaxLevels {
+			tree.closeTables()
+			return nil, fmt.Errorf("table %d is at level %d, beyond the %d levels of the tree", tableInfo.id, tableInfo.level, options.Compaction.MaxLevels)
+		}
+		reader, err := table.Open(tree.tablePath(tableInfo.id))
+		if err != nil {
+			tree.closeTables()
+			return nil, err
+		}
+		tree.levels[tableInfo.level] = append(tree.levels[tableInfo.level], reader)
+	}
+	tree.workers.Add(2)
+	go tree.spin()
+	go tree.spinCompactions()
+	return tree, nil
+}
+
+func (tree *Tree) removeUnknownTables() error {
+	knownTables := make(map[uint64]bool)
+	for _, tableInfo := range tree.manifest.tables {
+		knownTables[tableInfo.id] = true
+	}
+	entries, err := os.ReadDir(tree.options.Directory)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		id, ok := parseTableId(entry.Name())
+		if !ok || knownTables[id] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(tree.options.Directory, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tree *Tree) tablePath(id uint64) string {
+	return filepath.Join(tree.options.Directory, fmt.Sprintf("%06d%s", id, tableSuffix))
+}
+
+func parseTableId(fileName string) (uint64, bool) {
+	if !strings.HasSuffix(fileName, tableSuffix) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(fileName, tableSuffix), 10, 64)
+	return id, err == nil
+}
+
+func tableIdOf(reader *table.Reader) uint64 {
+	id, _ := parseTableId(filepath.Base(reader.FilePath()))
+	return id
+}
+
+// OnFlush registers the callback invoked after a frozen memtable is durably flushed to a table,
+// with the highest commit timestamp held by the tables.
+func (tree *Tree) OnFlush(callback func(flushedTill uint64)) {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+
+	tree.onFlush = callback
+}
+
+// SetDiscardWatermark registers the provider of the timestamp at or above which every current and future reader reads.
+// Compactions keep all the versions above the watermark and only the highest version at or below it, and so does the version GC.
+// The provider is called right before the versions are discarded, so it may refuse the readers below the watermark from then on.
+func (tree *Tree) SetDiscardWatermark(discardWatermark func() uint64) {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+
+	tree.discardWatermark = discardWatermark
+}
+
+// SetMemoryLimit caps the bytes held by the active and the frozen memtables, 0 leaves them uncapped.
+func (tree *Tree) SetMemoryLimit(bytes int64) {
+	tree.memoryLimit.Store(bytes)
+}
+
+// MemoryInUse returns the bytes held by the versions of the active and the frozen memtables, less the versions removed by the version GC.
+func (tree *Tree) MemoryInUse() int64 {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
+
+	memoryInUse := tree.active.LiveSize()
+	for _, memTable := range tree.frozen {
+		memoryInUse = memoryInUse + memTable.LiveSize()
+	}
+	return memoryInUse
+}
+
+// IsFull returns true if the memtables hold the memory limit or more. The writes are refused while the tree is full:
+// a durable tree makes room again as the frozen memtables are flushed, and any tree as the version GC removes the shadowed versions.
+// The batches queued before the tree got full are still applied, so the memtables can go beyond the limit by that much.
+func (tree *Tree) IsFull() bool {
+	memoryLimit := tree.memoryLimit.Load()
+	return memoryLimit > 0 && tree.MemoryInUse() >= memoryLimit
+}
+
+func (tree *Tree) PutOrUpdate(key mvcc.VersionedKey, value mvcc.Value) {
+	tree.lock.RLock()
+	active := tree.active
+	tree.lock.RUnlock()
+
+	active.PutOrUpdate(key, value)
+}
+
+// ApplyBatch puts all the entries at the version into the active memtable. It is called by the single writer,
+// which freezes the memtable in between the batches (see MaybeFreeze), so a batch is never split across memtables.
+func (tree *Tree) ApplyBatch(version uint64, entries []mvcc.Entry) {
+	tree.lock.RLock()
+	active := tree.active
+	tree.lock.RUnlock()
+
+	active.ApplyBatch(version, entries)
+}
+
+// MaybeFreeze freezes the active memtable if it has grown beyond Options.MemTableSize, and returns true if it did.
+// It is called by the single writer in between the batches, never in the middle of one.
+func (tree *Tree) MaybeFreeze() bool {
+	if tree.options.Directory == "" {
+		return false
+	}
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+
+	if tree.active.Size() < tree.options.MemTableSize {
+		return false
+	}
+	tree.frozen = append(tree.frozen, tree.active)
+	tree.active = mvcc.NewMemTable(tree.options.SkipListMaxLevel)
+
+	signal(tree.flushChannel)
+	return true
+}
+
+// Get returns the value of the highest version of the key that is less than or equal to the version of the given key,
+// or the error of reading a table.
+func (tree *Tree) Get(key mvcc.VersionedKey) (mvcc.Value, bool, error) {
+	active, frozen, tables := tree.acquireSourcesFor(key.GetKey())
+	defer releaseTables(tables)
+
+	if value, ok, _ := active.Get(key); ok {
+		return value, true, nil
+	}
+	for index := len(frozen) - 1; index >= 0; index-- {
+		if value, ok, _ := frozen[index].Get(key); ok {
+			return value, true, nil
+		}
+	}
+	for _, reader := range tables {
+		value, ok, err := reader.Get(key)
+		if err != nil || ok {
+			return value, ok, err
+		}
+	}
+	return mvcc.Value{}, false, nil
+}
+
+// acquireSourcesFor returns the memtables and, newest first, the tables that may hold the key.
+// The tables are referenced, so that a compaction that replaces them in the meantime does not close them underneath the reader.
+func (tree *Tree) acquireSourcesFor(key []byte) (*mvcc.MemTable, []*mvcc.MemTable, []*table.Reader) {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
+
+	var tables []*table.Reader
+	for _, reader := range tree.levels[0] {
+		if keyInRange(key, reader) {
+			tables = append(tables, reader)
+		}
+	}
+	for level := 1; level < len(tree.levels); level++ {
+		if reader, ok := tableContaining(tree.levels[level], key); ok {
+			tables = append(tables, reader)
+		}
+	}
+	for _, reader := range tables {
+		reader.IncrementReference()
+	}
+	return tree.active, tree.frozen, tables
+}
+
+func releaseTables(tables []*table.Reader) {
+	for _, reader := range tables {
+		_ = reader.DecrementReference()
+	}
+}
+
+func keyInRange(key []byte, reader *table.Reader) bool {
+	return bytes.Compare(key, reader.SmallestKey().GetKey()) >= 0 && bytes.Compare(key, reader.LargestKey().GetKey()) <= 0
+}
+
+// tableContaining finds the table of a level (other than 0) whose key range includes the key.
+func tableContaining(tables []*table.Reader, key []byte) (*table.Reader, bool) {
+	index := sort.Search(len(tables), func(index int) bool {
+		return bytes.Compare(tables[index].LargestKey().GetKey(), key) >= 0
+	})
+	if index < len(tables) && keyInRange(key, tables[index]) {
+		return tables[index], true
+	}
+	return nil, false
+}
+
+// DiscardedTill returns the highest discard watermark the versions may have been discarded below,
+// by the compactions and by the version GC of the flushed memtables; it is recorded in the manifest.
+func (tree *Tree) DiscardedTill() uint64 {
+	return tree.discardedTill.Load()
+}
+
+// claimDiscardWatermark returns the discard watermark for the versions about to be discarded, and remembers the highest one taken.
+func (tree *Tree) claimDiscardWatermark() uint64 {
+	tree.lock.RLock()
+	discardWatermark := tree.discardWatermark()
+	tree.lock.RUnlock()
+
+	for {
+		discardedTill := tree.discardedTill.Load()
+		if discardWatermark <= discardedTill || tree.discardedTill.CompareAndSwap(discardedTill, discardWatermark) {
+			return discardWatermark
+		}
+	}
+}
+
+// FlushedTill returns the highest commit timestamp that is flushed to the tables.
+func (tree *Tree) FlushedTill() uint64 {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
+
+	return tree.manifest.flushedTill
+}
+
+func (tree *Tree) NumberOfFrozenMemTables() int {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
+
+	return len(tree.frozen)
+}
+
+func (tree *Tree) NumberOfTables() int {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
+
+	numberOfTables := 0
+	for _, tables := range tree.levels {
+		numberOfTables = numberOfTables + len(tables)
+	}
+	return numberOfTables
+}
+
+func (tree *Tree) NumberOfTablesAt(level int) int {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
+
+	return len(tree.levels[level])
+}
+
+func (tree *Tree) spin() {
+	defer tree.workers.Done()
+	for {
+		select {
+		case <-tree.flushChannel:
+			//a failed flush leaves the memtable frozen (and readable); it is retried on the next freeze
+			for tree.NumberOfFrozenMemTables() > 0 {
+				if err := tree.flushOldestFrozenMemTable(); err != nil {
+					break
+				}
+				signal(tree.compactionChannel)
+			}
+		case <-tree.stopChannel:
+			return
+		}
+	}
+}
+
+func (tree *Tree) flushOldestFrozenMemTable() error {
+	tree.lock.Lock()
+	memTable := tree.frozen[0]
+	tableId := tree.nextTableId()
+	tree.lock.Unlock()
+
+	reader, err := tree.writeTable(tableId, memTable.NewIterator())
+	if err != nil {
+		return err
+	}
+
+	tree.lock.Lock()
+	updatedManifest := tree.manifest
+	updatedManifest.flushedTill = memTable.MaxVersion()
+	updatedManifest.discardedTill = tree.discardedTill.Load()
+	updatedManifest.tables = append([]tableInfo{{id: tableId, level: 0}}, tree.manifest.tables...)
+	if err := writeManifest(tree.options.Directory, updatedManifest); err != nil {
+		tree.lock.Unlock()
+		reader.MarkForDeletion()
+		_ = reader.Close()
+		return err
+	}
+	tree.manifest = updatedManifest
+	tree.levels[0] = append([]*table.Reader{reader}, tree.levels[0]...)
+	tree.frozen = tree.frozen[1:]
+	onFlush := tree.onFlush
+	tree.lock.Unlock()
+
+	onFlush(updatedManifest.flushedTill)
+	return nil
+}
+
+// nextTableId reserves the id of a new table, the caller holds the lock.
+func (tree *Tree) nextTableId() uint64 {
+	tableId := tree.manifest.nextFileId
+	tree.manifest.nextFileId++
+	return tableId
+}
+
+func (tree *Tree) writeTable(tableId uint64, iterator mvcc.Iterator) (*table.Reader, error) {
+	writer, err := table.NewWriter(tree.tablePath(tableId), tree.options.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	for iterator.Next() {
+		if err := writer.Add(iterator.Key(), iterator.Value()); err != nil {
+			writer.Abort()
+			return nil, err
+		}
+	}
+	if err := writer.Finish(); err != nil {
+		writer.Abort()
+		return nil, err
+	}
+	reader, err := table.Open(tree.tablePath(tableId))
+	if err != nil {
+		_ = os.Remove(tree.tablePath(tableId))
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Close stops the flusher, the compactor and the version GC, and releases the tables.
+// The memtables that are not flushed yet are still in the write-ahead log.
+func (tree *Tree) Close() {
+	close(tree.stopChannel)
+	tree.workers.Wait()
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+
+	tree.closeTables()
+}
+
+func (tree *Tree) closeTables() {
+	for level, tables := range tree.levels {
+		releaseTables(tables)
+		tree.levels[level] = nil
+	}
+}
+
+func signal(channel chan struct{}) {
+	select {
+	case channel <- struct{}{}:
+	default:
+	}
+}
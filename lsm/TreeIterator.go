@@ -0,0 +1,142 @@
+package lsm
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/table"
+	"bytes"
+	"fmt"
+)
+
+// TreeIterator walks all the versioned keys of the tree whose keys are in [start, end), in the increasing order of key and version,
+// or the versions at or below a version in the decreasing order for a reverse iterator.
+// The tables it reads are referenced until Close, so that a compaction that replaces them in the meantime does not close them underneath the iterator.
+type TreeIterator struct {
+	merge  *MergeIterator
+	end    []byte
+	tables []*table.Reader
+	done   bool
+	err    error
+}
+
+// NewIterator returns an iterator over the keys in [start, end); a nil start begins at the smallest key and a nil end stops after the largest one.
+func (tree *Tree) NewIterator(start, end []byte) *TreeIterator {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
+
+	iterators := []mvcc.Iterator{tree.active.NewIteratorFrom(start)}
+	for _, memTable := range tree.frozen {
+		iterators = append(iterators, memTable.NewIteratorFrom(start))
+	}
+	treeIterator := &TreeIterator{end: end}
+	for _, level := range tree.levels {
+		for _, reader := range level {
+			if overlaps(reader, start, end) {
+				reader.IncrementReference()
+				treeIterator.tables = append(treeIterator.tables, reader)
+				iterators = append(iterators, tableIterator{blockIterator: reader.NewIteratorFrom(start), reader: reader, err: &treeIterator.err})
+			}
+		}
+	}
+	treeIterator.merge = NewMergeIterator(iterators)
+	return treeIterator
+}
+
+// NewReverseIterator returns an iterator over the versions at or below the version of the keys in [start, end),
+// in the decreasing order of key and version; a nil start or end leaves that side unbounded.
+func (tree *Tree) NewReverseIterator(start, end []byte, version uint64) *TreeIterator {
+	tree.lock.RLock()
+	defer tree.lock.RUnlock()
+
+	iterators := []mvcc.Iterator{tree.active.NewReverseRangeIterator(start, end, version)}
+	for _, memTable := range tree.frozen {
+		iterators = append(iterators, memTable.NewReverseRangeIterator(start, end, version))
+	}
+	//the sources stop at the start themselves, the tree iterator has no end to check
+	treeIterator := &TreeIterator{}
+	for _, level := range tree.levels {
+		for _, reader := range level {
+			if overlaps(reader, start, end) {
+				reader.IncrementReference()
+				treeIterator.tables = append(treeIterator.tables, reader)
+				iterators = append(iterators, tableIterator{blockIterator: reader.NewReverseIterator(start, end, version), reader: reader, err: &treeIterator.err})
+			}
+		}
+	}
+	treeIterator.merge = NewReverseMergeIterator(iterators)
+	return treeIterator
+}
+
+// NewRangeIterator is NewIterator as an mvcc.RangeIterator, so that the tree is an mvcc.StorageEngine.
+func (tree *Tree) NewRangeIterator(start, end []byte) mvcc.RangeIterator {
+	return tree.NewIterator(start, end)
+}
+
+// NewReverseRangeIterator is NewReverseIterator as an mvcc.RangeIterator.
+func (tree *Tree) NewReverseRangeIterator(start, end []byte, version uint64) mvcc.RangeIterator {
+	return tree.NewReverseIterator(start, end, version)
+}
+
+func overlaps(reader *table.Reader, start, end []byte) bool {
+	if start != nil && bytes.Compare(reader.LargestKey().GetKey(), start) < 0 {
+		return false
+	}
+	if end != nil && bytes.Compare(reader.SmallestKey().GetKey(), end) >= 0 {
+		return false
+	}
+	return true
+}
+
+func (iterator *TreeIterator) Next() bool {
+	if iterator.done {
+		return false
+	}
+	if !iterator.merge.Next() || iterator.err != nil || (iterator.end != nil && bytes.Compare(iterator.merge.Key().GetKey(), iterator.end) >= 0) {
+		iterator.done = true
+		return false
+	}
+	return true
+}
+
+// Err returns the error of reading a table that stopped the iteration, if any.
+func (iterator *TreeIterator) Err() error {
+	return iterator.err
+}
+
+func (iterator *TreeIterator) Key() mvcc.VersionedKey {
+	return iterator.merge.Key()
+}
+
+func (iterator *TreeIterator) Value() mvcc.Value {
+	return iterator.merge.Value()
+}
+
+// Close releases the tables held by the iterator, it is safe to call more than once.
+func (iterator *TreeIterator) Close() {
+	iterator.done = true
+	releaseTables(iterator.tables)
+	iterator.tables = nil
+}
+
+// tableIterator hands the failure to read a block over to the TreeIterator, which stops at it:
+// ending the table quietly would hide the keys of its remaining blocks.
+type tableIterator struct {
+	blockIterator
+	reader *table.Reader
+	err    *error
+}
+
+// blockIterator is a table.Iterator or a table.ReverseIterator.
+type blockIterator interface {
+	mvcc.Iterator
+	Err() error
+}
+
+func (iterator tableIterator) Next() bool {
+	if iterator.blockIterator.Next() {
+		return true
+	}
+	if err := iterator.blockIterator.Err(); err != nil && *iterator.err == nil {
+		*iterator.err = fmt.Errorf("iterating table %s: %w", iterator.reader.FilePath(), err)
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package lsm
+
+import (
+	"IsoTransact/mvcc"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func optionsForTest(directory string) Options {
+	return Options{Directory: directory, SkipListMaxLevel: 10, MemTableSize: 256, BlockSize: 64, Compaction: DefaultCompactionOptions()}
+}
+
+func putKeysForTest(tree *Tree, fromVersion int, toVersion int) {
+	for version := fromVersion; version <= toVersion; version++ {
+		tree.PutOrUpdate(
+			*mvcc.NewVersionedKey([]byte("Key:"+strconv.Itoa(version%10)), uint64(version)),
+			mvcc.NewValue([]byte("Value:"+strconv.Itoa(version))),
+		)
+		tree.MaybeFreeze()
+	}
+}
+
+func waitForFlushes(t *testing.T, tree *Tree) {
+	assert.Eventually(t, func() bool {
+		return tree.NumberOfFrozenMemTables() == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestFreezesTheMemTableOnceItGrowsBeyondTheSize(t *testing.T) {
+	tree, err := Open(optionsForTest(t.TempDir()))
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	tree.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
+	assert.Equal(t, false, tree.MaybeFreeze())
+
+	putKeysForTest(tree, 2, 40)
+	waitForFlushes(t, tree)
+
+	assert.True(t, tree.NumberOfTables() > 0)
+	assert.True(t, tree.FlushedTill() > 0)
+}
+
+func TestGetsTheLatestVisibleVersionAcrossMemTablesAndTables(t *testing.T) {
+	tree, err := Open(optionsForTest(t.TempDir()))
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	putKeysForTest(tree, 1, 100)
+	waitForFlushes(t, tree)
+
+	for version := 1; version <= 100; version++ {
+		value, ok, _ := tree.Get(*mvcc.NewVersionedKey([]byte("Key:"+strconv.Itoa(version%10)), uint64(version)))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("Value:"+strconv.Itoa(version)), value.Slice())
+	}
+	value, ok, _ := tree.Get(*mvcc.NewVersionedKey([]byte("Key:5"), 94))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Value:85"), value.Slice())
+}
+
+func TestOpensTheFlushedTablesFromTheManifest(t *testing.T) {
+	directory := t.TempDir()
+	options := optionsForTest(directory)
+	//no compaction, so that the number of tables does not change in between counting and closing
+	options.Compaction.L0CompactionTrigger = 1000
+	tree, err := Open(options)
+	assert.Nil(t, err)
+
+	putKeysForTest(tree, 1, 100)
+	waitForFlushes(t, tree)
+	flushedTill, numberOfTables := tree.FlushedTill(), tree.NumberOfTables()
+	tree.Close()
+
+	tree, err = Open(options)
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	assert.Equal(t, flushedTill, tree.FlushedTill())
+	assert.Equal(t, numberOfTables, tree.NumberOfTables())
+
+	value, ok, _ := tree.Get(*mvcc.NewVersionedKey([]byte("Key:3"), flushedTill))
+	assert.Equal(t, true, ok)
+	assert.NotNil(t, value.Slice())
+}
+
+func TestRecordsTheDiscardWatermarkInTheManifest(t *testing.T) {
+	options := optionsForTest(t.TempDir())
+	tree, err := Open(options)
+	assert.Nil(t, err)
+	tree.SetDiscardWatermark(func() uint64 { return 7 })
+
+	putKeysForTest(tree, 1, 10)
+	tree.CollectVersions()
+	putKeysForTest(tree, 11, 40)
+	waitForFlushes(t, tree)
+	assert.Equal(t, uint64(7), tree.DiscardedTill())
+	tree.Close()
+
+	tree, err = Open(options)
+	assert.Nil(t, err)
+	defer tree.Close()
+	assert.Equal(t, uint64(7), tree.DiscardedTill())
+}
+
+func TestDoesNotFreezeAnInMemoryTree(t *testing.T) {
+	tree := NewInMemoryTree(mvcc.NewMemTable(10))
+	for version := 1; version <= 100; version++ {
+		tree.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), uint64(version)), mvcc.NewValue([]byte("Hard disk")))
+		assert.Equal(t, false, tree.MaybeFreeze())
+	}
+}
+
+func TestIteratesOverARangeOfKeysAcrossMemTablesAndTables(t *testing.T) {
+	tree, err := Open(optionsForTest(t.TempDir()))
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	putKeysForTest(tree, 1, 100)
+	waitForFlushes(t, tree)
+	putKeysForTest(tree, 101, 105)
+
+	iterator := tree.NewIterator([]byte("Key:3"), []byte("Key:5"))
+	defer iterator.Close()
+
+	var keys []mvcc.VersionedKey
+	for iterator.Next() {
+		keys = append(keys, iterator.Key())
+	}
+	assert.Equal(t, 22, len(keys))
+	for index := 1; index < len(keys); index++ {
+		assert.Equal(t, -1, keys[index-1].Compare(keys[index]))
+	}
+	assert.Equal(t, *mvcc.NewVersionedKey([]byte("Key:3"), 3), keys[0])
+	assert.Equal(t, *mvcc.NewVersionedKey([]byte("Key:4"), 104), keys[len(keys)-1])
+}
+
+func TestIsFullOnceTheMemTablesHoldTheMemoryLimit(t *testing.T) {
+	tree := NewInMemoryTree(mvcc.NewMemTable(10))
+	defer tree.Close()
+	assert.Equal(t, false, tree.IsFull())
+
+	putKeysForTest(tree, 1, 5)
+	tree.SetMemoryLimit(tree.MemoryInUse() + 1)
+	assert.Equal(t, false, tree.IsFull())
+
+	putKeysForTest(tree, 6, 6)
+	assert.Equal(t, true, tree.IsFull())
+}
+
+func TestMakesRoomOnceTheFrozenMemTablesAreFlushed(t *testing.T) {
+	options := optionsForTest(t.TempDir())
+	options.MemoryLimit = 1024
+	tree, err := Open(options)
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	putKeysForTest(tree, 1, 40)
+	waitForFlushes(t, tree)
+	assert.Equal(t, false, tree.IsFull())
+	assert.True(t, tree.MemoryInUse() < options.MemoryLimit)
+}
@@ -0,0 +1,53 @@
+package lsm
+
+import (
+	"IsoTransact/mvcc"
+	"time"
+)
+
+// VersionGCStats counts what the version GC reclaimed from the memtables since the tree was opened.
+type VersionGCStats struct {
+	ReclaimedVersions uint64
+	ReclaimedBytes    uint64
+}
+
+// StartVersionGC starts a background worker that, every interval, removes from the memtables the versions
+// that no reader can observe anymore (see CollectVersions). It is stopped by Close.
+func (tree *Tree) StartVersionGC(interval time.Duration) {
+	tree.workers.Add(1)
+	go tree.spinVersionGC(interval)
+}
+
+func (tree *Tree) spinVersionGC(interval time.Duration) {
+	defer tree.workers.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tree.CollectVersions()
+		case <-tree.stopChannel:
+			return
+		}
+	}
+}
+
+// CollectVersions removes, from the active and the frozen memtables, the versions of every key that are shadowed
+// by a newer version at or below the discard watermark. The tables are left to the compactions.
+func (tree *Tree) CollectVersions() {
+	tree.lock.RLock()
+	memTables := append([]*mvcc.MemTable{tree.active}, tree.frozen...)
+	tree.lock.RUnlock()
+	discardWatermark := tree.claimDiscardWatermark()
+
+	for _, memTable := range memTables {
+		versions, bytes := memTable.DiscardVersionsBelow(discardWatermark)
+		tree.reclaimedVersions.Add(uint64(versions))
+		tree.reclaimedBytes.Add(uint64(bytes))
+	}
+}
+
+func (tree *Tree) VersionGCStats() VersionGCStats {
+	return VersionGCStats{ReclaimedVersions: tree.reclaimedVersions.Load(), ReclaimedBytes: tree.reclaimedBytes.Load()}
+}
@@ -0,0 +1,212 @@
+package mvcc
+
+import (
+	"sync/atomic"
+)
+
+type concurrentNode struct {
+	key       VersionedKey
+	value     Value
+	collapsed atomic.Pointer[Value] //the value of a merge operand collapsed by the version GC with the versions below it
+	tower     []atomic.Pointer[concurrentNode]
+	marker    bool //a marker takes the slot of a node being removed, its single slot holds the successor of the node
+}
+
+// loadValue returns the value of the node, the collapsed one once the version GC collapsed a merge operand.
+func (node *concurrentNode) loadValue() Value {
+	if collapsed := node.collapsed.Load(); collapsed != nil {
+		return *collapsed
+	}
+	return node.value
+}
+
+// next returns the node after this one at the level, looking through the marker of a node being removed.
+func (node *concurrentNode) next(level int) *concurrentNode {
+	next := node.tower[level].Load()
+	if isMarker(next) {
+		return next.tower[0].Load()
+	}
+	return next
+}
+
+func newMarker(successor *concurrentNode) *concurrentNode {
+	marker := &concurrentNode{tower: make([]atomic.Pointer[concurrentNode], 1), marker: true}
+	marker.tower[0].Store(successor)
+	return marker
+}
+
+func isMarker(node *concurrentNode) bool {
+	return node != nil && node.marker
+}
+
+// ConcurrentSkipList is a skiplist that never locks: every link is an atomic pointer.
+// Inserts link a new node bottom-up with a compare-and-swap per level, retrying a level if another insert got there first.
+// A node is visible to the readers once it is linked at level 0.
+// The removals of the version GC first mark a node, swapping its slot at every level for a marker that points to its successor,
+// so that no insert can link a node right after it, and then unlink it from the nodes preceding it.
+// Inserts and removals unlink the marked nodes they come across on the way, readers look through the markers.
+type ConcurrentSkipList struct {
+	head  *concurrentNode
+	arena *nodeArena
+}
+
+func NewConcurrentSkipList(maxLevel uint8) *ConcurrentSkipList {
+	return &ConcurrentSkipList{
+		head:  &concurrentNode{tower: make([]atomic.Pointer[concurrentNode], maxLevel)},
+		arena: newNodeArena(maxLevel),
+	}
+}
+
+// putOrUpdate inserts the key, and returns false if the key already exists.
+func (skipList *ConcurrentSkipList) putOrUpdate(keyToInsert VersionedKey, value Value) bool {
+	precedingNodes, succeedingNodes := skipList.findSplices(keyToInsert)
+	if succeedingNodes[0] != nil && succeedingNodes[0].key.Compare(keyToInsert) == 0 {
+		return false
+	}
+
+	newNode := skipList.arena.allocate(keyToInsert, value)
+	for level := 0; level < len(newNode.tower); level++ {
+		for {
+			//a removal marks the levels of the new node not linked yet as well, the node is then left out of them
+			slot := newNode.tower[level].Load()
+			if isMarker(slot) || !newNode.tower[level].CompareAndSwap(slot, succeedingNodes[level]) {
+				return true
+			}
+			if precedingNodes[level].tower[level].CompareAndSwap(succeedingNodes[level], newNode) {
+				break
+			}
+			//a concurrent insert linked a node in between, or the preceding node is being removed, find the splice again
+			precedingNodes, succeedingNodes = skipList.findSplices(keyToInsert)
+			if level == 0 && succeedingNodes[0] != nil && succeedingNodes[0].key.Compare(keyToInsert) == 0 {
+				return false
+			}
+		}
+		//a removal that marked the new node before it was linked at the level did not find it there, unlink it on its behalf
+		if isMarker(newNode.tower[level].Load()) {
+			skipList.findSplices(keyToInsert)
+			return true
+		}
+	}
+	return true
+}
+
+// findSplices returns the nodes at every level between which the key belongs, unlinking the marked nodes on the way.
+func (skipList *ConcurrentSkipList) findSplices(key VersionedKey) ([]*concurrentNode, []*concurrentNode) {
+	maxLevel := len(skipList.head.tower)
+	precedingNodes, succeedingNodes := make([]*concurrentNode, maxLevel), make([]*concurrentNode, maxLevel)
+	for !skipList.searchSplices(key, precedingNodes, succeedingNodes) {
+		//a preceding node got marked, search again from the head
+	}
+	return precedingNodes, succeedingNodes
+}
+
+// searchSplices fills the splices from the head down, and returns false if a preceding node got marked during the search.
+func (skipList *ConcurrentSkipList) searchSplices(key VersionedKey, precedingNodes, succeedingNodes []*concurrentNode) bool {
+	preceding := skipList.head
+	for level := len(skipList.head.tower) - 1; level >= 0; level-- {
+		var ok bool
+		if precedingNodes[level], succeedingNodes[level], ok = findSplice(preceding, key, level); !ok {
+			return false
+		}
+		preceding = precedingNodes[level]
+	}
+	return true
+}
+
+// findSplice returns the nodes at the level between which the key belongs, starting the search at the given node,
+// and unlinks the marked nodes it passes. It returns false if the preceding node turns out to be marked itself.
+func findSplice(from *concurrentNode, key VersionedKey, level int) (*concurrentNode, *concurrentNode, bool) {
+	preceding := from
+	for {
+		next := preceding.tower[level].Load()
+		if isMarker(next) {
+			return nil, nil, false
+		}
+		if next == nil {
+			return preceding, nil, true
+		}
+		if successor := next.tower[level].Load(); isMarker(successor) {
+			preceding.tower[level].CompareAndSwap(next, successor.tower[0].Load())
+			continue
+		}
+		if next.key.Compare(key) >= 0 {
+			return preceding, next, true
+		}
+		preceding = next
+	}
+}
+
+func (skipList *ConcurrentSkipList) get(key VersionedKey) (Value, bool) {
+	node, ok := skipList.matchingNode(key)
+	if ok {
+		return node.loadValue(), true
+	}
+	return emptyValue(), false
+}
+
+// matchingNode returns the node with the key of keyToMatch and the highest version that is less than or equal to the version of keyToMatch.
+func (skipList *ConcurrentSkipList) matchingNode(keyToMatch VersionedKey) (*concurrentNode, bool) {
+	current := skipList.head
+	for level := len(skipList.head.tower) - 1; level >= 0; level-- {
+		for next := current.next(level); next != nil && next.key.Compare(keyToMatch) <= 0; next = current.next(level) {
+			current = next
+		}
+	}
+	if current != skipList.head && current.key.matchesKeyPrefix(keyToMatch.GetKey()) {
+		return current, true
+	}
+	return nil, false
+}
+
+// precedingNode returns the last node with a key less than the given key, which is the head if there is none.
+func (skipList *ConcurrentSkipList) precedingNode(key VersionedKey) *concurrentNode {
+	current := skipList.head
+	for level := len(skipList.head.tower) - 1; level >= 0; level-- {
+		for next := current.next(level); next != nil && next.key.Compare(key) < 0; next = current.next(level) {
+			current = next
+		}
+	}
+	return current
+}
+
+// remove marks the node with the key at every level, top-down, and unlinks it; it returns the node if this removal marked it at level 0.
+// The successors of the removed node stay reachable through its markers, so that a reader standing on it can still move on.
+func (skipList *ConcurrentSkipList) remove(keyToRemove VersionedKey) (*concurrentNode, bool) {
+	_, succeedingNodes := skipList.findSplices(keyToRemove)
+	target := succeedingNodes[0]
+	if target == nil || target.key.Compare(keyToRemove) != 0 {
+		return nil, false
+	}
+	for level := len(target.tower) - 1; level >= 0; level-- {
+		for {
+			successor := target.tower[level].Load()
+			if isMarker(successor) {
+				if level == 0 {
+					//another removal got there first
+					return nil, false
+				}
+				break
+			}
+			if target.tower[level].CompareAndSwap(successor, newMarker(successor)) {
+				break
+			}
+		}
+	}
+	skipList.findSplices(keyToRemove)
+	return target, true
+}
+
+func (skipList *ConcurrentSkipList) first() *concurrentNode {
+	return skipList.head.next(0)
+}
+
+// last returns the last node, which is the head if there is none.
+func (skipList *ConcurrentSkipList) last() *concurrentNode {
+	current := skipList.head
+	for level := len(skipList.head.tower) - 1; level >= 0; level-- {
+		for next := current.next(level); next != nil; next = current.next(level) {
+			current = next
+		}
+	}
+	return current
+}
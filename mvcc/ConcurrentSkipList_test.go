@@ -0,0 +1,229 @@
+package mvcc
+
+import (
+	"IsoTransact/mvcc/utils"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPutsAKeyValueAndGetByKeyInConcurrentSkipList(t *testing.T) {
+	skipList := NewConcurrentSkipList(8)
+	skipList.putOrUpdate(*NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	skipList.putOrUpdate(*NewVersionedKey([]byte("HDD"), 2), NewValue([]byte("Hard disk drive")))
+
+	value, ok := skipList.get(*NewVersionedKey([]byte("HDD"), 1))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	value, ok = skipList.get(*NewVersionedKey([]byte("HDD"), 5))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+
+	_, ok = skipList.get(*NewVersionedKey([]byte("SSD"), 5))
+	assert.Equal(t, false, ok)
+}
+
+func TestDoesNotInsertAnExistingVersionedKeyInConcurrentSkipList(t *testing.T) {
+	skipList := NewConcurrentSkipList(8)
+
+	assert.True(t, skipList.putOrUpdate(*NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk"))))
+	assert.False(t, skipList.putOrUpdate(*NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk drive"))))
+
+	value, _ := skipList.get(*NewVersionedKey([]byte("HDD"), 1))
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+}
+
+func TestInsertsConcurrentlyInConcurrentSkipListAndKeepsTheKeysOrdered(t *testing.T) {
+	const goroutines, keysPerGoroutine = 16, 500
+	skipList := NewConcurrentSkipList(12)
+
+	var wg sync.WaitGroup
+	for goroutine := 0; goroutine < goroutines; goroutine++ {
+		wg.Add(1)
+		go func(goroutine int) {
+			defer wg.Done()
+			for count := 0; count < keysPerGoroutine; count++ {
+				key := []byte(fmt.Sprintf("Key:%05d", count*goroutines+goroutine))
+				skipList.putOrUpdate(*NewVersionedKey(key, 1), NewValue(key))
+			}
+		}(goroutine)
+	}
+	wg.Wait()
+
+	for count := 0; count < goroutines*keysPerGoroutine; count++ {
+		key := []byte(fmt.Sprintf("Key:%05d", count))
+		value, ok := skipList.get(*NewVersionedKey(key, 1))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, key, value.Slice())
+	}
+
+	visited := 0
+	for previous, current := skipList.head, skipList.first(); current != nil; previous, current = current, current.next(0) {
+		if previous != skipList.head {
+			assert.Equal(t, -1, previous.key.Compare(current.key))
+		}
+		visited++
+	}
+	assert.Equal(t, goroutines*keysPerGoroutine, visited)
+}
+
+func TestRemovesAKeyWhileInsertingConcurrentlyInConcurrentSkipList(t *testing.T) {
+	skipList := NewConcurrentSkipList(8)
+	for count := 0; count < 100; count++ {
+		skipList.putOrUpdate(*NewVersionedKey([]byte(fmt.Sprintf("Key:%03d", count)), 1), NewValue([]byte("value")))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for count := 0; count < 100; count = count + 2 {
+			skipList.remove(*NewVersionedKey([]byte(fmt.Sprintf("Key:%03d", count)), 1))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for count := 0; count < 100; count++ {
+			skipList.putOrUpdate(*NewVersionedKey([]byte(fmt.Sprintf("Key:%03d", count)), 2), NewValue([]byte("value")))
+		}
+	}()
+	wg.Wait()
+
+	for count := 0; count < 100; count++ {
+		key := []byte(fmt.Sprintf("Key:%03d", count))
+		_, ok := skipList.matchingNode(*NewVersionedKey(key, 1))
+		assert.Equal(t, count%2 == 1, ok)
+		_, ok = skipList.matchingNode(*NewVersionedKey(key, 2))
+		assert.Equal(t, true, ok)
+	}
+}
+
+func TestRemovesAdjacentKeysConcurrentlyWhileInsertingAndReadingInConcurrentSkipList(t *testing.T) {
+	const removers, keys = 4, 2000
+	skipList := NewConcurrentSkipList(12)
+	for count := 0; count < keys; count++ {
+		skipList.putOrUpdate(*NewVersionedKey([]byte(fmt.Sprintf("Key:%05d", count)), 1), NewValue([]byte("value")))
+	}
+
+	var removed atomic.Int64
+	var wg sync.WaitGroup
+	for remover := 0; remover < removers; remover++ {
+		wg.Add(1)
+		go func(remover int) {
+			defer wg.Done()
+			//every remover goes for all the keys, so that the removers race for the same and for the adjacent nodes
+			for count := remover; count < keys+remover; count++ {
+				if _, ok := skipList.remove(*NewVersionedKey([]byte(fmt.Sprintf("Key:%05d", count%keys)), 1)); ok {
+					removed.Add(1)
+				}
+			}
+		}(remover)
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for count := 0; count < keys; count++ {
+			skipList.putOrUpdate(*NewVersionedKey([]byte(fmt.Sprintf("Key:%05d", count)), 2), NewValue([]byte("value")))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for attempt := 0; attempt < 20; attempt++ {
+			for previous, current := skipList.head, skipList.first(); current != nil; previous, current = current, current.next(0) {
+				if previous != skipList.head {
+					assert.Equal(t, -1, previous.key.Compare(current.key))
+				}
+			}
+		}
+	}()
+	wg.Wait()
+
+	assert.Equal(t, int64(keys), removed.Load())
+	visited := 0
+	for current := skipList.first(); current != nil; current = current.next(0) {
+		assert.Equal(t, uint64(2), current.key.GetVersion())
+		visited++
+	}
+	assert.Equal(t, keys, visited)
+	for level := range skipList.head.tower {
+		for current := skipList.head.next(level); current != nil; current = current.next(level) {
+			assert.Equal(t, uint64(2), current.key.GetVersion())
+		}
+	}
+}
+
+// lockedSkipList guards a SkipListNode with a RWMutex, the way the memtable did before the ConcurrentSkipList.
+type lockedSkipList struct {
+	lock           sync.RWMutex
+	head           *SkipListNode
+	levelGenerator utils.LevelGenerator
+}
+
+func (skipList *lockedSkipList) putOrUpdate(key VersionedKey, value Value) {
+	skipList.lock.Lock()
+	defer skipList.lock.Unlock()
+	skipList.head.putOrUpdate(key, value, skipList.levelGenerator)
+}
+
+func (skipList *lockedSkipList) get(key VersionedKey) (Value, bool) {
+	skipList.lock.RLock()
+	defer skipList.lock.RUnlock()
+	return skipList.head.get(key)
+}
+
+const benchmarkKeys = 10_000
+
+// benchmarkMixedLoad runs the readers on the given number of goroutines alongside a single writer, like the executor,
+// which writes one key for every 8 reads.
+func benchmarkMixedLoad(b *testing.B, goroutines int, putOrUpdate func(VersionedKey, Value), get func(VersionedKey) (Value, bool)) {
+	for count := 0; count < benchmarkKeys; count++ {
+		putOrUpdate(*NewVersionedKey([]byte(fmt.Sprintf("Key:%05d", count)), 1), NewValue([]byte("value")))
+	}
+	var version atomic.Uint64
+	version.Store(1)
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	operationsPerGoroutine := b.N/goroutines + 1
+	for goroutine := 0; goroutine < goroutines; goroutine++ {
+		wg.Add(1)
+		go func(goroutine int) {
+			defer wg.Done()
+			for count := 0; count < operationsPerGoroutine; count++ {
+				key := []byte(fmt.Sprintf("Key:%05d", (count*goroutines+goroutine)%benchmarkKeys))
+				if goroutine == 0 && count%8 == 0 {
+					putOrUpdate(*NewVersionedKey(key, version.Add(1)), NewValue([]byte("value")))
+				} else {
+					get(*NewVersionedKey(key, version.Load()))
+				}
+			}
+		}(goroutine)
+	}
+	wg.Wait()
+}
+
+func BenchmarkSkipListNodeUnderMixedLoad(b *testing.B) {
+	for _, goroutines := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("goroutines=%d", goroutines), func(b *testing.B) {
+			skipList := &lockedSkipList{
+				head:           NewSkipListNode(emptyVersionedKey(), emptyValue(), 12),
+				levelGenerator: *utils.NewLevelGenerator(12),
+			}
+			benchmarkMixedLoad(b, goroutines, skipList.putOrUpdate, skipList.get)
+		})
+	}
+}
+
+func BenchmarkConcurrentSkipListUnderMixedLoad(b *testing.B) {
+	for _, goroutines := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("goroutines=%d", goroutines), func(b *testing.B) {
+			skipList := NewConcurrentSkipList(12)
+			benchmarkMixedLoad(b, goroutines, func(key VersionedKey, value Value) {
+				skipList.putOrUpdate(key, value)
+			}, skipList.get)
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package mvcc
+
+// Iterator walks versioned keys in the increasing order of key and version.
+type Iterator interface {
+	Next() bool
+	Key() VersionedKey
+	Value() Value
+}
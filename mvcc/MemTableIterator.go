@@ -0,0 +1,37 @@
+package mvcc
+
+import "bytes"
+
+// MemTableIterator walks all the versioned keys of a memtable in the increasing order of key and version.
+// It sees the keys inserted ahead of it while it walks.
+// An iterator returned by NewRangeIterator stops before the end of its range.
+type MemTableIterator struct {
+	current *concurrentNode
+	end     []byte
+}
+
+func (iterator *MemTableIterator) Next() bool {
+	next := iterator.current.next(0)
+	if next == nil || (iterator.end != nil && bytes.Compare(next.key.GetKey(), iterator.end) >= 0) {
+		return false
+	}
+	iterator.current = next
+	return true
+}
+
+func (iterator *MemTableIterator) Key() VersionedKey {
+	return iterator.current.key
+}
+
+func (iterator *MemTableIterator) Value() Value {
+	return iterator.current.loadValue()
+}
+
+// Err is always nil, the memtable iterator reads from memory.
+func (iterator *MemTableIterator) Err() error {
+	return nil
+}
+
+// Close is a no-op, the memtable iterator holds no resources.
+func (iterator *MemTableIterator) Close() {
+}
@@ -0,0 +1,87 @@
+package mvcc
+
+import "bytes"
+
+// MemTableReverseIterator walks the versions at or below its version of the keys of a memtable in [start, end),
+// in the decreasing order of key and version. The nodes link forward only, so every step back is a search
+// for the preceding node; a search for the highest version at or below the version of a key skips its newer versions.
+// The version GC may collapse a merge operand the iterator handed out and remove the versions below it, which the iterator
+// then steps past: leaving the key, it yields the collapsed version again, so that a reader folding the versions newest first
+// stops at its value (see DiscardVersionsBelow).
+type MemTableReverseIterator struct {
+	skipList *ConcurrentSkipList
+	current  *concurrentNode
+	operands []*concurrentNode //the nodes of the current key whose merge operand was handed out, newest first
+	start    []byte
+	end      []byte
+	version  uint64
+	started  bool
+	done     bool
+}
+
+func (iterator *MemTableReverseIterator) Next() bool {
+	if iterator.done {
+		return false
+	}
+	head := iterator.skipList.head
+	var candidate *concurrentNode
+	switch {
+	case iterator.started:
+		candidate = iterator.skipList.precedingNode(iterator.current.key)
+		if candidate == head || !bytes.Equal(candidate.key.GetKey(), iterator.current.key.GetKey()) {
+			if collapsed := iterator.collapsedOperand(); collapsed != nil {
+				iterator.current = collapsed
+				return true
+			}
+		}
+	case iterator.end == nil:
+		candidate = iterator.skipList.last()
+	default:
+		candidate = iterator.skipList.precedingNode(*NewVersionedKey(iterator.end, 0))
+	}
+	iterator.started = true
+
+	for candidate != head && candidate.key.GetVersion() > iterator.version {
+		candidate = iterator.skipList.precedingNode(*NewVersionedKey(candidate.key.GetKey(), iterator.version+1))
+	}
+	if candidate == head || (iterator.start != nil && bytes.Compare(candidate.key.GetKey(), iterator.start) < 0) {
+		iterator.done = true
+		return false
+	}
+	iterator.current = candidate
+	return true
+}
+
+func (iterator *MemTableReverseIterator) Key() VersionedKey {
+	return iterator.current.key
+}
+
+func (iterator *MemTableReverseIterator) Value() Value {
+	value := iterator.current.loadValue()
+	if value.IsMergeOperand() && (len(iterator.operands) == 0 || iterator.operands[len(iterator.operands)-1] != iterator.current) {
+		iterator.operands = append(iterator.operands, iterator.current)
+	}
+	return value
+}
+
+// collapsedOperand returns the newest of the nodes whose merge operand was handed out that the version GC collapsed since,
+// and forgets the nodes of the key.
+func (iterator *MemTableReverseIterator) collapsedOperand() *concurrentNode {
+	operands := iterator.operands
+	iterator.operands = iterator.operands[:0]
+	for _, node := range operands {
+		if node.collapsed.Load() != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+// Err is always nil, the memtable iterator reads from memory.
+func (iterator *MemTableReverseIterator) Err() error {
+	return nil
+}
+
+// Close is a no-op, the memtable iterator holds no resources.
+func (iterator *MemTableReverseIterator) Close() {
+}
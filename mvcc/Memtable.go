@@ -1,34 +1,161 @@
 package mvcc
 
 import (
-	"IsoTransact/mvcc/utils"
-	"sync"
+	"sync/atomic"
 )
 
+// MemTable keeps the versioned keys in a ConcurrentSkipList: the readers do not lock, and do not block the writer.
+// The keys and the values are copied into the arena of the skiplist.
 type MemTable struct {
-	lock           sync.RWMutex
-	head           *SkipListNode
-	levelGenerator utils.LevelGenerator
+	skipList       *ConcurrentSkipList
+	maxVersion     atomic.Uint64
+	discardedBytes atomic.Int64 //the bytes of the arena held by the versions removed by DiscardVersionsBelow
 }
 
 func NewMemTable(maxLevel uint8) *MemTable {
-	return &MemTable{
-		lock:           *new(sync.RWMutex),
-		head:           NewSkipListNode(emptyVersionedKey(), emptyValue(), maxLevel),
-		levelGenerator: *utils.NewLevelGenerator(maxLevel),
-	}
+	return &MemTable{skipList: NewConcurrentSkipList(maxLevel)}
 }
 
 func (memTable *MemTable) PutOrUpdate(key VersionedKey, value Value) {
-	memTable.lock.Lock()
-	defer memTable.lock.Unlock()
+	if memTable.skipList.putOrUpdate(key, value) {
+		for {
+			maxVersion := memTable.maxVersion.Load()
+			if key.GetVersion() <= maxVersion || memTable.maxVersion.CompareAndSwap(maxVersion, key.GetVersion()) {
+				break
+			}
+		}
+	}
+}
+
+// Get returns the value of the highest version of the key that is less than or equal to the version of the given key.
+// A memtable is read from memory, the error is always nil.
+func (memTable *MemTable) Get(key VersionedKey) (Value, bool, error) {
+	value, ok := memTable.skipList.get(key)
+	return value, ok, nil
+}
+
+// Size returns the number of bytes allocated by the memtable from its arena, the nodes included.
+// The versions removed by DiscardVersionsBelow stay in the arena, so the size never goes down.
+func (memTable *MemTable) Size() int64 {
+	return memTable.skipList.arena.size()
+}
+
+// LiveSize returns the bytes of the arena held by the versions that are not removed by DiscardVersionsBelow.
+func (memTable *MemTable) LiveSize() int64 {
+	return memTable.Size() - memTable.discardedBytes.Load()
+}
+
+func (memTable *MemTable) MaxVersion() uint64 {
+	return memTable.maxVersion.Load()
+}
+
+func (memTable *MemTable) IsEmpty() bool {
+	return memTable.skipList.first() == nil
+}
+
+func (memTable *MemTable) NewIterator() *MemTableIterator {
+	return &MemTableIterator{current: memTable.skipList.head}
+}
 
-	memTable.head.putOrUpdate(key, value, memTable.levelGenerator)
+// NewIteratorFrom returns an iterator positioned before the first versioned key whose key is greater than or equal to the given key.
+func (memTable *MemTable) NewIteratorFrom(key []byte) *MemTableIterator {
+	return &MemTableIterator{current: memTable.skipList.precedingNode(*NewVersionedKey(key, 0))}
 }
 
-func (memTable *MemTable) Get(key VersionedKey) (Value, bool) {
-	memTable.lock.RLock()
-	defer memTable.lock.RUnlock()
+// NewRangeIterator returns an iterator over the versioned keys whose keys are in [start, end); a nil end leaves the range unbounded.
+func (memTable *MemTable) NewRangeIterator(start, end []byte) RangeIterator {
+	iterator := memTable.NewIteratorFrom(start)
+	iterator.end = end
+	return iterator
+}
 
-	return memTable.head.get(key)
+// NewReverseRangeIterator returns an iterator over the versions at or below the version of the keys in [start, end),
+// in the decreasing order of key and version; a nil start or end leaves that side unbounded.
+func (memTable *MemTable) NewReverseRangeIterator(start, end []byte, version uint64) RangeIterator {
+	return &MemTableReverseIterator{skipList: memTable.skipList, start: start, end: end, version: version}
+}
+
+// ApplyBatch puts all the entries at the version.
+func (memTable *MemTable) ApplyBatch(version uint64, entries []Entry) {
+	for _, entry := range entries {
+		memTable.PutOrUpdate(*NewVersionedKey(entry.GetKey(), version), entry.GetValue())
+	}
+}
+
+// Close is a no-op, the memory of the memtable is released along with it.
+func (memTable *MemTable) Close() {
+}
+
+// DiscardVersionsBelow removes the versions of a key that are shadowed by a newer version at or below the watermark:
+// every reader reads at or above the watermark, so the highest version at or below the watermark is the oldest
+// one that can be observed. A tombstone is kept, as it may shadow the versions of the key in the older memtables and tables.
+// It returns the number of versions removed and the bytes of the arena they held; the bytes are given back
+// only when the whole memtable is released, but the removed versions are not flushed to a table.
+func (memTable *MemTable) DiscardVersionsBelow(watermark uint64) (int, int64) {
+	//a version can only become shadowed by the inserts in the meantime, never the other way round
+	var shadowed []VersionedKey
+	var run []*concurrentNode //the versions at or below the watermark of the key being walked
+	for current := memTable.skipList.first(); ; current = current.next(0) {
+		if current == nil || len(run) > 0 && !current.key.matchesKeyPrefix(run[0].key.GetKey()) {
+			shadowed = append(shadowed, shadowedVersions(run)...)
+			run = run[:0]
+		}
+		if current == nil {
+			break
+		}
+		if current.key.GetVersion() <= watermark {
+			run = append(run, current)
+		}
+	}
+
+	bytes := int64(0)
+	removed := 0
+	for _, key := range shadowed {
+		if node, ok := memTable.skipList.remove(key); ok {
+			bytes = bytes + sizeOf(node)
+			removed++
+		}
+	}
+	memTable.discardedBytes.Add(bytes)
+	return removed, bytes
+}
+
+// shadowedVersions returns the versions of a key, given in the increasing order, that are shadowed by the highest one.
+// A highest version that is a merge operand shadows the versions below only once they are collapsed into it,
+// which is done if a regular value or a tombstone is among them. The collapsed value is stored before the versions below are removed:
+// a reader folding the versions oldest first then finds a regular value at the highest version, whether or not it read the versions
+// below before they were removed, and a reader folding them newest first gets the highest version again, collapsed,
+// once it steps past the removed versions (see MemTableReverseIterator).
+// A chain of operands without a value below is left to the compactions, the value is in the tables.
+// The memtables are flushed with the collapsed values.
+func shadowedVersions(run []*concurrentNode) []VersionedKey {
+	if len(run) < 2 {
+		return nil
+	}
+	highest := run[len(run)-1]
+	if highest.loadValue().IsMergeOperand() {
+		base := -1
+		for index := len(run) - 2; index >= 0 && base < 0; index-- {
+			if !run[index].loadValue().IsMergeOperand() {
+				base = index
+			}
+		}
+		if base < 0 {
+			return nil
+		}
+		collapsed := run[base].loadValue()
+		for _, node := range run[base+1:] {
+			var ok bool
+			//an operand of an operator that is not registered is kept as is, along with the versions below it
+			if collapsed, ok = MergeOnto(collapsed, node.loadValue()); !ok {
+				return nil
+			}
+		}
+		highest.collapsed.Store(&collapsed)
+	}
+	shadowed := make([]VersionedKey, 0, len(run)-1)
+	for _, node := range run[:len(run)-1] {
+		shadowed = append(shadowed, node.key)
+	}
+	return shadowed
 }
@@ -0,0 +1,127 @@
+package mvcc
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestDiscardsTheVersionsShadowedByANewerVersionAtOrBelowTheWatermark(t *testing.T) {
+	memTable := NewMemTable(10)
+	for version := 1; version <= 5; version++ {
+		memTable.PutOrUpdate(*NewVersionedKey([]byte("HDD"), uint64(version)), NewValue([]byte("Hard disk:"+strconv.Itoa(version))))
+		memTable.PutOrUpdate(*NewVersionedKey([]byte("SSD"), uint64(version)), NewValue([]byte("Solid state:"+strconv.Itoa(version))))
+	}
+	sizeBefore := memTable.Size()
+
+	versions, bytes := memTable.DiscardVersionsBelow(3)
+	assert.Equal(t, 4, versions)
+	assert.True(t, bytes > 0)
+	assert.Equal(t, sizeBefore, memTable.Size())
+	assert.Equal(t, sizeBefore-bytes, memTable.LiveSize())
+
+	value, ok, _ := memTable.Get(*NewVersionedKey([]byte("HDD"), 3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk:3"), value.Slice())
+
+	value, ok, _ = memTable.Get(*NewVersionedKey([]byte("SSD"), 4))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Solid state:4"), value.Slice())
+
+	_, ok, _ = memTable.Get(*NewVersionedKey([]byte("HDD"), 2))
+	assert.Equal(t, false, ok)
+}
+
+func TestKeepsATombstoneWhileDiscardingTheVersionsItShadows(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("HDD"), 2), NewTombstone())
+
+	versions, _ := memTable.DiscardVersionsBelow(10)
+	assert.Equal(t, 1, versions)
+
+	value, ok, _ := memTable.Get(*NewVersionedKey([]byte("HDD"), 10))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, value.IsTombstone())
+}
+
+func TestContinuesAnIteratorStandingOnADiscardedVersion(t *testing.T) {
+	memTable := NewMemTable(10)
+	for version := 1; version <= 3; version++ {
+		memTable.PutOrUpdate(*NewVersionedKey([]byte("HDD"), uint64(version)), NewValue([]byte("Hard disk")))
+	}
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("SSD"), 1), NewValue([]byte("Solid state")))
+
+	iterator := memTable.NewIterator()
+	assert.Equal(t, true, iterator.Next())
+	assert.Equal(t, uint64(1), iterator.Key().GetVersion())
+
+	memTable.DiscardVersionsBelow(3)
+
+	var keys []VersionedKey
+	for iterator.Next() {
+		keys = append(keys, iterator.Key())
+	}
+	assert.Equal(t, []VersionedKey{*NewVersionedKey([]byte("HDD"), 2), *NewVersionedKey([]byte("HDD"), 3), *NewVersionedKey([]byte("SSD"), 1)}, keys)
+}
+
+func TestCopiesTheKeyAndTheValueIntoTheMemTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	key, value := []byte("HDD"), []byte("Hard disk")
+	memTable.PutOrUpdate(*NewVersionedKey(key, 1), NewValue(value))
+
+	copy(key, "SSD")
+	copy(value, "Solid sta")
+
+	storedValue, ok, _ := memTable.Get(*NewVersionedKey([]byte("HDD"), 1))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), storedValue.Slice())
+	_, ok, _ = memTable.Get(*NewVersionedKey([]byte("SSD"), 1))
+	assert.Equal(t, false, ok)
+}
+
+func TestAccountsForEveryByteAllocatedFromTheArena(t *testing.T) {
+	memTable := NewMemTable(10)
+	assert.Equal(t, int64(0), memTable.Size())
+
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk drive")))
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("SSD"), 1), NewTombstone())
+
+	expectedSize := int64(0)
+	for node := memTable.skipList.first(); node != nil; node = node.next(0) {
+		expectedSize = expectedSize + nodeSize + towerSlotSize*int64(len(node.tower))
+	}
+	expectedSize = expectedSize + int64(len("HDD")+len("Hard disk")+len("SSD"))
+	assert.Equal(t, expectedSize, memTable.Size())
+}
+
+func TestCollapsesTheMergeOperandsOntoTheValueBelowThemWhileDiscardingIt(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("counter"), 1), NewValue(int64ForTest(10)))
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("counter"), 2), NewMergeOperand(SumOperator, int64ForTest(5)))
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("counter"), 3), NewMergeOperand(SumOperator, int64ForTest(1)))
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("counter"), 4), NewMergeOperand(SumOperator, int64ForTest(100)))
+
+	versions, _ := memTable.DiscardVersionsBelow(3)
+	assert.Equal(t, 2, versions)
+
+	value, ok, _ := memTable.Get(*NewVersionedKey([]byte("counter"), 3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, NewValue(int64ForTest(16)), value)
+
+	value, _, _ = memTable.Get(*NewVersionedKey([]byte("counter"), 4))
+	assert.Equal(t, NewMergeOperand(SumOperator, int64ForTest(100)), value)
+}
+
+func TestKeepsTheMergeOperandsWithoutAValueBelowThem(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("counter"), 1), NewMergeOperand(SumOperator, int64ForTest(5)))
+	memTable.PutOrUpdate(*NewVersionedKey([]byte("counter"), 2), NewMergeOperand(SumOperator, int64ForTest(1)))
+
+	versions, _ := memTable.DiscardVersionsBelow(10)
+	assert.Equal(t, 0, versions)
+
+	value, _, _ := memTable.Get(*NewVersionedKey([]byte("counter"), 1))
+	assert.Equal(t, NewMergeOperand(SumOperator, int64ForTest(5)), value)
+}
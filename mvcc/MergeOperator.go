@@ -0,0 +1,101 @@
+package mvcc
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+var UnknownMergeOperatorErr = errors.New("merge operand names no registered merge operator")
+
+// MergeOperator folds the merge operands of a key onto its value, see NewMergeOperand.
+// Merge gets nil for a key that does not exist. It has to be associative: merging two operands gives an operand
+// that stands for both of them, which lets the compaction and the version GC collapse a chain of operands
+// without the value below it.
+type MergeOperator interface {
+	Merge(value, operand []byte) []byte
+}
+
+// MergeOperatorFunc adapts a function to a MergeOperator.
+type MergeOperatorFunc func(value, operand []byte) []byte
+
+func (merge MergeOperatorFunc) Merge(value, operand []byte) []byte {
+	return merge(value, operand)
+}
+
+var mergeOperatorsLock sync.RWMutex
+var mergeOperators = make(map[string]MergeOperator)
+
+// RegisterMergeOperator makes the operator available under the name. The name is stored along with every operand,
+// so an operator has to be registered under the same name every time the database is opened.
+// It panics if the name is taken.
+func RegisterMergeOperator(name string, operator MergeOperator) {
+	mergeOperatorsLock.Lock()
+	defer mergeOperatorsLock.Unlock()
+
+	if _, ok := mergeOperators[name]; ok {
+		panic("mvcc: merge operator " + name + " is already registered")
+	}
+	mergeOperators[name] = operator
+}
+
+// LookupMergeOperator returns the operator registered under the name.
+func LookupMergeOperator(name string) (MergeOperator, bool) {
+	mergeOperatorsLock.RLock()
+	defer mergeOperatorsLock.RUnlock()
+
+	operator, ok := mergeOperators[name]
+	return operator, ok
+}
+
+// NewMergeOperand creates the operand of the operator registered under the name. Written as a version of a key,
+// it is read as the operand merged onto the version below it, without the writer reading that version.
+func NewMergeOperand(operatorName string, operand []byte) Value {
+	encoded := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(operatorName)+len(operand)), uint64(len(operatorName)))
+	encoded = append(append(encoded, operatorName...), operand...)
+	return Value{value: encoded, kind: MergeOperandValue}
+}
+
+// MergeOperand returns the name of the operator and the operand of a merge operand.
+func (value Value) MergeOperand() (string, []byte) {
+	length, read := binary.Uvarint(value.value)
+	if read <= 0 || uint64(len(value.value)-read) < length {
+		return "", nil
+	}
+	return string(value.value[read : read+int(length)]), value.value[read+int(length):]
+}
+
+// MergeOnto folds the newer version of a key onto the older one. A regular value or a tombstone shadows the older version,
+// an operand is merged onto a regular value or a tombstone into a regular value, and onto an operand of the same operator
+// into an operand that stands for both. It returns false for two operands of different operators, and for an operand
+// of an operator that is not registered.
+func MergeOnto(older, newer Value) (Value, bool) {
+	if !newer.IsMergeOperand() {
+		return newer, true
+	}
+	operatorName, operand := newer.MergeOperand()
+	operator, ok := LookupMergeOperator(operatorName)
+	if !ok {
+		return Value{}, false
+	}
+	switch older.kind {
+	case TombstoneValue:
+		return NewValue(operator.Merge(nil, operand)), true
+	case MergeOperandValue:
+		olderOperatorName, olderOperand := older.MergeOperand()
+		if olderOperatorName != operatorName {
+			return Value{}, false
+		}
+		return NewMergeOperand(operatorName, operator.Merge(olderOperand, operand)), true
+	}
+	return NewValue(operator.Merge(older.value, operand)), true
+}
+
+// ResolveMerge folds the newer version of a key onto the older one, which is a regular value or a tombstone,
+// the way a reader sees it. It returns UnknownMergeOperatorErr for an operand of an operator that is not registered.
+func ResolveMerge(older, newer Value) (Value, error) {
+	if merged, ok := MergeOnto(older, newer); ok {
+		return merged, nil
+	}
+	return Value{}, UnknownMergeOperatorErr
+}
@@ -0,0 +1,92 @@
+package mvcc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+var MalformedListErr = errors.New("list is malformed, it is not encoded by EncodeList")
+
+// The operators registered by the package.
+const (
+	//AppendOperator appends the elements of the operand to the list of the value, both encoded with EncodeList
+	AppendOperator = "append"
+	//SumOperator adds the operand to the value, both int64 encoded in 8 bytes big-endian; anything else is taken for 0
+	SumOperator = "sum"
+	//MaxOperator keeps the larger of the value and the operand, both int64 encoded in 8 bytes big-endian
+	MaxOperator = "max"
+	//SetUnionOperator keeps the union of the elements of the value and the operand, both encoded with EncodeList
+	SetUnionOperator = "set-union"
+)
+
+func init() {
+	RegisterMergeOperator(AppendOperator, MergeOperatorFunc(func(value, operand []byte) []byte {
+		return append(append(make([]byte, 0, len(value)+len(operand)), value...), operand...)
+	}))
+	RegisterMergeOperator(SumOperator, MergeOperatorFunc(func(value, operand []byte) []byte {
+		return encodeInt64(decodeInt64(value) + decodeInt64(operand))
+	}))
+	RegisterMergeOperator(MaxOperator, MergeOperatorFunc(func(value, operand []byte) []byte {
+		if len(value) == 8 && (len(operand) != 8 || decodeInt64(value) >= decodeInt64(operand)) {
+			return value
+		}
+		return operand
+	}))
+	RegisterMergeOperator(SetUnionOperator, MergeOperatorFunc(func(value, operand []byte) []byte {
+		//a malformed list contributes the elements before the malformed one
+		elements, _ := DecodeList(value)
+		operandElements, _ := DecodeList(operand)
+		elements = append(elements, operandElements...)
+		sort.Slice(elements, func(i, j int) bool {
+			return bytes.Compare(elements[i], elements[j]) < 0
+		})
+		unique := elements[:0]
+		for _, element := range elements {
+			if len(unique) == 0 || !bytes.Equal(unique[len(unique)-1], element) {
+				unique = append(unique, element)
+			}
+		}
+		return EncodeList(unique...)
+	}))
+}
+
+// EncodeList encodes the elements as a list, every element prefixed by its length. Two encoded lists concatenated
+// are the encoded list of the elements of both.
+func EncodeList(elements ...[]byte) []byte {
+	var encoded []byte
+	for _, element := range elements {
+		encoded = binary.AppendUvarint(encoded, uint64(len(element)))
+		encoded = append(encoded, element...)
+	}
+	return encoded
+}
+
+// DecodeList decodes a list encoded by EncodeList. It returns MalformedListErr along with the elements before the malformed one.
+func DecodeList(encoded []byte) ([][]byte, error) {
+	var elements [][]byte
+	for offset := 0; offset < len(encoded); {
+		length, read := binary.Uvarint(encoded[offset:])
+		if read <= 0 || uint64(len(encoded)-offset-read) < length {
+			return elements, MalformedListErr
+		}
+		offset = offset + read
+		elements = append(elements, encoded[offset:offset+int(length)])
+		offset = offset + int(length)
+	}
+	return elements, nil
+}
+
+func encodeInt64(value int64) []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, uint64(value))
+	return encoded
+}
+
+func decodeInt64(encoded []byte) int64 {
+	if len(encoded) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(encoded))
+}
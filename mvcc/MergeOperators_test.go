@@ -0,0 +1,91 @@
+package mvcc
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func int64ForTest(value int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(value))
+}
+
+func TestMergesAnOperandOntoARegularValueATombstoneAndAnOperandOfTheSameOperator(t *testing.T) {
+	merged, ok := MergeOnto(NewValue(int64ForTest(10)), NewMergeOperand(SumOperator, int64ForTest(5)))
+	assert.True(t, ok)
+	assert.Equal(t, NewValue(int64ForTest(15)), merged)
+
+	merged, ok = MergeOnto(NewTombstone(), NewMergeOperand(SumOperator, int64ForTest(5)))
+	assert.True(t, ok)
+	assert.Equal(t, NewValue(int64ForTest(5)), merged)
+
+	merged, ok = MergeOnto(NewMergeOperand(SumOperator, int64ForTest(2)), NewMergeOperand(SumOperator, int64ForTest(5)))
+	assert.True(t, ok)
+	assert.Equal(t, NewMergeOperand(SumOperator, int64ForTest(7)), merged)
+
+	merged, ok = MergeOnto(NewMergeOperand(SumOperator, int64ForTest(2)), NewValue([]byte("Hard disk")))
+	assert.True(t, ok)
+	assert.Equal(t, NewValue([]byte("Hard disk")), merged)
+}
+
+func TestDoesNotMergeOperandsOfDifferentOrUnknownOperators(t *testing.T) {
+	_, ok := MergeOnto(NewMergeOperand(SumOperator, int64ForTest(2)), NewMergeOperand(MaxOperator, int64ForTest(5)))
+	assert.False(t, ok)
+
+	_, ok = MergeOnto(NewValue(int64ForTest(2)), NewMergeOperand("unknown", int64ForTest(5)))
+	assert.False(t, ok)
+}
+
+func TestDoesNotResolveAMergeOfAnUnknownOperator(t *testing.T) {
+	_, err := ResolveMerge(NewValue(int64ForTest(2)), NewMergeOperand("unknown", int64ForTest(5)))
+	assert.Equal(t, UnknownMergeOperatorErr, err)
+}
+
+func TestMergesWithTheRegisteredOperators(t *testing.T) {
+	fold := func(operatorName string, operands ...[]byte) []byte {
+		value := NewTombstone()
+		for _, operand := range operands {
+			var err error
+			value, err = ResolveMerge(value, NewMergeOperand(operatorName, operand))
+			assert.Nil(t, err)
+		}
+		return value.Slice()
+	}
+
+	assert.Equal(t, EncodeList([]byte("HDD"), []byte("SSD"), []byte("HDD")),
+		fold(AppendOperator, EncodeList([]byte("HDD")), EncodeList([]byte("SSD")), EncodeList([]byte("HDD"))))
+	assert.Equal(t, int64ForTest(4), fold(SumOperator, int64ForTest(7), int64ForTest(-3)))
+	assert.Equal(t, int64ForTest(7), fold(MaxOperator, int64ForTest(-3), int64ForTest(7), int64ForTest(2)))
+	assert.Equal(t, EncodeList([]byte("HDD"), []byte("NVMe"), []byte("SSD")),
+		fold(SetUnionOperator, EncodeList([]byte("SSD"), []byte("HDD")), EncodeList([]byte("NVMe"), []byte("SSD"))))
+}
+
+func TestCollapsesTheOperandsInAnyGrouping(t *testing.T) {
+	operands := []Value{
+		NewMergeOperand(SetUnionOperator, EncodeList([]byte("SSD"))),
+		NewMergeOperand(SetUnionOperator, EncodeList([]byte("HDD"))),
+		NewMergeOperand(SetUnionOperator, EncodeList([]byte("SSD"), []byte("CD"))),
+	}
+	base := NewValue(EncodeList([]byte("Tape")))
+
+	oneByOne := base
+	for _, operand := range operands {
+		oneByOne, _ = ResolveMerge(oneByOne, operand)
+	}
+	collapsed, _ := MergeOnto(operands[0], operands[1])
+	collapsed, _ = MergeOnto(collapsed, operands[2])
+
+	merged, err := ResolveMerge(base, collapsed)
+	assert.Nil(t, err)
+	assert.Equal(t, oneByOne, merged)
+}
+
+func TestDecodesAList(t *testing.T) {
+	elements, err := DecodeList(EncodeList([]byte("HDD"), []byte{}, []byte("SSD")))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("HDD"), {}, []byte("SSD")}, elements)
+
+	elements, err = DecodeList(append(EncodeList([]byte("HDD")), 10))
+	assert.Equal(t, MalformedListErr, err)
+	assert.Equal(t, [][]byte{[]byte("HDD")}, elements)
+}
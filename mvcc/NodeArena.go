@@ -0,0 +1,92 @@
+package mvcc
+
+import (
+	"IsoTransact/mvcc/utils"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	nodesPerChunk = 1024
+	//a node has a tower of 2 levels on an average
+	towerSlotsPerChunk = 4 * nodesPerChunk
+	bytesPerChunk      = 64 << 10
+	//a key or a value larger than this gets an allocation of its own, so that it does not waste most of a chunk
+	maxBytesFromChunk = bytesPerChunk / 4
+)
+
+var (
+	nodeSize      = int64(unsafe.Sizeof(concurrentNode{}))
+	towerSlotSize = int64(unsafe.Sizeof(atomic.Pointer[concurrentNode]{}))
+)
+
+// nodeArena hands out the nodes of a ConcurrentSkipList, their towers, and the bytes of their keys and values,
+// from chunks allocated many at a time, so that an insert does not cost several heap allocations and the garbage collector
+// tracks a few large objects instead of many small ones. A chunk is never reused; it is released along with the memtable
+// once nothing points into it.
+// The keys and the values are copied into the arena, so the memtable never aliases the buffers of its callers.
+type nodeArena struct {
+	lock           sync.Mutex
+	levelGenerator utils.LevelGenerator
+	nodes          []concurrentNode
+	towerSlots     []atomic.Pointer[concurrentNode]
+	bytes          []byte
+	allocated      atomic.Int64
+}
+
+func newNodeArena(maxLevel uint8) *nodeArena {
+	return &nodeArena{levelGenerator: *utils.NewLevelGenerator(maxLevel)}
+}
+
+// allocate returns a node of a random height holding copies of the key and the value.
+// The random source of the level generator is not safe for concurrent use, so the height is generated under the lock of the arena as well.
+func (arena *nodeArena) allocate(key VersionedKey, value Value) *concurrentNode {
+	arena.lock.Lock()
+	defer arena.lock.Unlock()
+
+	level := int(arena.levelGenerator.Generate())
+	if len(arena.nodes) == 0 {
+		arena.nodes = make([]concurrentNode, nodesPerChunk)
+	}
+	if len(arena.towerSlots) < level {
+		arena.towerSlots = make([]atomic.Pointer[concurrentNode], towerSlotsPerChunk)
+	}
+	node := &arena.nodes[0]
+	arena.nodes = arena.nodes[1:]
+	node.key = VersionedKey{key: arena.copyOf(key.GetKey()), version: key.GetVersion()}
+	node.value = Value{value: arena.copyOf(value.value), kind: value.kind}
+	node.tower = arena.towerSlots[:level:level]
+	arena.towerSlots = arena.towerSlots[level:]
+
+	arena.allocated.Add(sizeOf(node))
+	return node
+}
+
+// copyOf copies the bytes into the arena, the caller holds the lock. A nil slice stays nil.
+func (arena *nodeArena) copyOf(source []byte) []byte {
+	if source == nil {
+		return nil
+	}
+	if len(source) > maxBytesFromChunk {
+		return append(make([]byte, 0, len(source)), source...)
+	}
+	if len(arena.bytes) < len(source) {
+		arena.bytes = make([]byte, bytesPerChunk)
+	}
+	copied := arena.bytes[:len(source):len(source)]
+	copy(copied, source)
+	arena.bytes = arena.bytes[len(source):]
+	return copied
+}
+
+// size returns the bytes handed out by the arena: the nodes, their towers, and the bytes of their keys and values.
+// The unused remainder of the current chunks is not counted.
+func (arena *nodeArena) size() int64 {
+	return arena.allocated.Load()
+}
+
+// sizeOf returns the bytes of the arena used by the node.
+func sizeOf(node *concurrentNode) int64 {
+	return nodeSize + towerSlotSize*int64(len(node.tower)) + int64(len(node.key.GetKey())+len(node.value.value))
+}
@@ -20,7 +20,7 @@ func (node *SkipListNode) putOrUpdate(keyToInsert VersionedKey, value Value, lev
 
 	for level := len(current.tower) - 1; level >= 0; level-- {
 		//move right at the current level
-		for current.tower[level] != nil && current.tower[level].key.compare(keyToInsert) < 0 {
+		for current.tower[level] != nil && current.tower[level].key.Compare(keyToInsert) < 0 {
 			current = current.tower[level]
 		}
 		//move down in the tower
@@ -28,7 +28,7 @@ func (node *SkipListNode) putOrUpdate(keyToInsert VersionedKey, value Value, lev
 	}
 
 	//key already exists
-	if current.tower[0] != nil && current.tower[0].key.compare(keyToInsert) == 0 {
+	if current.tower[0] != nil && current.tower[0].key.Compare(keyToInsert) == 0 {
 		return false
 	}
 
@@ -51,25 +51,56 @@ func (node *SkipListNode) get(key VersionedKey) (Value, bool) {
 	return emptyValue(), false
 }
 
+// matchingNode returns the node with the key of keyToMatch and the highest version that is less than or equal to the version of keyToMatch.
 func (node *SkipListNode) matchingNode(keyToMatch VersionedKey) (*SkipListNode, bool) {
 	current := node
-	lastNodeWithTheKey := node
 
 	for level := len(node.tower) - 1; level >= 0; level-- {
 		//move right
-		for current.tower[level] != nil && current.tower[level].key.compare(keyToMatch) < 0 {
+		for current.tower[level] != nil && current.tower[level].key.Compare(keyToMatch) <= 0 {
 			current = current.tower[level]
-			lastNodeWithTheKey = current
 		}
 		//move down in the tower
 	}
 
-	if current != nil && current.key.matchesKeyPrefix(keyToMatch.getKey()) {
+	if current != node && current.key.matchesKeyPrefix(keyToMatch.GetKey()) {
 		return current, true
 	}
+	return nil, false
+}
 
-	if lastNodeWithTheKey != nil && lastNodeWithTheKey.key.matchesKeyPrefix(keyToMatch.getKey()) {
-		return lastNodeWithTheKey, true
+// precedingNode returns the last node with a key less than the given key, which is the node itself if there is none.
+func (node *SkipListNode) precedingNode(key VersionedKey) *SkipListNode {
+	current := node
+	for level := len(node.tower) - 1; level >= 0; level-- {
+		for current.tower[level] != nil && current.tower[level].key.Compare(key) < 0 {
+			current = current.tower[level]
+		}
 	}
-	return nil, false
+	return current
+}
+
+// remove unlinks the node with the key at every level it is linked at, and returns it.
+// The tower of the removed node is left untouched, so that an iterator standing on it can still move on.
+func (node *SkipListNode) remove(keyToRemove VersionedKey) (*SkipListNode, bool) {
+	current := node
+	precedingNodes := make([]*SkipListNode, len(node.tower))
+
+	for level := len(current.tower) - 1; level >= 0; level-- {
+		for current.tower[level] != nil && current.tower[level].key.Compare(keyToRemove) < 0 {
+			current = current.tower[level]
+		}
+		precedingNodes[level] = current
+	}
+
+	target := current.tower[0]
+	if target == nil || target.key.Compare(keyToRemove) != 0 {
+		return nil, false
+	}
+	for level := 0; level < len(target.tower); level++ {
+		if precedingNodes[level].tower[level] == target {
+			precedingNodes[level].tower[level] = target.tower[level]
+		}
+	}
+	return target, true
 }
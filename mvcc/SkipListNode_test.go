@@ -70,10 +70,10 @@ func TestGetsTheValueOfAKeyWithLatestVersion(t *testing.T) {
 	sentinelNode.putOrUpdate(*NewVersionedKey([]byte("SSD"), 3), NewValue([]byte("Solid-State-drive")), levelGenerator)
 
 	expected := make(map[uint64][]byte)
-	expected[2] = []byte("Solid state drive")
-	expected[3] = []byte("Solid State drive")
+	expected[1] = []byte("Solid state drive")
+	expected[2] = []byte("Solid State drive")
+	expected[3] = []byte("Solid-State-drive")
 	expected[4] = []byte("Solid-State-drive")
-	expected[5] = []byte("Solid-State-drive")
 
 	for version, expectedValue := range expected {
 		key := NewVersionedKey([]byte("SSD"), version)
@@ -83,3 +83,15 @@ func TestGetsTheValueOfAKeyWithLatestVersion(t *testing.T) {
 		assert.Equal(t, expectedValue, value.Slice())
 	}
 }
+
+func TestGetsTheValueForAKeyWithAVersionOlderThanAllTheVersions(t *testing.T) {
+	const maxLevel = 8
+	sentinelNode := NewSkipListNode(emptyVersionedKey(), emptyValue(), maxLevel)
+
+	levelGenerator := *utils.NewLevelGenerator(maxLevel)
+	sentinelNode.putOrUpdate(*NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")), levelGenerator)
+	sentinelNode.putOrUpdate(*NewVersionedKey([]byte("SSD"), 5), NewValue([]byte("Solid state drive")), levelGenerator)
+
+	_, ok := sentinelNode.get(*NewVersionedKey([]byte("SSD"), 4))
+	assert.Equal(t, false, ok)
+}
@@ -0,0 +1,50 @@
+package mvcc
+
+// StorageEngine stores the versioned keys of the committed batches and serves the reads of the transactions.
+// The TransactionExecutor is its only writer; the transactions read concurrently with it.
+// MemTable and lsm.Tree implement it, and every implementation has to pass the conformance tests of the enginetest package.
+type StorageEngine interface {
+	//PutOrUpdate puts the value at the versioned key. The executor puts a versioned key at most once,
+	//so the value of a versioned key put twice is left to the engine
+	PutOrUpdate(key VersionedKey, value Value)
+	//Get returns the value, a tombstone or a merge operand included, of the highest version of the key that is less than or equal to the version of the given key,
+	//or the error of reading the storage
+	Get(key VersionedKey) (Value, bool, error)
+	//NewRangeIterator returns an iterator over all the versions of the keys in [start, end), in the increasing order of key and version;
+	//a nil start or end leaves that side unbounded
+	NewRangeIterator(start, end []byte) RangeIterator
+	//NewReverseRangeIterator returns an iterator over the versions at or below the version of the keys in [start, end),
+	//in the decreasing order of key and version; it seeks past the newer versions of a key rather than walking them
+	NewReverseRangeIterator(start, end []byte, version uint64) RangeIterator
+	//ApplyBatch puts all the entries at the version. No transaction reads at the version till the executor marks the batch applied,
+	//so the batch becomes visible at once, as long as ApplyBatch has put every entry by the time it returns
+	ApplyBatch(version uint64, entries []Entry)
+	//Close releases the resources of the engine, nothing is read or written after it
+	Close()
+}
+
+// RangeIterator is an Iterator holding on to resources of the engine until Close.
+// Next returns false on an error of reading the storage, which Err then returns.
+type RangeIterator interface {
+	Iterator
+	Err() error
+	Close()
+}
+
+// Entry is a key and its value in a batch, the version comes from the batch.
+type Entry struct {
+	key   []byte
+	value Value
+}
+
+func NewEntry(key []byte, value Value) Entry {
+	return Entry{key: key, value: value}
+}
+
+func (entry Entry) GetKey() []byte {
+	return entry.key
+}
+
+func (entry Entry) GetValue() Value {
+	return entry.value
+}
@@ -1,7 +1,18 @@
 package mvcc
 
+// ValueKind tells a regular value apart from a tombstone, the version that marks the deletion of a key,
+// and from a merge operand, the version that is folded onto the versions below it (see NewMergeOperand).
+type ValueKind uint8
+
+const (
+	RegularValue ValueKind = iota
+	TombstoneValue
+	MergeOperandValue
+)
+
 type Value struct {
 	value []byte
+	kind  ValueKind
 }
 
 func NewValue(value []byte) Value {
@@ -10,6 +21,14 @@ func NewValue(value []byte) Value {
 	}
 }
 
+func NewTombstone() Value {
+	return Value{kind: TombstoneValue}
+}
+
+func NewValueOfKind(kind ValueKind, value []byte) Value {
+	return Value{value: value, kind: kind}
+}
+
 func emptyValue() Value {
 	return Value{}
 }
@@ -17,3 +36,15 @@ func emptyValue() Value {
 func (value Value) Slice() []byte {
 	return value.value
 }
+
+func (value Value) Kind() ValueKind {
+	return value.kind
+}
+
+func (value Value) IsTombstone() bool {
+	return value.kind == TombstoneValue
+}
+
+func (value Value) IsMergeOperand() bool {
+	return value.kind == MergeOperandValue
+}
@@ -15,18 +15,18 @@ func emptyVersionedKey() VersionedKey {
 	return VersionedKey{}
 }
 
-func (versionedKey VersionedKey) getKey() []byte {
+func (versionedKey VersionedKey) GetKey() []byte {
 	return versionedKey.key
 }
 
-func (versionedKey VersionedKey) getVersion() uint64 {
+func (versionedKey VersionedKey) GetVersion() uint64 {
 	return versionedKey.version
 }
 
-func (versionedKey VersionedKey) compare(other VersionedKey) int {
-	comparisonResult := bytes.Compare(versionedKey.getKey(), other.getKey())
+func (versionedKey VersionedKey) Compare(other VersionedKey) int {
+	comparisonResult := bytes.Compare(versionedKey.GetKey(), other.GetKey())
 	if comparisonResult == 0 {
-		thisVersion, otherVersion := versionedKey.getVersion(), other.getVersion()
+		thisVersion, otherVersion := versionedKey.GetVersion(), other.GetVersion()
 		if thisVersion == otherVersion {
 			return 0
 		}
@@ -39,9 +39,9 @@ func (versionedKey VersionedKey) compare(other VersionedKey) int {
 }
 
 func (versionedKey VersionedKey) matchesKeyPrefix(key []byte) bool {
-	return bytes.Compare(versionedKey.getKey(), key) == 0
+	return bytes.Compare(versionedKey.GetKey(), key) == 0
 }
 
 func (versionedKey VersionedKey) asString() string {
-	return string(versionedKey.getKey())
+	return string(versionedKey.GetKey())
 }
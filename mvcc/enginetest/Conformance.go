@@ -0,0 +1,132 @@
+package enginetest
+
+import (
+	"IsoTransact/mvcc"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+// RunConformanceTests runs the behaviour every mvcc.StorageEngine has to provide against the engines made by newEngine,
+// a new one for every test.
+func RunConformanceTests(t *testing.T, newEngine func(t *testing.T) mvcc.StorageEngine) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, engine mvcc.StorageEngine)
+	}{
+		{"GetsTheHighestVersionAtOrBelowTheVersion", getsTheHighestVersionAtOrBelowTheVersion},
+		{"DoesNotGetAKeyBelowItsOldestVersion", doesNotGetAKeyBelowItsOldestVersion},
+		{"GetsATombstone", getsATombstone},
+		{"AppliesABatchAtItsVersion", appliesABatchAtItsVersion},
+		{"IteratesOverAllTheVersionsInARange", iteratesOverAllTheVersionsInARange},
+		{"IteratesOverAnUnboundedRange", iteratesOverAnUnboundedRange},
+		{"IteratesBackwardsOverTheVersionsAtOrBelowAVersion", iteratesBackwardsOverTheVersionsAtOrBelowAVersion},
+		{"IteratesBackwardsOverAnUnboundedRange", iteratesBackwardsOverAnUnboundedRange},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := newEngine(t)
+			defer engine.Close()
+			test.test(t, engine)
+		})
+	}
+}
+
+func getsTheHighestVersionAtOrBelowTheVersion(t *testing.T, engine mvcc.StorageEngine) {
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), 2), mvcc.NewValue([]byte("Hard disk")))
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), 4), mvcc.NewValue([]byte("Hard disk drive")))
+
+	value, ok, _ := engine.Get(*mvcc.NewVersionedKey([]byte("HDD"), 3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	value, ok, _ = engine.Get(*mvcc.NewVersionedKey([]byte("HDD"), 4))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+}
+
+func doesNotGetAKeyBelowItsOldestVersion(t *testing.T, engine mvcc.StorageEngine) {
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), 2), mvcc.NewValue([]byte("Hard disk")))
+
+	_, ok, _ := engine.Get(*mvcc.NewVersionedKey([]byte("HDD"), 1))
+	assert.Equal(t, false, ok)
+	_, ok, _ = engine.Get(*mvcc.NewVersionedKey([]byte("SSD"), 2))
+	assert.Equal(t, false, ok)
+}
+
+func getsATombstone(t *testing.T, engine mvcc.StorageEngine) {
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), 2), mvcc.NewTombstone())
+
+	value, ok, _ := engine.Get(*mvcc.NewVersionedKey([]byte("HDD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, value.IsTombstone())
+}
+
+func appliesABatchAtItsVersion(t *testing.T, engine mvcc.StorageEngine) {
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("SSD"), 1), mvcc.NewValue([]byte("Solid state")))
+	engine.ApplyBatch(5, []mvcc.Entry{
+		mvcc.NewEntry([]byte("HDD"), mvcc.NewValue([]byte("Hard disk"))),
+		mvcc.NewEntry([]byte("SSD"), mvcc.NewTombstone()),
+	})
+
+	_, ok, _ := engine.Get(*mvcc.NewVersionedKey([]byte("HDD"), 4))
+	assert.Equal(t, false, ok)
+	value, ok, _ := engine.Get(*mvcc.NewVersionedKey([]byte("HDD"), 5))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	value, _, _ = engine.Get(*mvcc.NewVersionedKey([]byte("SSD"), 4))
+	assert.Equal(t, []byte("Solid state"), value.Slice())
+	value, _, _ = engine.Get(*mvcc.NewVersionedKey([]byte("SSD"), 5))
+	assert.Equal(t, true, value.IsTombstone())
+}
+
+func iteratesOverAllTheVersionsInARange(t *testing.T, engine mvcc.StorageEngine) {
+	putKeysForTest(engine)
+
+	iterator := engine.NewRangeIterator([]byte("HDD"), []byte("SSD"))
+	defer iterator.Close()
+	assert.Equal(t, []string{"HDD@1", "HDD@2", "NVMe@1"}, collect(iterator))
+}
+
+func iteratesOverAnUnboundedRange(t *testing.T, engine mvcc.StorageEngine) {
+	putKeysForTest(engine)
+
+	iterator := engine.NewRangeIterator(nil, nil)
+	defer iterator.Close()
+	assert.Equal(t, []string{"CD@3", "HDD@1", "HDD@2", "NVMe@1", "SSD@2"}, collect(iterator))
+}
+
+func iteratesBackwardsOverTheVersionsAtOrBelowAVersion(t *testing.T, engine mvcc.StorageEngine) {
+	putKeysForTest(engine)
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), 5), mvcc.NewValue([]byte("Hard disk")))
+
+	iterator := engine.NewReverseRangeIterator([]byte("HDD"), []byte("SSD"), 2)
+	defer iterator.Close()
+	assert.Equal(t, []string{"NVMe@1", "HDD@2", "HDD@1"}, collect(iterator))
+}
+
+func iteratesBackwardsOverAnUnboundedRange(t *testing.T, engine mvcc.StorageEngine) {
+	putKeysForTest(engine)
+
+	iterator := engine.NewReverseRangeIterator(nil, nil, 2)
+	defer iterator.Close()
+	assert.Equal(t, []string{"SSD@2", "NVMe@1", "HDD@2", "HDD@1"}, collect(iterator))
+}
+
+func putKeysForTest(engine mvcc.StorageEngine) {
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("SSD"), 2), mvcc.NewValue([]byte("Solid state")))
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), 2), mvcc.NewValue([]byte("Hard disk drive")))
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("NVMe"), 1), mvcc.NewTombstone())
+	engine.PutOrUpdate(*mvcc.NewVersionedKey([]byte("CD"), 3), mvcc.NewValue([]byte("Compact disc")))
+}
+
+func collect(iterator mvcc.RangeIterator) []string {
+	var keys []string
+	for iterator.Next() {
+		keys = append(keys, string(iterator.Key().GetKey())+"@"+strconv.FormatUint(iterator.Key().GetVersion(), 10))
+	}
+	return keys
+}
@@ -0,0 +1,56 @@
+package enginetest
+
+import (
+	"IsoTransact/lsm"
+	"IsoTransact/mvcc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMemTableConformsToTheStorageEngine(t *testing.T) {
+	RunConformanceTests(t, func(t *testing.T) mvcc.StorageEngine {
+		return mvcc.NewMemTable(10)
+	})
+}
+
+func TestInMemoryTreeConformsToTheStorageEngine(t *testing.T) {
+	RunConformanceTests(t, func(t *testing.T) mvcc.StorageEngine {
+		return lsm.NewInMemoryTree(mvcc.NewMemTable(10))
+	})
+}
+
+func TestDurableTreeConformsToTheStorageEngine(t *testing.T) {
+	RunConformanceTests(t, func(t *testing.T) mvcc.StorageEngine {
+		tree, err := lsm.Open(lsm.Options{
+			Directory:        t.TempDir(),
+			SkipListMaxLevel: 10,
+			MemTableSize:     128,
+			BlockSize:        64,
+			Compaction:       lsm.DefaultCompactionOptions(),
+		})
+		assert.Nil(t, err)
+		return &freezingTree{Tree: tree}
+	})
+}
+
+func TestMapEngineConformsToTheStorageEngine(t *testing.T) {
+	RunConformanceTests(t, func(t *testing.T) mvcc.StorageEngine {
+		return NewMapEngine()
+	})
+}
+
+// freezingTree freezes the active memtable after every write, the way the executor does in between the batches,
+// so that the versions spread across the memtables and the tables.
+type freezingTree struct {
+	*lsm.Tree
+}
+
+func (tree *freezingTree) PutOrUpdate(key mvcc.VersionedKey, value mvcc.Value) {
+	tree.Tree.PutOrUpdate(key, value)
+	tree.Tree.MaybeFreeze()
+}
+
+func (tree *freezingTree) ApplyBatch(version uint64, entries []mvcc.Entry) {
+	tree.Tree.ApplyBatch(version, entries)
+	tree.Tree.MaybeFreeze()
+}
@@ -0,0 +1,136 @@
+package enginetest
+
+import (
+	"IsoTransact/mvcc"
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// MapEngine is an mvcc.StorageEngine over a map, for the tests: the whole engine is guarded by a single lock,
+// and an iterator copies the versions of its range up front.
+type MapEngine struct {
+	lock     sync.RWMutex
+	versions map[string][]version //in the increasing order of version
+}
+
+type version struct {
+	version uint64
+	value   mvcc.Value
+}
+
+func NewMapEngine() *MapEngine {
+	return &MapEngine{versions: make(map[string][]version)}
+}
+
+func (engine *MapEngine) PutOrUpdate(key mvcc.VersionedKey, value mvcc.Value) {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+
+	engine.put(key, value)
+}
+
+// put inserts the version in order, the caller holds the lock. A version that already exists is left as is.
+func (engine *MapEngine) put(key mvcc.VersionedKey, value mvcc.Value) {
+	versions := engine.versions[string(key.GetKey())]
+	index := sort.Search(len(versions), func(index int) bool {
+		return versions[index].version >= key.GetVersion()
+	})
+	if index < len(versions) && versions[index].version == key.GetVersion() {
+		return
+	}
+	versions = append(versions, version{})
+	copy(versions[index+1:], versions[index:])
+	versions[index] = version{version: key.GetVersion(), value: value}
+	engine.versions[string(key.GetKey())] = versions
+}
+
+func (engine *MapEngine) Get(key mvcc.VersionedKey) (mvcc.Value, bool, error) {
+	engine.lock.RLock()
+	defer engine.lock.RUnlock()
+
+	versions := engine.versions[string(key.GetKey())]
+	index := sort.Search(len(versions), func(index int) bool {
+		return versions[index].version > key.GetVersion()
+	})
+	if index == 0 {
+		return mvcc.Value{}, false, nil
+	}
+	return versions[index-1].value, true, nil
+}
+
+// ApplyBatch puts all the entries under the lock, so a reader sees either none or all of them.
+func (engine *MapEngine) ApplyBatch(version uint64, entries []mvcc.Entry) {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+
+	for _, entry := range entries {
+		engine.put(*mvcc.NewVersionedKey(entry.GetKey(), version), entry.GetValue())
+	}
+}
+
+func (engine *MapEngine) NewRangeIterator(start, end []byte) mvcc.RangeIterator {
+	engine.lock.RLock()
+	defer engine.lock.RUnlock()
+
+	var keys []string
+	for key := range engine.versions {
+		if (start == nil || bytes.Compare([]byte(key), start) >= 0) && (end == nil || bytes.Compare([]byte(key), end) < 0) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	iterator := &mapIterator{index: -1}
+	for _, key := range keys {
+		for _, version := range engine.versions[key] {
+			iterator.keys = append(iterator.keys, *mvcc.NewVersionedKey([]byte(key), version.version))
+			iterator.values = append(iterator.values, version.value)
+		}
+	}
+	return iterator
+}
+
+func (engine *MapEngine) NewReverseRangeIterator(start, end []byte, version uint64) mvcc.RangeIterator {
+	forward := engine.NewRangeIterator(start, end).(*mapIterator)
+	iterator := &mapIterator{index: -1}
+	for index := len(forward.keys) - 1; index >= 0; index-- {
+		if forward.keys[index].GetVersion() <= version {
+			iterator.keys = append(iterator.keys, forward.keys[index])
+			iterator.values = append(iterator.values, forward.values[index])
+		}
+	}
+	return iterator
+}
+
+func (engine *MapEngine) Close() {
+}
+
+type mapIterator struct {
+	keys   []mvcc.VersionedKey
+	values []mvcc.Value
+	index  int
+}
+
+func (iterator *mapIterator) Next() bool {
+	if iterator.index+1 >= len(iterator.keys) {
+		return false
+	}
+	iterator.index++
+	return true
+}
+
+func (iterator *mapIterator) Key() mvcc.VersionedKey {
+	return iterator.keys[iterator.index]
+}
+
+func (iterator *mapIterator) Value() mvcc.Value {
+	return iterator.values[iterator.index]
+}
+
+func (iterator *mapIterator) Err() error {
+	return nil
+}
+
+func (iterator *mapIterator) Close() {
+}
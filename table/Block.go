@@ -0,0 +1,157 @@
+package table
+
+import (
+	"IsoTransact/mvcc"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const checksumSize = 4
+
+var CorruptTableErr = errors.New("table is corrupt")
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// blockBuilder accumulates the entries of a data block as:
+// [key length (uvarint) | key | version (8 bytes) | value kind (1 byte) | value length (uvarint) | value]... | checksum (4 bytes)
+type blockBuilder struct {
+	buffer          []byte
+	lastKey         mvcc.VersionedKey
+	numberOfEntries int
+}
+
+func (builder *blockBuilder) add(key mvcc.VersionedKey, value mvcc.Value) {
+	builder.buffer = appendVersionedKey(builder.buffer, key)
+	builder.buffer = append(builder.buffer, byte(value.Kind()))
+	builder.buffer = appendBytes(builder.buffer, value.Slice())
+	builder.lastKey = key
+	builder.numberOfEntries++
+}
+
+func (builder *blockBuilder) size() int {
+	return len(builder.buffer)
+}
+
+func (builder *blockBuilder) isEmpty() bool {
+	return builder.numberOfEntries == 0
+}
+
+// finish seals the block with its checksum and resets the builder.
+func (builder *blockBuilder) finish() []byte {
+	block := withChecksum(builder.buffer)
+	*builder = blockBuilder{}
+	return block
+}
+
+// blockEntry is a decoded entry of a data block.
+type blockEntry struct {
+	key   mvcc.VersionedKey
+	value mvcc.Value
+}
+
+func decodeBlock(block []byte) ([]blockEntry, error) {
+	contents, err := verifyChecksum(block)
+	if err != nil {
+		return nil, err
+	}
+	var entries []blockEntry
+	decoder := &decoder{buffer: contents}
+	for !decoder.isExhausted() {
+		key := decoder.versionedKey()
+		kind := mvcc.ValueKind(decoder.byte())
+		value := decoder.bytes()
+		if decoder.failed {
+			return nil, CorruptTableErr
+		}
+		entries = append(entries, blockEntry{key: key, value: mvcc.NewValueOfKind(kind, value)})
+	}
+	return entries, nil
+}
+
+func withChecksum(contents []byte) []byte {
+	return binary.BigEndian.AppendUint32(contents, crc32.Checksum(contents, castagnoliTable))
+}
+
+func verifyChecksum(block []byte) ([]byte, error) {
+	if len(block) < checksumSize {
+		return nil, CorruptTableErr
+	}
+	contents := block[:len(block)-checksumSize]
+	if crc32.Checksum(contents, castagnoliTable) != binary.BigEndian.Uint32(block[len(contents):]) {
+		return nil, CorruptTableErr
+	}
+	return contents, nil
+}
+
+func appendBytes(buffer []byte, bytes []byte) []byte {
+	buffer = binary.AppendUvarint(buffer, uint64(len(bytes)))
+	return append(buffer, bytes...)
+}
+
+func appendVersionedKey(buffer []byte, key mvcc.VersionedKey) []byte {
+	buffer = appendBytes(buffer, key.GetKey())
+	return binary.BigEndian.AppendUint64(buffer, key.GetVersion())
+}
+
+// decoder reads the fields written by appendBytes, appendVersionedKey and friends.
+// Once a read goes past the end of the buffer, failed is set and all the further reads return zero values.
+type decoder struct {
+	buffer []byte
+	offset int
+	failed bool
+}
+
+func (decoder *decoder) isExhausted() bool {
+	return decoder.failed || decoder.offset >= len(decoder.buffer)
+}
+
+func (decoder *decoder) uvarint() uint64 {
+	if decoder.failed {
+		return 0
+	}
+	value, read := binary.Uvarint(decoder.buffer[decoder.offset:])
+	if read <= 0 {
+		decoder.failed = true
+		return 0
+	}
+	decoder.offset = decoder.offset + read
+	return value
+}
+
+func (decoder *decoder) byte() byte {
+	if decoder.failed || decoder.offset >= len(decoder.buffer) {
+		decoder.failed = true
+		return 0
+	}
+	value := decoder.buffer[decoder.offset]
+	decoder.offset++
+	return value
+}
+
+func (decoder *decoder) uint64() uint64 {
+	if decoder.failed || len(decoder.buffer)-decoder.offset < 8 {
+		decoder.failed = true
+		return 0
+	}
+	value := binary.BigEndian.Uint64(decoder.buffer[decoder.offset:])
+	decoder.offset = decoder.offset + 8
+	return value
+}
+
+func (decoder *decoder) bytes() []byte {
+	length := decoder.uvarint()
+	if decoder.failed || uint64(len(decoder.buffer)-decoder.offset) < length {
+		decoder.failed = true
+		return nil
+	}
+	bytes := decoder.buffer[decoder.offset : decoder.offset+int(length)]
+	decoder.offset = decoder.offset + int(length)
+	return bytes
+}
+
+func (decoder *decoder) versionedKey() mvcc.VersionedKey {
+	key := decoder.bytes()
+	version := decoder.uint64()
+	return *mvcc.NewVersionedKey(key, version)
+}
@@ -0,0 +1,44 @@
+package table
+
+import "IsoTransact/mvcc"
+
+// Iterator walks all the versioned keys of a table in the increasing order of key and version.
+type Iterator struct {
+	reader     *Reader
+	blockIndex int
+	entries    []blockEntry
+	position   int
+	err        error
+}
+
+func (iterator *Iterator) Next() bool {
+	if iterator.err != nil {
+		return false
+	}
+	iterator.position++
+	for iterator.position >= len(iterator.entries) {
+		if iterator.blockIndex+1 >= len(iterator.reader.handles) {
+			return false
+		}
+		iterator.blockIndex++
+		iterator.entries, iterator.err = iterator.reader.readBlock(iterator.blockIndex)
+		if iterator.err != nil {
+			return false
+		}
+		iterator.position = 0
+	}
+	return true
+}
+
+func (iterator *Iterator) Key() mvcc.VersionedKey {
+	return iterator.entries[iterator.position].key
+}
+
+func (iterator *Iterator) Value() mvcc.Value {
+	return iterator.entries[iterator.position].value
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (iterator *Iterator) Err() error {
+	return iterator.err
+}
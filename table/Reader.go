@@ -0,0 +1,238 @@
+package table
+
+import (
+	"IsoTransact/mvcc"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// Reader serves point lookups and iteration over a table written by Writer.
+// The index block is kept in memory, the data blocks are read from the file on demand.
+// A Reader is reference counted: it starts with one reference held by its opener, and the file is closed
+// (and removed, if the table was marked for deletion) once the last reference is released.
+type Reader struct {
+	references      atomic.Int32
+	markedForDelete atomic.Bool
+	file            *os.File
+	size            int64
+	handles         []blockHandle
+	smallestKey     mvcc.VersionedKey
+	numberOfEntries uint64
+	maxVersion      uint64
+}
+
+// Open opens the table at filePath and verifies the checksums of the footer, the index block and all the data blocks.
+func Open(filePath string) (*Reader, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+func newReader(file *os.File) (*Reader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < footerSize {
+		return nil, CorruptTableErr
+	}
+	footer := make([]byte, footerSize)
+	if _, err := file.ReadAt(footer, info.Size()-footerSize); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint64(footer[footerSize-8:]) != magicNumber {
+		return nil, CorruptTableErr
+	}
+	footerContents, err := verifyChecksum(footer[:footerSize-8])
+	if err != nil {
+		return nil, err
+	}
+	indexOffset, indexSize := binary.BigEndian.Uint64(footerContents), binary.BigEndian.Uint64(footerContents[8:])
+	if indexOffset+indexSize+footerSize != uint64(info.Size()) {
+		return nil, CorruptTableErr
+	}
+
+	index := make([]byte, indexSize)
+	if _, err := file.ReadAt(index, int64(indexOffset)); err != nil {
+		return nil, err
+	}
+	reader := &Reader{file: file, size: info.Size()}
+	reader.references.Store(1)
+	if err := reader.decodeIndex(index); err != nil {
+		return nil, err
+	}
+	for blockIndex := range reader.handles {
+		if _, err := reader.readBlock(blockIndex); err != nil {
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+func (reader *Reader) decodeIndex(index []byte) error {
+	contents, err := verifyChecksum(index)
+	if err != nil {
+		return err
+	}
+	decoder := &decoder{buffer: contents}
+	reader.smallestKey = decoder.versionedKey()
+	reader.numberOfEntries = decoder.uvarint()
+	reader.maxVersion = decoder.uint64()
+
+	numberOfBlocks := decoder.uvarint()
+	for count := uint64(0); count < numberOfBlocks && !decoder.failed; count++ {
+		handle := blockHandle{lastKey: decoder.versionedKey()}
+		handle.offset = decoder.uvarint()
+		handle.size = decoder.uvarint()
+		reader.handles = append(reader.handles, handle)
+	}
+	if decoder.failed || !decoder.isExhausted() || len(reader.handles) == 0 {
+		return CorruptTableErr
+	}
+	return nil
+}
+
+func (reader *Reader) readBlock(blockIndex int) ([]blockEntry, error) {
+	handle := reader.handles[blockIndex]
+	block := make([]byte, handle.size)
+	if _, err := reader.file.ReadAt(block, int64(handle.offset)); err != nil {
+		return nil, err
+	}
+	return decodeBlock(block)
+}
+
+// Get returns the value of the highest version of the key that is less than or equal to the version of the given key.
+// The blocks were verified when the table was opened, so an error here means that the file changed or the disk failed underneath.
+func (reader *Reader) Get(key mvcc.VersionedKey) (mvcc.Value, bool, error) {
+	if !reader.mayContain(key.GetKey()) {
+		return mvcc.Value{}, false, nil
+	}
+	//the first block whose last key is greater than or equal to the key,
+	//the matching entry is either in this block or is the last entry of the previous block.
+	blockIndex := sort.Search(len(reader.handles), func(index int) bool {
+		return reader.handles[index].lastKey.Compare(key) >= 0
+	})
+	for candidateBlock := blockIndex; candidateBlock >= blockIndex-1 && candidateBlock >= 0; candidateBlock-- {
+		if candidateBlock == len(reader.handles) {
+			continue
+		}
+		entries, err := reader.readBlock(candidateBlock)
+		if err != nil {
+			return mvcc.Value{}, false, fmt.Errorf("reading block %d of table %s: %w", candidateBlock, reader.file.Name(), err)
+		}
+		for index := len(entries) - 1; index >= 0; index-- {
+			if entries[index].key.Compare(key) <= 0 {
+				if bytes.Equal(entries[index].key.GetKey(), key.GetKey()) {
+					return entries[index].value, true, nil
+				}
+				return mvcc.Value{}, false, nil
+			}
+		}
+	}
+	return mvcc.Value{}, false, nil
+}
+
+func (reader *Reader) mayContain(key []byte) bool {
+	return bytes.Compare(key, reader.smallestKey.GetKey()) >= 0 &&
+		bytes.Compare(key, reader.LargestKey().GetKey()) <= 0
+}
+
+func (reader *Reader) NewIterator() *Iterator {
+	return &Iterator{reader: reader, blockIndex: -1}
+}
+
+// NewIteratorFrom returns an iterator positioned before the first versioned key whose key is greater than or equal to the given key.
+func (reader *Reader) NewIteratorFrom(key []byte) *Iterator {
+	seekKey := *mvcc.NewVersionedKey(key, 0)
+	blockIndex := sort.Search(len(reader.handles), func(index int) bool {
+		return reader.handles[index].lastKey.Compare(seekKey) >= 0
+	})
+	if blockIndex == len(reader.handles) {
+		return &Iterator{reader: reader, blockIndex: blockIndex - 1, position: -1}
+	}
+	entries, err := reader.readBlock(blockIndex)
+	if err != nil {
+		return &Iterator{reader: reader, err: err}
+	}
+	position := sort.Search(len(entries), func(index int) bool {
+		return entries[index].key.Compare(seekKey) >= 0
+	})
+	return &Iterator{reader: reader, blockIndex: blockIndex, entries: entries, position: position - 1}
+}
+
+// NewReverseIterator returns a ReverseIterator over the keys in [start, end); a nil start or end leaves that side unbounded.
+func (reader *Reader) NewReverseIterator(start, end []byte, version uint64) *ReverseIterator {
+	iterator := &ReverseIterator{reader: reader, start: start, version: version}
+	if end == nil {
+		iterator.blockIndex = len(reader.handles) - 1
+		if iterator.entries, iterator.err = reader.readBlock(iterator.blockIndex); iterator.err == nil {
+			iterator.position = len(iterator.entries)
+		}
+		return iterator
+	}
+	iterator.seekBefore(*mvcc.NewVersionedKey(end, 0))
+	return iterator
+}
+
+func (reader *Reader) SmallestKey() mvcc.VersionedKey {
+	return reader.smallestKey
+}
+
+func (reader *Reader) LargestKey() mvcc.VersionedKey {
+	return reader.handles[len(reader.handles)-1].lastKey
+}
+
+func (reader *Reader) MaxVersion() uint64 {
+	return reader.maxVersion
+}
+
+func (reader *Reader) NumberOfEntries() uint64 {
+	return reader.numberOfEntries
+}
+
+func (reader *Reader) Size() int64 {
+	return reader.size
+}
+
+func (reader *Reader) FilePath() string {
+	return reader.file.Name()
+}
+
+func (reader *Reader) IncrementReference() {
+	reader.references.Add(1)
+}
+
+// DecrementReference releases a reference, closing the table when it was the last one.
+func (reader *Reader) DecrementReference() error {
+	if reader.references.Add(-1) > 0 {
+		return nil
+	}
+	if err := reader.file.Close(); err != nil {
+		return err
+	}
+	if reader.markedForDelete.Load() {
+		return os.Remove(reader.file.Name())
+	}
+	return nil
+}
+
+// MarkForDeletion removes the table file once the last reference is released.
+func (reader *Reader) MarkForDeletion() {
+	reader.markedForDelete.Store(true)
+}
+
+// Close releases the reference held by the opener.
+func (reader *Reader) Close() error {
+	return reader.DecrementReference()
+}
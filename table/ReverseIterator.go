@@ -0,0 +1,81 @@
+package table
+
+import (
+	"IsoTransact/mvcc"
+	"bytes"
+	"sort"
+)
+
+// ReverseIterator walks the versions at or below its version of the keys of a table in [start, end),
+// in the decreasing order of key and version. The blocks are read backwards, one at a time;
+// the newer versions of a key are skipped with a seek rather than walked.
+type ReverseIterator struct {
+	reader     *Reader
+	start      []byte
+	version    uint64
+	blockIndex int
+	entries    []blockEntry
+	position   int
+	err        error
+}
+
+// seekBefore positions the iterator after the last versioned key less than the key.
+func (iterator *ReverseIterator) seekBefore(key mvcc.VersionedKey) {
+	handles := iterator.reader.handles
+	blockIndex := sort.Search(len(handles), func(index int) bool {
+		return handles[index].lastKey.Compare(key) >= 0
+	})
+	if blockIndex == len(handles) {
+		blockIndex--
+	}
+	iterator.blockIndex = blockIndex
+	if iterator.entries, iterator.err = iterator.reader.readBlock(blockIndex); iterator.err != nil {
+		return
+	}
+	iterator.position = sort.Search(len(iterator.entries), func(index int) bool {
+		return iterator.entries[index].key.Compare(key) >= 0
+	})
+}
+
+func (iterator *ReverseIterator) Next() bool {
+	for iterator.err == nil && iterator.previous() {
+		key := iterator.entries[iterator.position].key
+		if iterator.start != nil && bytes.Compare(key.GetKey(), iterator.start) < 0 {
+			return false
+		}
+		if key.GetVersion() <= iterator.version {
+			return true
+		}
+		iterator.seekBefore(*mvcc.NewVersionedKey(key.GetKey(), iterator.version+1))
+	}
+	return false
+}
+
+// previous moves to the preceding entry, reading the preceding block once the current one is walked.
+func (iterator *ReverseIterator) previous() bool {
+	iterator.position--
+	for iterator.position < 0 {
+		if iterator.blockIndex == 0 {
+			return false
+		}
+		iterator.blockIndex--
+		if iterator.entries, iterator.err = iterator.reader.readBlock(iterator.blockIndex); iterator.err != nil {
+			return false
+		}
+		iterator.position = len(iterator.entries) - 1
+	}
+	return true
+}
+
+func (iterator *ReverseIterator) Key() mvcc.VersionedKey {
+	return iterator.entries[iterator.position].key
+}
+
+func (iterator *ReverseIterator) Value() mvcc.Value {
+	return iterator.entries[iterator.position].value
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (iterator *ReverseIterator) Err() error {
+	return iterator.err
+}
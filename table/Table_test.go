@@ -0,0 +1,196 @@
+package table
+
+import (
+	"IsoTransact/mvcc"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func writeTableForTest(t *testing.T, filePath string, blockSize int, numberOfKeys int, versionsPerKey int) {
+	writer, err := NewWriter(filePath, blockSize)
+	assert.Nil(t, err)
+	for count := 1; count <= numberOfKeys; count++ {
+		for version := 1; version <= versionsPerKey; version++ {
+			key := mvcc.NewVersionedKey([]byte("Key:"+strconv.Itoa(1000+count)), uint64(version*10))
+			value := mvcc.NewValue([]byte("Value:" + strconv.Itoa(count) + ":" + strconv.Itoa(version)))
+			assert.Nil(t, writer.Add(*key, value))
+		}
+	}
+	assert.Nil(t, writer.Finish())
+}
+
+func TestGetsTheHighestVersionOfAKeyAtOrBelowTheRequestedVersion(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "000001.sst")
+	writeTableForTest(t, filePath, 64, 100, 3)
+
+	reader, err := Open(filePath)
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	for count := 1; count <= 100; count++ {
+		key := []byte("Key:" + strconv.Itoa(1000+count))
+
+		value, ok, _ := reader.Get(*mvcc.NewVersionedKey(key, 25))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("Value:"+strconv.Itoa(count)+":2"), value.Slice())
+
+		value, ok, _ = reader.Get(*mvcc.NewVersionedKey(key, 30))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("Value:"+strconv.Itoa(count)+":3"), value.Slice())
+
+		_, ok, _ = reader.Get(*mvcc.NewVersionedKey(key, 5))
+		assert.Equal(t, false, ok)
+	}
+}
+
+func TestGetsANonExistingKeyFromATable(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "000001.sst")
+	writeTableForTest(t, filePath, 64, 10, 1)
+
+	reader, err := Open(filePath)
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	_, ok, _ := reader.Get(*mvcc.NewVersionedKey([]byte("Key:1005A"), 100))
+	assert.Equal(t, false, ok)
+
+	_, ok, _ = reader.Get(*mvcc.NewVersionedKey([]byte("Key:2000"), 100))
+	assert.Equal(t, false, ok)
+
+	_, ok, _ = reader.Get(*mvcc.NewVersionedKey([]byte("Key:0001"), 100))
+	assert.Equal(t, false, ok)
+}
+
+func TestIteratesOverAllTheEntriesOfATableInOrder(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "000001.sst")
+	writeTableForTest(t, filePath, 64, 50, 2)
+
+	reader, err := Open(filePath)
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	assert.Equal(t, uint64(100), reader.NumberOfEntries())
+	assert.Equal(t, uint64(20), reader.MaxVersion())
+	assert.Equal(t, []byte("Key:1001"), reader.SmallestKey().GetKey())
+	assert.Equal(t, []byte("Key:1050"), reader.LargestKey().GetKey())
+
+	iterator := reader.NewIterator()
+	var previous *mvcc.VersionedKey
+	count := 0
+	for iterator.Next() {
+		key := iterator.Key()
+		if previous != nil {
+			assert.Equal(t, -1, previous.Compare(key))
+		}
+		previous = &key
+		count++
+	}
+	assert.Nil(t, iterator.Err())
+	assert.Equal(t, 100, count)
+}
+
+func TestIteratesFromTheFirstVersionOfAKey(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "000001.sst")
+	writeTableForTest(t, filePath, 64, 50, 2)
+
+	reader, err := Open(filePath)
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	iterator := reader.NewIteratorFrom([]byte("Key:1020"))
+	assert.Equal(t, true, iterator.Next())
+	assert.Equal(t, *mvcc.NewVersionedKey([]byte("Key:1020"), 10), iterator.Key())
+
+	iterator = reader.NewIteratorFrom([]byte("Key:1020A"))
+	assert.Equal(t, true, iterator.Next())
+	assert.Equal(t, *mvcc.NewVersionedKey([]byte("Key:1021"), 10), iterator.Key())
+
+	count := 0
+	for iterator = reader.NewIteratorFrom([]byte("Key:1049")); iterator.Next(); count++ {
+	}
+	assert.Equal(t, 4, count)
+
+	iterator = reader.NewIteratorFrom([]byte("Key:2000"))
+	assert.Equal(t, false, iterator.Next())
+	assert.Nil(t, iterator.Err())
+}
+
+func TestIteratesBackwardsOverTheVersionsAtOrBelowAVersion(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "000001.sst")
+	writeTableForTest(t, filePath, 64, 50, 3)
+
+	reader, err := Open(filePath)
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	var expected []mvcc.VersionedKey
+	for iterator := reader.NewIterator(); iterator.Next(); {
+		key := iterator.Key()
+		if bytes.Compare(key.GetKey(), []byte("Key:1010")) >= 0 && bytes.Compare(key.GetKey(), []byte("Key:1040")) < 0 && key.GetVersion() <= 20 {
+			expected = append([]mvcc.VersionedKey{key}, expected...)
+		}
+	}
+
+	var keys []mvcc.VersionedKey
+	iterator := reader.NewReverseIterator([]byte("Key:1010"), []byte("Key:1040"), 20)
+	for iterator.Next() {
+		keys = append(keys, iterator.Key())
+	}
+	assert.Nil(t, iterator.Err())
+	assert.Equal(t, 60, len(keys))
+	assert.Equal(t, expected, keys)
+
+	count := 0
+	for iterator = reader.NewReverseIterator(nil, nil, 100); iterator.Next(); count++ {
+	}
+	assert.Equal(t, 150, count)
+}
+
+func TestFailsToOpenATableWithACorruptBlock(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "000001.sst")
+	writeTableForTest(t, filePath, 64, 10, 1)
+
+	contents, err := os.ReadFile(filePath)
+	assert.Nil(t, err)
+	contents[3] = contents[3] ^ 0xFF
+	assert.Nil(t, os.WriteFile(filePath, contents, 0644))
+
+	_, err = Open(filePath)
+	assert.Error(t, err)
+	assert.Equal(t, CorruptTableErr, err)
+}
+
+func TestReturnsTheErrorOfABlockCorruptedAfterOpen(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "000001.sst")
+	writeTableForTest(t, filePath, 64, 10, 1)
+
+	reader, err := Open(filePath)
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.WriteAt([]byte{0xFF, 0xFF}, 3)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	_, ok, err := reader.Get(*mvcc.NewVersionedKey([]byte("Key:1001"), 10))
+	assert.Equal(t, false, ok)
+	assert.ErrorIs(t, err, CorruptTableErr)
+
+	iterator := reader.NewIterator()
+	assert.Equal(t, false, iterator.Next())
+	assert.Equal(t, CorruptTableErr, iterator.Err())
+}
+
+func TestFailsToFinishAnEmptyTable(t *testing.T) {
+	writer, err := NewWriter(filepath.Join(t.TempDir(), "000001.sst"), 64)
+	assert.Nil(t, err)
+
+	assert.Equal(t, EmptyTableErr, writer.Finish())
+	writer.Abort()
+}
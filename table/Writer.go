@@ -0,0 +1,129 @@
+package table
+
+import (
+	"IsoTransact/mvcc"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+const (
+	magicNumber = uint64(0x49736f5472616e73) //"IsoTrans"
+	footerSize  = 8 + 8 + checksumSize + 8   //index offset | index size | checksum | magic number
+)
+
+var EmptyTableErr = errors.New("can not finish a table without entries")
+
+type blockHandle struct {
+	lastKey mvcc.VersionedKey
+	offset  uint64
+	size    uint64
+}
+
+// Writer writes a sorted run of versioned keys as an immutable table:
+// data blocks | index block | footer.
+// The index block holds the properties of the table (smallest key, number of entries, highest version)
+// followed by the last key, offset and size of every data block, and ends with a checksum.
+// The footer holds the offset and size of the index block, their checksum and a magic number.
+type Writer struct {
+	file            *os.File
+	writer          *bufio.Writer
+	blockSize       int
+	offset          uint64
+	block           blockBuilder
+	handles         []blockHandle
+	smallestKey     mvcc.VersionedKey
+	numberOfEntries uint64
+	maxVersion      uint64
+}
+
+func NewWriter(filePath string, blockSize int) (*Writer, error) {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{file: file, writer: bufio.NewWriter(file), blockSize: blockSize}, nil
+}
+
+// Add appends the key/value to the table. The keys must be added in the increasing order.
+func (writer *Writer) Add(key mvcc.VersionedKey, value mvcc.Value) error {
+	if writer.numberOfEntries == 0 {
+		writer.smallestKey = key
+	}
+	writer.block.add(key, value)
+	writer.numberOfEntries++
+	if key.GetVersion() > writer.maxVersion {
+		writer.maxVersion = key.GetVersion()
+	}
+	if writer.block.size() >= writer.blockSize {
+		return writer.flushBlock()
+	}
+	return nil
+}
+
+// EstimatedSize returns the number of bytes written so far, including the block being built.
+func (writer *Writer) EstimatedSize() int64 {
+	return int64(writer.offset) + int64(writer.block.size())
+}
+
+func (writer *Writer) flushBlock() error {
+	lastKey := writer.block.lastKey
+	block := writer.block.finish()
+	if _, err := writer.writer.Write(block); err != nil {
+		return err
+	}
+	writer.handles = append(writer.handles, blockHandle{lastKey: lastKey, offset: writer.offset, size: uint64(len(block))})
+	writer.offset = writer.offset + uint64(len(block))
+	return nil
+}
+
+// Finish writes the index block and the footer, syncs and closes the file.
+func (writer *Writer) Finish() error {
+	if writer.numberOfEntries == 0 {
+		return EmptyTableErr
+	}
+	if !writer.block.isEmpty() {
+		if err := writer.flushBlock(); err != nil {
+			return err
+		}
+	}
+	index := writer.encodeIndex()
+	if _, err := writer.writer.Write(index); err != nil {
+		return err
+	}
+
+	footer := binary.BigEndian.AppendUint64(nil, writer.offset)
+	footer = binary.BigEndian.AppendUint64(footer, uint64(len(index)))
+	footer = withChecksum(footer)
+	footer = binary.BigEndian.AppendUint64(footer, magicNumber)
+	if _, err := writer.writer.Write(footer); err != nil {
+		return err
+	}
+	if err := writer.writer.Flush(); err != nil {
+		return err
+	}
+	if err := writer.file.Sync(); err != nil {
+		return err
+	}
+	return writer.file.Close()
+}
+
+// Abort closes and removes the partially written table.
+func (writer *Writer) Abort() {
+	_ = writer.file.Close()
+	_ = os.Remove(writer.file.Name())
+}
+
+func (writer *Writer) encodeIndex() []byte {
+	index := appendVersionedKey(nil, writer.smallestKey)
+	index = binary.AppendUvarint(index, writer.numberOfEntries)
+	index = binary.BigEndian.AppendUint64(index, writer.maxVersion)
+	index = binary.AppendUvarint(index, uint64(len(writer.handles)))
+	for _, handle := range writer.handles {
+		index = appendVersionedKey(index, handle.lastKey)
+		index = binary.AppendUvarint(index, handle.offset)
+		index = binary.AppendUvarint(index, handle.size)
+	}
+	return withChecksum(index)
+}
@@ -1,16 +1,19 @@
 package txn
 
 import (
+	"IsoTransact/mvcc"
+	errors2 "IsoTransact/txn/errors"
 	"bytes"
-	"errors"
+	"sort"
 )
 
 type KeyValuePair struct {
-	key   []byte
-	value []byte
+	key     []byte
+	value   mvcc.Value
+	pending []*Operation //executed in order against the committed value of the key when the batch is applied, the value is unknown till then
 }
 
-func newKeyValuePair(key []byte, value []byte) *KeyValuePair {
+func newKeyValuePair(key []byte, value mvcc.Value) *KeyValuePair {
 	return &KeyValuePair{key: key, value: value}
 }
 
@@ -18,58 +21,255 @@ func (pair KeyValuePair) getKey() []byte {
 	return pair.key
 }
 
-func (pair KeyValuePair) getValue() []byte {
+func (pair KeyValuePair) getValue() mvcc.Value {
 	return pair.value
 }
 
+// visible returns the value the transaction reads for the key, which is unknown while an operation is pending,
+// unless a PutOrUpdate or a Delete follows it.
+func (pair KeyValuePair) visible() (mvcc.Value, bool) {
+	if len(pair.pending) == 0 {
+		return pair.value, true
+	}
+	last := pair.pending[len(pair.pending)-1]
+	return last.operand, last.kind == write
+}
+
+// resolve executes the pending operations against the committed value of the key, and returns the value to write
+// along with false if none of the operations wrote the key.
+func (pair KeyValuePair) resolve(committed mvcc.Value) (mvcc.Value, bool, error) {
+	current, changed := committed, false
+	for _, operation := range pair.pending {
+		var wrote bool
+		var err error
+		if current, wrote, err = operation.execute(current); err != nil {
+			return mvcc.Value{}, false, err
+		}
+		changed = changed || wrote
+	}
+	return current, changed, nil
+}
+
+const (
+	//DefaultMaxBatchPairs is the number of keys a transaction can write by default
+	DefaultMaxBatchPairs = 100_000
+	//DefaultMaxBatchBytes is the number of bytes of keys and values a transaction can write by default
+	DefaultMaxBatchBytes = 16 << 20
+)
+
+// Batch holds the writes of a transaction, at most one per key: a later write to a key replaces the earlier one.
+// The pairs are indexed by key for the lookups, and sorted by key, lazily, for the range scans and the apply.
 type Batch struct {
-	pairs []KeyValuePair
+	pairs      []KeyValuePair //in the order of the first write of every key
+	index      map[string]int //key -> position in pairs
+	sorted     []int          //positions in pairs in the increasing order of keys, nil once a new key is added
+	operations []*Operation   //in the order they are added, finished once the commit is applied or fails
+	bytes      int64
+	maxPairs   int
+	maxBytes   int64
 }
 
 func NewBatch() *Batch {
-	return &Batch{}
+	return NewBatchWithLimits(DefaultMaxBatchPairs, DefaultMaxBatchBytes)
 }
 
-func (batch *Batch) Get(key []byte) ([]byte, bool) {
-	for _, pair := range batch.pairs {
-		if bytes.Compare(pair.key, key) == 0 {
-			return pair.value, true
-		}
+// NewBatchWithLimits creates a batch that refuses, with errors.TransactionTooLargeErr, a write beyond maxPairs keys
+// or maxBytes bytes of keys and values.
+func NewBatchWithLimits(maxPairs int, maxBytes int64) *Batch {
+	return &Batch{index: make(map[string]int), maxPairs: maxPairs, maxBytes: maxBytes}
+}
+
+// Get returns the value written for the key in the batch, which is a tombstone if the key is deleted in the batch.
+// A key whose value waits for an operation executed at apply time is not found.
+func (batch *Batch) Get(key []byte) (mvcc.Value, bool) {
+	position, ok := batch.index[string(key)]
+	if !ok {
+		return mvcc.Value{}, false
 	}
-	return nil, false
+	return batch.pairs[position].visible()
 }
 
 func (batch *Batch) Contains(key []byte) bool {
-	_, ok := batch.Get(key)
+	_, ok := batch.index[string(key)]
 	return ok
 }
 
 func (batch *Batch) Add(key, value []byte) error {
-	if batch.Contains(key) {
-		return errors.New("batch already contains the key")
+	return batch.add(key, mvcc.NewValue(value))
+}
+
+// Delete adds a tombstone for the key.
+func (batch *Batch) Delete(key []byte) error {
+	return batch.add(key, mvcc.NewTombstone())
+}
+
+// add writes the value of the key, replacing the value of an earlier write to the key.
+// A write that takes the batch beyond its limits is refused and leaves the batch as it was.
+func (batch *Batch) add(key []byte, value mvcc.Value) error {
+	position, ok := batch.index[string(key)]
+	if ok && len(batch.pairs[position].pending) > 0 {
+		//the pending operations are executed before the write, their results still count
+		return batch.addPending(position, newWrite(value))
+	}
+	if ok {
+		batchBytes := batch.bytes - int64(len(batch.pairs[position].value.Slice())) + int64(len(value.Slice()))
+		if batchBytes > batch.maxBytes {
+			return errors2.TransactionTooLargeErr
+		}
+		batch.pairs[position].value = value
+		batch.bytes = batchBytes
+		return nil
 	}
 
+	batchBytes := batch.bytes + int64(len(key)+len(value.Slice()))
+	if len(batch.pairs)+1 > batch.maxPairs || batchBytes > batch.maxBytes {
+		return errors2.TransactionTooLargeErr
+	}
+	batch.index[string(key)] = len(batch.pairs)
 	batch.pairs = append(batch.pairs, *newKeyValuePair(key, value))
+	batch.bytes = batchBytes
+	batch.sorted = nil
+	return nil
+}
+
+// addOperation adds the read-modify-write of the key. It is executed right away against a value written earlier
+// in the batch, or else when the batch is applied. A write that takes the batch beyond its limits is refused.
+func (batch *Batch) addOperation(key []byte, operation *Operation) error {
+	position, ok := batch.index[string(key)]
+	switch {
+	case ok && len(batch.pairs[position].pending) > 0:
+		if err := batch.addPending(position, operation); err != nil {
+			return err
+		}
+	case ok && batch.pairs[position].value.IsMergeOperand():
+		//the operand is merged onto the committed value first
+		if err := batch.addPending(position, newMerge(batch.pairs[position].value), operation); err != nil {
+			return err
+		}
+	case ok:
+		value, wrote, err := operation.execute(batch.pairs[position].value)
+		if err != nil {
+			return err
+		}
+		if wrote {
+			if err := batch.add(key, value); err != nil {
+				return err
+			}
+		}
+	default:
+		batchBytes := batch.bytes + int64(len(key)) + operation.operandBytes()
+		if len(batch.pairs)+1 > batch.maxPairs || batchBytes > batch.maxBytes {
+			return errors2.TransactionTooLargeErr
+		}
+		batch.index[string(key)] = len(batch.pairs)
+		batch.pairs = append(batch.pairs, KeyValuePair{key: key, pending: []*Operation{operation}})
+		batch.bytes = batchBytes
+		batch.sorted = nil
+	}
+	batch.operations = append(batch.operations, operation)
 	return nil
 }
 
+func (batch *Batch) addPending(position int, operations ...*Operation) error {
+	batchBytes := batch.bytes
+	for _, operation := range operations {
+		batchBytes = batchBytes + operation.operandBytes()
+	}
+	if batchBytes > batch.maxBytes {
+		return errors2.TransactionTooLargeErr
+	}
+	batch.pairs[position].pending = append(batch.pairs[position].pending, operations...)
+	batch.bytes = batchBytes
+	return nil
+}
+
+// Merge adds the merge operand of the key. It is merged right away onto a value written earlier in the batch, be it an operand
+// of the same operator; else it is executed against the committed value when the batch is applied.
+// The operand of a key not written earlier is written as is, and merged by the readers.
+func (batch *Batch) Merge(key []byte, operand mvcc.Value) error {
+	position, ok := batch.index[string(key)]
+	if !ok {
+		return batch.add(key, operand)
+	}
+	if len(batch.pairs[position].pending) > 0 {
+		return batch.addPending(position, newMerge(operand))
+	}
+	if merged, mergeable := mvcc.MergeOnto(batch.pairs[position].value, operand); mergeable {
+		return batch.add(key, merged)
+	}
+	return batch.addPending(position, newMerge(batch.pairs[position].value), newMerge(operand))
+}
+
+// finishOperations publishes the results of the operations, or the error of the commit that failed; it is a no-op the second time.
+func (batch *Batch) finishOperations(err error) {
+	for _, operation := range batch.operations {
+		operation.finish(err)
+	}
+	batch.operations = nil
+}
+
+// sortedPositions returns the positions of the pairs in the increasing order of keys.
+func (batch *Batch) sortedPositions() []int {
+	if batch.sorted == nil {
+		batch.sorted = make([]int, len(batch.pairs))
+		for position := range batch.pairs {
+			batch.sorted[position] = position
+		}
+		sort.Slice(batch.sorted, func(i, j int) bool {
+			return bytes.Compare(batch.pairs[batch.sorted[i]].key, batch.pairs[batch.sorted[j]].key) < 0
+		})
+	}
+	return batch.sorted
+}
+
+// firstSortedAtOrAfter returns the index, in sortedPositions, of the first key at or after the start; a nil start is the smallest key.
+func (batch *Batch) firstSortedAtOrAfter(start []byte) int {
+	sorted := batch.sortedPositions()
+	return sort.Search(len(sorted), func(index int) bool {
+		return bytes.Compare(batch.pairs[sorted[index]].key, start) >= 0
+	})
+}
+
+// pairsInRange returns the pairs whose keys are in [start, end), in the increasing order of keys.
+func (batch *Batch) pairsInRange(start, end []byte) []KeyValuePair {
+	var pairs []KeyValuePair
+	sorted := batch.sortedPositions()
+	for index := batch.firstSortedAtOrAfter(start); index < len(sorted) && inRange(batch.pairs[sorted[index]].key, start, end); index++ {
+		pairs = append(pairs, batch.pairs[sorted[index]])
+	}
+	return pairs
+}
+
+// visiblePairsInRange returns the pairs in [start, end) with the values the transaction reads (see Get), in the increasing order of keys.
+func (batch *Batch) visiblePairsInRange(start, end []byte) []KeyValuePair {
+	var pairs []KeyValuePair
+	for _, pair := range batch.pairsInRange(start, end) {
+		if value, ok := pair.visible(); ok {
+			pairs = append(pairs, *newKeyValuePair(pair.key, value))
+		}
+	}
+	return pairs
+}
+
 func (batch *Batch) IsEmpty() bool {
 	return len(batch.pairs) == 0
 }
 
+// AllPairs returns the pairs of the batch in the increasing order of keys; the pairs with pending operations are not resolved.
 func (timestampedBatch TimestampedBatch) AllPairs() []KeyValuePair {
-	return timestampedBatch.batch.pairs
+	return timestampedBatch.batch.pairsInRange(nil, nil)
 }
 
 func (timestampedBatch TimestampedBatch) getCommitCallback() func() {
 	return timestampedBatch.commitCallback
 }
 
-func (batch *Batch) ToTimestampedBatch(commitTimestamp uint64, commitCallback func()) TimestampedBatch {
+func (batch *Batch) ToTimestampedBatch(commitTimestamp uint64, requireSync bool, commitCallback func()) TimestampedBatch {
 	return TimestampedBatch{
 		batch:          batch,
 		timestamp:      commitTimestamp,
-		doneChannel:    make(chan struct{}),
+		requireSync:    requireSync,
+		doneChannel:    make(chan error, 1),
 		commitCallback: commitCallback,
 	}
 }
@@ -77,6 +277,9 @@ func (batch *Batch) ToTimestampedBatch(commitTimestamp uint64, commitCallback fu
 type TimestampedBatch struct {
 	batch          *Batch
 	timestamp      uint64
-	doneChannel    chan struct{}
+	requireSync    bool
+	doneChannel    chan error
 	commitCallback func()
+	resolved       []KeyValuePair //the pairs with the pending operations executed, set by the executor before the batch is logged
+	err            error          //the failure to execute the pending operations, which fails the batch alone
 }
@@ -0,0 +1,66 @@
+package txn
+
+import (
+	"IsoTransact/txn/errors"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func keysOfPairs(pairs []KeyValuePair) []string {
+	var keys []string
+	for _, pair := range pairs {
+		keys = append(keys, string(pair.getKey()))
+	}
+	return keys
+}
+
+func TestOverwritesTheValueOfAKeyInTheBatch(t *testing.T) {
+	batch := NewBatch()
+	assert.Nil(t, batch.Add([]byte("HDD"), []byte("Hard disk")))
+	assert.Nil(t, batch.Add([]byte("HDD"), []byte("Hard disk drive")))
+
+	value, ok := batch.Get([]byte("HDD"))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+
+	assert.Nil(t, batch.Delete([]byte("HDD")))
+	value, _ = batch.Get([]byte("HDD"))
+	assert.Equal(t, true, value.IsTombstone())
+	assert.Equal(t, 1, len(batch.ToTimestampedBatch(1, false, func() {}).AllPairs()))
+}
+
+func TestGivesThePairsOfTheBatchInTheIncreasingOrderOfKeys(t *testing.T) {
+	batch := NewBatch()
+	for _, key := range []string{"SSD", "HDD", "NVMe", "CD"} {
+		assert.Nil(t, batch.Add([]byte(key), []byte(key)))
+	}
+	assert.Equal(t, []string{"CD", "HDD", "NVMe", "SSD"}, keysOfPairs(batch.ToTimestampedBatch(1, false, func() {}).AllPairs()))
+	assert.Equal(t, []string{"HDD", "NVMe"}, keysOfPairs(batch.pairsInRange([]byte("D"), []byte("SSD"))))
+
+	assert.Nil(t, batch.Add([]byte("Floppy"), []byte("Floppy")))
+	assert.Equal(t, []string{"CD", "Floppy", "HDD"}, keysOfPairs(batch.pairsInRange(nil, []byte("I"))))
+}
+
+func TestRefusesAWriteBeyondTheLimitsOfTheBatch(t *testing.T) {
+	batch := NewBatchWithLimits(2, 33)
+	assert.Nil(t, batch.Add([]byte("HDD"), []byte("Hard disk")))
+	assert.Nil(t, batch.Add([]byte("SSD"), []byte("Solid state")))
+	assert.Equal(t, errors.TransactionTooLargeErr, batch.Add([]byte("CD"), []byte("Compact disc")))
+
+	//an overwrite adds no key, but it adds bytes
+	assert.Nil(t, batch.Add([]byte("HDD"), []byte("Hard disk drive")))
+	assert.Equal(t, errors.TransactionTooLargeErr, batch.Add([]byte("SSD"), []byte("Solid state drive")))
+
+	value, _ := batch.Get([]byte("SSD"))
+	assert.Equal(t, []byte("Solid state"), value.Slice())
+}
+
+func BenchmarkAddsKeysToTheBatch(b *testing.B) {
+	for count := 0; count < b.N; count++ {
+		batch := NewBatch()
+		for key := 0; key < 1000; key++ {
+			_ = batch.Add([]byte("Key:"+strconv.Itoa(key)), []byte("Value"))
+		}
+	}
+}
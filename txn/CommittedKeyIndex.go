@@ -0,0 +1,180 @@
+package txn
+
+import (
+	"bytes"
+	"math/rand"
+)
+
+// committedKeyIndex holds the keys written by the committed transactions the oracle keeps, in the increasing order of keys,
+// along with the last commit timestamp of every key. It is a treap whose nodes know the highest commit timestamp below them,
+// so that the last commit of the keys in a range is found in the time of a seek, whatever the number of the committed keys.
+type committedKeyIndex struct {
+	root *committedKeyNode
+}
+
+type committedKeyNode struct {
+	key             []byte
+	commitTimestamp uint64
+	maxTimestamp    uint64 //the highest commit timestamp of the node and the nodes below it
+	priority        uint64
+	left, right     *committedKeyNode
+}
+
+func newCommittedKeyIndex() *committedKeyIndex {
+	return &committedKeyIndex{}
+}
+
+// put records a commit of the key, the commit timestamps of a key only increase.
+func (index *committedKeyIndex) put(key []byte, commitTimestamp uint64) {
+	less, rest := index.root.split(key)
+	equal, greater := rest.splitAfter(key)
+	if equal == nil {
+		equal = &committedKeyNode{key: key, priority: rand.Uint64()}
+	}
+	equal.commitTimestamp = commitTimestamp
+	equal.update()
+	index.root = less.join(equal).join(greater)
+}
+
+// remove forgets the key if its last commit is at the commit timestamp.
+func (index *committedKeyIndex) remove(key []byte, commitTimestamp uint64) {
+	less, rest := index.root.split(key)
+	equal, greater := rest.splitAfter(key)
+	if equal != nil && equal.commitTimestamp != commitTimestamp {
+		greater = equal.join(greater)
+	}
+	index.root = less.join(greater)
+}
+
+// lastCommitTimestamp returns the commit timestamp of the key, 0 if the key is not in the index.
+func (index *committedKeyIndex) lastCommitTimestamp(key []byte) uint64 {
+	node := index.root
+	for node != nil {
+		switch comparison := bytes.Compare(key, node.key); {
+		case comparison < 0:
+			node = node.left
+		case comparison > 0:
+			node = node.right
+		default:
+			return node.commitTimestamp
+		}
+	}
+	return 0
+}
+
+// lastCommitTimestampIn returns the highest commit timestamp of the keys in [start, end), 0 if there is no such key;
+// a nil start or end leaves that side unbounded.
+func (index *committedKeyIndex) lastCommitTimestampIn(start, end []byte) uint64 {
+	node := index.root
+	for node != nil {
+		switch {
+		case bytes.Compare(node.key, start) < 0:
+			node = node.right
+		case end != nil && bytes.Compare(node.key, end) >= 0:
+			node = node.left
+		default:
+			//the node is in the range, its left subtree is bounded by the end and its right one by the start
+			return maxOf(node.commitTimestamp, maxOf(node.left.maxAtOrAfter(start), node.right.maxBefore(end)))
+		}
+	}
+	return 0
+}
+
+func (node *committedKeyNode) maxAtOrAfter(start []byte) uint64 {
+	timestamp := uint64(0)
+	for node != nil {
+		if bytes.Compare(node.key, start) >= 0 {
+			timestamp = maxOf(timestamp, maxOf(node.commitTimestamp, node.right.max()))
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	return timestamp
+}
+
+func (node *committedKeyNode) maxBefore(end []byte) uint64 {
+	if end == nil {
+		return node.max()
+	}
+	timestamp := uint64(0)
+	for node != nil {
+		if bytes.Compare(node.key, end) < 0 {
+			timestamp = maxOf(timestamp, maxOf(node.commitTimestamp, node.left.max()))
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+	return timestamp
+}
+
+func (node *committedKeyNode) max() uint64 {
+	if node == nil {
+		return 0
+	}
+	return node.maxTimestamp
+}
+
+func (node *committedKeyNode) update() {
+	node.maxTimestamp = maxOf(node.commitTimestamp, maxOf(node.left.max(), node.right.max()))
+}
+
+// split splits the treap into the keys less than the key, and the rest.
+func (node *committedKeyNode) split(key []byte) (*committedKeyNode, *committedKeyNode) {
+	if node == nil {
+		return nil, nil
+	}
+	if bytes.Compare(node.key, key) < 0 {
+		less, rest := node.right.split(key)
+		node.right = less
+		node.update()
+		return node, rest
+	}
+	less, rest := node.left.split(key)
+	node.left = rest
+	node.update()
+	return less, node
+}
+
+// splitAfter splits the treap into the keys less than or equal to the key, and the rest.
+func (node *committedKeyNode) splitAfter(key []byte) (*committedKeyNode, *committedKeyNode) {
+	if node == nil {
+		return nil, nil
+	}
+	if bytes.Compare(node.key, key) <= 0 {
+		lessOrEqual, greater := node.right.splitAfter(key)
+		node.right = lessOrEqual
+		node.update()
+		return node, greater
+	}
+	lessOrEqual, greater := node.left.splitAfter(key)
+	node.left = greater
+	node.update()
+	return lessOrEqual, node
+}
+
+// join joins two treaps, all the keys of the node's one being less than the keys of the right one.
+func (node *committedKeyNode) join(right *committedKeyNode) *committedKeyNode {
+	if node == nil {
+		return right
+	}
+	if right == nil {
+		return node
+	}
+	if node.priority > right.priority {
+		node.right = node.right.join(right)
+		node.update()
+		return node
+	}
+	right.left = node.join(right.left)
+	right.update()
+	return right
+}
+
+func maxOf(first, second uint64) uint64 {
+	if first > second {
+		return first
+	}
+	return second
+}
@@ -0,0 +1,69 @@
+package txn
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestGetsTheLastCommitTimestampOfTheKeysInARange(t *testing.T) {
+	index := newCommittedKeyIndex()
+	index.put([]byte("HDD"), 3)
+	index.put([]byte("NVMe"), 5)
+	index.put([]byte("SSD"), 4)
+	index.put([]byte("HDD"), 6)
+
+	assert.Equal(t, uint64(6), index.lastCommitTimestampIn(nil, nil))
+	assert.Equal(t, uint64(6), index.lastCommitTimestampIn([]byte("HDD"), []byte("NVMe")))
+	assert.Equal(t, uint64(5), index.lastCommitTimestampIn([]byte("I"), nil))
+	assert.Equal(t, uint64(4), index.lastCommitTimestampIn([]byte("O"), []byte("T")))
+	assert.Equal(t, uint64(0), index.lastCommitTimestampIn([]byte("T"), nil))
+	assert.Equal(t, uint64(0), index.lastCommitTimestampIn(nil, []byte("HDD")))
+}
+
+func TestForgetsAKeyOnlyAtItsLastCommitTimestamp(t *testing.T) {
+	index := newCommittedKeyIndex()
+	index.put([]byte("HDD"), 3)
+	index.put([]byte("HDD"), 6)
+
+	index.remove([]byte("HDD"), 3)
+	assert.Equal(t, uint64(6), index.lastCommitTimestamp([]byte("HDD")))
+
+	index.remove([]byte("HDD"), 6)
+	assert.Equal(t, uint64(0), index.lastCommitTimestamp([]byte("HDD")))
+	assert.Equal(t, uint64(0), index.lastCommitTimestampIn(nil, nil))
+}
+
+func TestGetsTheSameLastCommitTimestampsAsAScanOfTheKeys(t *testing.T) {
+	random := rand.New(rand.NewSource(7))
+	index := newCommittedKeyIndex()
+	lastCommits := make(map[string]uint64)
+	keyOf := func() []byte {
+		return []byte("Key:" + strconv.Itoa(random.Intn(200)))
+	}
+
+	for timestamp := uint64(1); timestamp <= 2000; timestamp++ {
+		key := keyOf()
+		if random.Intn(4) == 0 {
+			index.remove(key, lastCommits[string(key)])
+			delete(lastCommits, string(key))
+		} else {
+			index.put(key, timestamp)
+			lastCommits[string(key)] = timestamp
+		}
+
+		start, end := keyOf(), keyOf()
+		if bytes.Compare(start, end) > 0 {
+			start, end = end, start
+		}
+		expected := uint64(0)
+		for key, lastCommit := range lastCommits {
+			if inRange([]byte(key), start, end) && lastCommit > expected {
+				expected = lastCommit
+			}
+		}
+		assert.Equal(t, expected, index.lastCommitTimestampIn(start, end))
+	}
+}
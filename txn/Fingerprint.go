@@ -0,0 +1,14 @@
+package txn
+
+// fingerprint hashes the key to 64 bits with FNV-1a. Two keys with the same fingerprint are taken for the same key
+// by the conflict detection, which at worst fails a transaction that did not conflict.
+func fingerprint(key []byte) uint64 {
+	const offsetBasis, prime = 14695981039346656037, 1099511628211
+
+	hash := uint64(offsetBasis)
+	for _, b := range key {
+		hash = hash ^ uint64(b)
+		hash = hash * prime
+	}
+	return hash
+}
@@ -0,0 +1,44 @@
+package txn
+
+import (
+	"IsoTransact/mvcc"
+)
+
+// KeyVersion is a version of a key, as returned by ReadOnlyTransaction.History.
+type KeyVersion struct {
+	CommitTimestamp uint64
+	//Value is a tombstone (see mvcc.Value.IsTombstone) for the version that deleted the key,
+	//and a merge operand, as written, for the version that merged into the key (see mvcc.Value.IsMergeOperand)
+	Value mvcc.Value
+}
+
+// history returns, newest first, up to limit versions of the key at or below the timestamp; a limit of 0 or less returns all of them.
+func history(engine mvcc.StorageEngine, key []byte, timestamp uint64, limit int) ([]KeyVersion, error) {
+	//the smallest key greater than the key, so that the range holds the versions of the key only
+	end := append(append([]byte{}, key...), 0)
+	iterator := engine.NewRangeIterator(key, end)
+	defer iterator.Close()
+
+	var versions []KeyVersion
+	for iterator.Next() {
+		version := iterator.Key().GetVersion()
+		if version > timestamp {
+			break
+		}
+		//the same version may be read from more than one source of the engine
+		if len(versions) > 0 && versions[len(versions)-1].CommitTimestamp == version {
+			continue
+		}
+		versions = append(versions, KeyVersion{CommitTimestamp: version, Value: iterator.Value()})
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, err
+	}
+	for left, right := 0, len(versions)-1; left < right; left, right = left+1, right-1 {
+		versions[left], versions[right] = versions[right], versions[left]
+	}
+	if limit > 0 && len(versions) > limit {
+		versions = versions[:limit]
+	}
+	return versions, nil
+}
@@ -0,0 +1,67 @@
+package txn
+
+import (
+	"IsoTransact/lsm"
+	"IsoTransact/mvcc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func valuesOf(versions []KeyVersion) []string {
+	var values []string
+	for _, version := range versions {
+		if version.Value.IsTombstone() {
+			values = append(values, "<deleted>")
+			continue
+		}
+		values = append(values, string(version.Value.Slice()))
+	}
+	return values
+}
+
+func TestReturnsTheHistoryOfAKeyNewestFirst(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		_ = transaction.PutOrUpdate([]byte("HDD0"), []byte("Not the key"))
+	})
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.Delete([]byte("HDD"))
+	})
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+	})
+
+	transaction := NewReadOnlyTransaction(oracle)
+	defer transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	versions, err := transaction.History([]byte("HDD"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Hard disk drive", "<deleted>", "Hard disk"}, valuesOf(versions))
+	assert.Equal(t, []uint64{3, 2, 1}, []uint64{versions[0].CommitTimestamp, versions[1].CommitTimestamp, versions[2].CommitTimestamp})
+
+	versions, _ = transaction.History([]byte("HDD"), 2)
+	assert.Equal(t, []string{"Hard disk drive", "<deleted>"}, valuesOf(versions))
+	versions, _ = transaction.History([]byte("SSD"), 0)
+	assert.Equal(t, 0, len(versions))
+}
+
+func TestHidesTheVersionsNewerThanTheSnapshotFromTheHistory(t *testing.T) {
+	oracle := NewOracle(NewDurableTransactionExecutor(lsm.NewInMemoryTree(mvcc.NewMemTable(10)), nil))
+	defer oracle.Stop()
+
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	snapshot := NewReadOnlyTransaction(oracle)
+	defer snapshot.FinishBeginTimestampForReadonlyTransaction()
+
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+	})
+	versions, err := snapshot.History([]byte("HDD"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Hard disk"}, valuesOf(versions))
+}
@@ -0,0 +1,14 @@
+package txn
+
+// IsolationLevel decides which concurrent commits make a ReadWriteTransaction fail with errors.ConflictErr.
+type IsolationLevel uint8
+
+const (
+	// Serializable tracks the keys and the ranges read by a transaction, and fails its commit if a transaction
+	// that committed after it began wrote into any of them. It prevents lost updates, write skew and the read-only anomaly.
+	Serializable IsolationLevel = iota
+	// SnapshotIsolation does not track the reads, and fails the commit of a transaction only if a transaction
+	// that committed after it began wrote any of the keys it writes. It prevents lost updates,
+	// but allows write skew and the read-only anomaly.
+	SnapshotIsolation
+)
@@ -0,0 +1,136 @@
+package txn
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/txn/errors"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func newOracleForIsolationTest(t *testing.T, isolationLevel IsolationLevel) *Oracle {
+	oracle := NewOracleWithIsolationLevel(NewTransactionExecutor(mvcc.NewMemTable(10)), isolationLevel)
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("Checking"), []byte("70"))
+		_ = transaction.PutOrUpdate([]byte("Savings"), []byte("80"))
+	})
+	return oracle
+}
+
+func balanceOf(getter func(key []byte) (mvcc.Value, bool), account string) int {
+	value, _ := getter([]byte(account))
+	balance, _ := strconv.Atoi(string(value.Slice()))
+	return balance
+}
+
+func commitAndWait(transaction *ReadWriteTransaction) error {
+	doneChannel, err := transaction.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+	return <-doneChannel
+}
+
+// lostUpdate runs two transactions that both read the balance of Checking and deposit into it.
+func lostUpdate(oracle *Oracle) (error, error) {
+	aTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction := NewReadWriteTransaction(oracle)
+
+	_ = aTransaction.PutOrUpdate([]byte("Checking"), []byte(strconv.Itoa(balanceOf(aTransaction.Get, "Checking")+10)))
+	_ = anotherTransaction.PutOrUpdate([]byte("Checking"), []byte(strconv.Itoa(balanceOf(anotherTransaction.Get, "Checking")+20)))
+
+	return commitAndWait(aTransaction), commitAndWait(anotherTransaction)
+}
+
+// writeSkew runs two transactions that each withdraw 100 from a different account, after checking that the sum
+// of both the balances stays non-negative.
+func writeSkew(oracle *Oracle) (error, error) {
+	aTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction := NewReadWriteTransaction(oracle)
+
+	if balanceOf(aTransaction.Get, "Checking")+balanceOf(aTransaction.Get, "Savings") >= 100 {
+		_ = aTransaction.PutOrUpdate([]byte("Checking"), []byte(strconv.Itoa(balanceOf(aTransaction.Get, "Checking")-100)))
+	}
+	if balanceOf(anotherTransaction.Get, "Checking")+balanceOf(anotherTransaction.Get, "Savings") >= 100 {
+		_ = anotherTransaction.PutOrUpdate([]byte("Savings"), []byte(strconv.Itoa(balanceOf(anotherTransaction.Get, "Savings")-100)))
+	}
+	return commitAndWait(aTransaction), commitAndWait(anotherTransaction)
+}
+
+// readOnlyAnomaly runs the read-only anomaly of Fekete et al.: a withdrawal from Checking that charges a fee of 1 if the sum
+// of the balances goes negative, a deposit of 20 into Savings that commits first, and a read-only transaction that
+// observes the deposit but not the withdrawal. It returns the error of the withdrawal and the balances read.
+func readOnlyAnomaly(oracle *Oracle) (error, int, int) {
+	withdrawal := NewReadWriteTransaction(oracle)
+	checking, savings := balanceOf(withdrawal.Get, "Checking"), balanceOf(withdrawal.Get, "Savings")
+
+	deposit := NewReadWriteTransaction(oracle)
+	_ = deposit.PutOrUpdate([]byte("Savings"), []byte(strconv.Itoa(balanceOf(deposit.Get, "Savings")+20)))
+	_ = commitAndWait(deposit)
+
+	reader := NewReadOnlyTransaction(oracle)
+	checkingRead, savingsRead := balanceOf(reader.Get, "Checking"), balanceOf(reader.Get, "Savings")
+
+	newChecking := checking - 160
+	if newChecking+savings < 0 {
+		newChecking = newChecking - 1
+	}
+	_ = withdrawal.PutOrUpdate([]byte("Checking"), []byte(strconv.Itoa(newChecking)))
+	return commitAndWait(withdrawal), checkingRead, savingsRead
+}
+
+func TestPreventsALostUpdateUnderSnapshotIsolation(t *testing.T) {
+	err, anotherErr := lostUpdate(newOracleForIsolationTest(t, SnapshotIsolation))
+	assert.Nil(t, err)
+	assert.Equal(t, errors.ConflictErr, anotherErr)
+}
+
+func TestPreventsALostUpdateUnderSerializable(t *testing.T) {
+	err, anotherErr := lostUpdate(newOracleForIsolationTest(t, Serializable))
+	assert.Nil(t, err)
+	assert.Equal(t, errors.ConflictErr, anotherErr)
+}
+
+func TestAllowsAWriteSkewUnderSnapshotIsolation(t *testing.T) {
+	oracle := newOracleForIsolationTest(t, SnapshotIsolation)
+	err, anotherErr := writeSkew(oracle)
+	assert.Nil(t, err)
+	assert.Nil(t, anotherErr)
+
+	reader := NewReadOnlyTransaction(oracle)
+	assert.Equal(t, -50, balanceOf(reader.Get, "Checking")+balanceOf(reader.Get, "Savings"))
+}
+
+func TestPreventsAWriteSkewUnderSerializable(t *testing.T) {
+	oracle := newOracleForIsolationTest(t, Serializable)
+	err, anotherErr := writeSkew(oracle)
+	assert.Nil(t, err)
+	assert.Equal(t, errors.ConflictErr, anotherErr)
+
+	reader := NewReadOnlyTransaction(oracle)
+	assert.Equal(t, 50, balanceOf(reader.Get, "Checking")+balanceOf(reader.Get, "Savings"))
+}
+
+func TestAllowsTheReadOnlyAnomalyUnderSnapshotIsolation(t *testing.T) {
+	err, checking, savings := readOnlyAnomaly(newOracleForIsolationTest(t, SnapshotIsolation))
+	//the reader saw the deposit and no withdrawal, yet the withdrawal commits with a fee that no serial order explains
+	assert.Nil(t, err)
+	assert.Equal(t, 70, checking)
+	assert.Equal(t, 100, savings)
+}
+
+func TestPreventsTheReadOnlyAnomalyUnderSerializable(t *testing.T) {
+	err, _, _ := readOnlyAnomaly(newOracleForIsolationTest(t, Serializable))
+	assert.Equal(t, errors.ConflictErr, err)
+}
+
+func TestDoesNotTrackTheReadsUnderSnapshotIsolation(t *testing.T) {
+	oracle := newOracleForIsolationTest(t, SnapshotIsolation)
+	transaction := NewReadWriteTransaction(oracle)
+	transaction.Get([]byte("Checking"))
+	keysOf(transaction.Iterator(nil, nil))
+
+	assert.Equal(t, 0, len(transaction.reads))
+	assert.Equal(t, 0, len(transaction.readRanges))
+}
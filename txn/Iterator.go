@@ -0,0 +1,203 @@
+package txn
+
+import (
+	"IsoTransact/mvcc"
+	"bytes"
+)
+
+// Iterator walks the keys visible to a transaction in a range, yielding one value per key:
+// the highest version that is less than or equal to the begin timestamp of the transaction, or the value written by the
+// transaction itself if it is a read-write transaction. Deleted keys are skipped.
+// Keys come in the increasing order, or in the decreasing order for a reverse iterator.
+//
+// Close must be called once the iterator is no longer needed. An iterator stops at a failure to read the engine, see Err.
+type Iterator struct {
+	snapshot *snapshotIterator
+	pairs    []KeyValuePair //the uncommitted pairs of the transaction in the range, in the order of the iteration
+	current  KeyValuePair
+	reverse  bool
+}
+
+// newIterator merges the snapshot with the pairs, given in the increasing order of keys.
+func newIterator(snapshot *snapshotIterator, pairs []KeyValuePair) *Iterator {
+	iterator := &Iterator{snapshot: snapshot, pairs: pairs, reverse: snapshot.reverse}
+	if iterator.reverse {
+		iterator.pairs = make([]KeyValuePair, 0, len(pairs))
+		for index := len(pairs) - 1; index >= 0; index-- {
+			iterator.pairs = append(iterator.pairs, pairs[index])
+		}
+	}
+	return iterator
+}
+
+func (iterator *Iterator) Next() bool {
+	if iterator.snapshot.err != nil {
+		return false
+	}
+	for {
+		snapshotValid := iterator.snapshot.valid
+		if !snapshotValid && len(iterator.pairs) == 0 {
+			return false
+		}
+		if len(iterator.pairs) > 0 && (!snapshotValid || iterator.comesFirst(iterator.pairs[0].key, iterator.snapshot.key)) {
+			//the transaction's own write shadows the committed version of the key, its own merge is folded onto it
+			pair := iterator.pairs[0]
+			committed := mvcc.NewTombstone()
+			if snapshotValid && bytes.Equal(pair.key, iterator.snapshot.key) {
+				committed = iterator.snapshot.value
+				iterator.snapshot.next()
+			}
+			var err error
+			if pair.value, err = mvcc.ResolveMerge(committed, pair.value); err != nil {
+				iterator.snapshot.stop(err)
+				return false
+			}
+			iterator.pairs = iterator.pairs[1:]
+			if pair.value.IsTombstone() {
+				continue
+			}
+			iterator.current = pair
+			return true
+		}
+		iterator.current = *newKeyValuePair(iterator.snapshot.key, iterator.snapshot.value)
+		iterator.snapshot.next()
+		return true
+	}
+}
+
+// comesFirst returns true if the key comes before the other key, or is the same, in the order of the iteration.
+func (iterator *Iterator) comesFirst(key, other []byte) bool {
+	if iterator.reverse {
+		return bytes.Compare(key, other) >= 0
+	}
+	return bytes.Compare(key, other) <= 0
+}
+
+func (iterator *Iterator) Key() []byte {
+	return iterator.current.key
+}
+
+func (iterator *Iterator) Value() mvcc.Value {
+	return iterator.current.value
+}
+
+// Err returns the error of reading the engine that stopped the iteration, if any; the transaction reports it as well.
+func (iterator *Iterator) Err() error {
+	return iterator.snapshot.err
+}
+
+// Close releases the tables held by the iterator, it is safe to call more than once.
+func (iterator *Iterator) Close() {
+	iterator.snapshot.close()
+}
+
+// snapshotIterator yields the highest version, that is less than or equal to the timestamp, of every key of the engine in a range,
+// in the increasing order of keys, or in the decreasing order for a reverse one. Keys whose visible version is a tombstone are skipped.
+type snapshotIterator struct {
+	source    mvcc.RangeIterator
+	timestamp uint64
+	reverse   bool
+	hasSource bool
+	valid     bool
+	key       []byte
+	value     mvcc.Value
+	err       error
+	failRead  func(err error) //reports the error to the transaction
+}
+
+func newSnapshotIterator(engine mvcc.StorageEngine, timestamp uint64, start, end []byte, reverse bool, failRead func(err error)) *snapshotIterator {
+	var source mvcc.RangeIterator
+	if reverse {
+		source = engine.NewReverseRangeIterator(start, end, timestamp)
+	} else {
+		source = engine.NewRangeIterator(start, end)
+	}
+	iterator := &snapshotIterator{source: source, timestamp: timestamp, reverse: reverse, failRead: failRead, hasSource: source.Next()}
+	iterator.next()
+	return iterator
+}
+
+func (iterator *snapshotIterator) next() {
+	for iterator.hasSource {
+		key := iterator.source.Key().GetKey()
+		var value mvcc.Value
+		var found bool
+		var err error
+		if iterator.reverse {
+			value, found, err = iterator.foldBackwards(key)
+		} else {
+			value, found, err = iterator.foldForwards(key)
+		}
+		//the versions of the key may be cut short by the failure
+		if !iterator.hasSource && iterator.source.Err() != nil {
+			break
+		}
+		if err != nil {
+			iterator.stop(err)
+			return
+		}
+		if found && !value.IsTombstone() {
+			iterator.key, iterator.value, iterator.valid = key, value, true
+			return
+		}
+	}
+	iterator.valid = false
+	if err := iterator.source.Err(); err != nil {
+		iterator.err = err
+		iterator.failRead(err)
+	}
+	iterator.source.Close()
+}
+
+// stop ends the iteration at an error of merging the versions of a key, and reports it to the transaction.
+func (iterator *snapshotIterator) stop(err error) {
+	iterator.err = err
+	iterator.failRead(err)
+	iterator.close()
+}
+
+// foldForwards reads the versions of the key in the increasing order: the last one at or below the timestamp is visible,
+// with the merge operands folded onto the versions below them.
+func (iterator *snapshotIterator) foldForwards(key []byte) (mvcc.Value, bool, error) {
+	folder := newMergeFolder()
+	for iterator.hasSource && bytes.Equal(iterator.source.Key().GetKey(), key) {
+		if iterator.source.Key().GetVersion() <= iterator.timestamp {
+			folder.add(iterator.source.Key().GetVersion(), iterator.source.Value())
+		}
+		iterator.hasSource = iterator.source.Next()
+	}
+	return folder.value, folder.found, folder.err
+}
+
+// foldBackwards reads the versions of the key at or below the timestamp, newest first: the first one is visible,
+// with the merge operands down to a regular value or a tombstone folded onto it.
+func (iterator *snapshotIterator) foldBackwards(key []byte) (mvcc.Value, bool, error) {
+	folder := newBackwardMergeFolder()
+	for iterator.hasSource && bytes.Equal(iterator.source.Key().GetKey(), key) {
+		folder.add(iterator.source.Key().GetVersion(), iterator.source.Value())
+		iterator.hasSource = iterator.source.Next()
+	}
+	value, err := folder.fold()
+	return value, folder.found, err
+}
+
+func (iterator *snapshotIterator) close() {
+	iterator.hasSource, iterator.valid = false, false
+	iterator.source.Close()
+}
+
+func inRange(key, start, end []byte) bool {
+	return (start == nil || bytes.Compare(key, start) >= 0) && (end == nil || bytes.Compare(key, end) < 0)
+}
+
+// prefixEnd returns the smallest key greater than all the keys with the prefix, or nil if there is no such key.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for index := len(end) - 1; index >= 0; index-- {
+		if end[index] < 0xff {
+			end[index]++
+			return end[:index+1]
+		}
+	}
+	return nil
+}
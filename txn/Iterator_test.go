@@ -0,0 +1,174 @@
+package txn
+
+import (
+	"IsoTransact/mvcc"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func commitForTest(t *testing.T, oracle *Oracle, write func(transaction *ReadWriteTransaction)) {
+	transaction := NewReadWriteTransaction(oracle)
+	write(transaction)
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, <-doneChannel)
+}
+
+func keysOf(iterator *Iterator) []string {
+	defer iterator.Close()
+
+	var keys []string
+	for iterator.Next() {
+		keys = append(keys, string(iterator.Key()))
+	}
+	return keys
+}
+
+func TestIteratesOverTheVisibleKeysOfARange(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+		_ = transaction.PutOrUpdate([]byte("Pen drive"), []byte("Pen"))
+		_ = transaction.PutOrUpdate([]byte("Tape"), []byte("Tape drive"))
+	})
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+
+	transaction := NewReadOnlyTransaction(oracle)
+	iterator := transaction.Iterator([]byte("Pen drive"), []byte("Tape"))
+	defer iterator.Close()
+
+	assert.Equal(t, true, iterator.Next())
+	assert.Equal(t, []byte("Pen drive"), iterator.Key())
+	assert.Equal(t, []byte("Pen"), iterator.Value().Slice())
+	assert.Equal(t, true, iterator.Next())
+	assert.Equal(t, []byte("SSD"), iterator.Key())
+	assert.Equal(t, []byte("Solid state drive"), iterator.Value().Slice())
+	assert.Equal(t, false, iterator.Next())
+}
+
+func TestIteratesOverTheKeysOfASnapshotSkippingTheDeletedOnes(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+	})
+	snapshot := NewReadOnlyTransaction(oracle)
+
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.Delete([]byte("HDD"))
+		_ = transaction.PutOrUpdate([]byte("NVMe"), []byte("Non-volatile memory"))
+	})
+
+	assert.Equal(t, []string{"HDD", "SSD"}, keysOf(snapshot.Iterator(nil, nil)))
+	assert.Equal(t, []string{"NVMe", "SSD"}, keysOf(NewReadOnlyTransaction(oracle).Iterator(nil, nil)))
+}
+
+func TestIteratesOverTheKeysWithAPrefixInBothDirections(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("disk:HDD"), []byte("Hard disk"))
+		_ = transaction.PutOrUpdate([]byte("disk:SSD"), []byte("Solid state"))
+		_ = transaction.PutOrUpdate([]byte("disks"), []byte("All"))
+		_ = transaction.PutOrUpdate([]byte("disk"), []byte("Disk"))
+		_ = transaction.PutOrUpdate([]byte("drive:Pen"), []byte("Pen drive"))
+	})
+
+	transaction := NewReadOnlyTransaction(oracle)
+	assert.Equal(t, []string{"disk:HDD", "disk:SSD"}, keysOf(transaction.PrefixIterator([]byte("disk:"))))
+	assert.Equal(t, []string{"disk:SSD", "disk:HDD"}, keysOf(transaction.ReversePrefixIterator([]byte("disk:"))))
+	assert.Equal(t, []string{"drive:Pen", "disks", "disk:SSD", "disk:HDD", "disk"}, keysOf(transaction.ReverseIterator(nil, nil)))
+}
+
+func TestIteratesOverTheKeysOfAReadWriteTransactionMergingItsOwnWrites(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+		_ = transaction.PutOrUpdate([]byte("Tape"), []byte("Tape drive"))
+	})
+
+	transaction := NewReadWriteTransaction(oracle)
+	_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	_ = transaction.PutOrUpdate([]byte("NVMe"), []byte("Non-volatile memory"))
+	_ = transaction.Delete([]byte("Tape"))
+
+	iterator := transaction.Iterator(nil, nil)
+	var pairs []string
+	for iterator.Next() {
+		pairs = append(pairs, string(iterator.Key())+"="+string(iterator.Value().Slice()))
+	}
+	iterator.Close()
+
+	assert.Equal(t, []string{"HDD=Hard disk", "NVMe=Non-volatile memory", "SSD=Solid state drive"}, pairs)
+	assert.Equal(t, []string{"SSD", "NVMe", "HDD"}, keysOf(transaction.ReverseIterator(nil, nil)))
+}
+
+func TestIteratesBackwardsOverTheSameKeysAndValuesAsForwards(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+
+	for round := 1; round <= 5; round++ {
+		commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+			_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk:"+strconv.Itoa(round)))
+			_ = transaction.Merge([]byte("counter"), sumOperand(int64(round)))
+			if round%2 == 0 {
+				_ = transaction.Delete([]byte("SSD"))
+			} else {
+				_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state:"+strconv.Itoa(round)))
+			}
+		})
+	}
+	snapshot := NewReadOnlyTransaction(oracle)
+	defer snapshot.FinishBeginTimestampForReadonlyTransaction()
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+		_ = transaction.Merge([]byte("counter"), sumOperand(100))
+		_ = transaction.Delete([]byte("SSD"))
+	})
+
+	pairsOf := func(iterator *Iterator) []string {
+		defer iterator.Close()
+		var pairs []string
+		for iterator.Next() {
+			pairs = append(pairs, string(iterator.Key())+"="+string(iterator.Value().Slice()))
+		}
+		return pairs
+	}
+	forward := pairsOf(snapshot.Iterator(nil, nil))
+	assert.Equal(t, []string{"HDD=Hard disk:5", "SSD=Solid state:5", "counter=" + string(EncodeInt64(15))}, forward)
+	assert.Equal(t, []string{forward[2], forward[1], forward[0]}, pairsOf(snapshot.ReverseIterator(nil, nil)))
+}
+
+func TestGetsTheEndOfAPrefix(t *testing.T) {
+	assert.Equal(t, []byte("disk;"), prefixEnd([]byte("disk:")))
+	assert.Equal(t, []byte("e"), prefixEnd([]byte{'d', 0xff}))
+	assert.Nil(t, prefixEnd([]byte{0xff, 0xff}))
+}
+
+func TestReadsTheLastWriteOfAKeyOverwrittenInATransaction(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		assert.Nil(t, transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk")))
+		assert.Nil(t, transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive")))
+		assert.Nil(t, transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state")))
+		assert.Nil(t, transaction.Delete([]byte("SSD")))
+
+		value, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+		assert.Equal(t, []string{"HDD"}, keysOf(transaction.Iterator(nil, nil)))
+	})
+
+	transaction := NewReadOnlyTransaction(oracle)
+	defer transaction.FinishBeginTimestampForReadonlyTransaction()
+	value, _ := transaction.Get([]byte("HDD"))
+	assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+	_, ok := transaction.Get([]byte("SSD"))
+	assert.Equal(t, false, ok)
+}
@@ -0,0 +1,245 @@
+package txn
+
+import (
+	errors2 "IsoTransact/txn/errors"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultLockWaitTimeout is the longest a transaction waits for a key lock by default.
+const DefaultLockWaitTimeout = time.Second
+
+// LockMode is the mode of a key lock taken with ReadWriteTransaction.GetForUpdate.
+type LockMode uint8
+
+const (
+	//SharedLock is compatible with other shared locks on the key
+	SharedLock LockMode = iota
+	//ExclusiveLock is compatible with no other lock on the key
+	ExclusiveLock
+)
+
+func compatible(held, requested LockMode) bool {
+	return held == SharedLock && requested == SharedLock
+}
+
+type lockRequest struct {
+	owner   *ReadWriteTransaction
+	mode    LockMode
+	granted chan struct{}
+}
+
+type keyLock struct {
+	holders map[*ReadWriteTransaction]LockMode
+	queue   []*lockRequest //granted in order, an upgrade goes to the front
+}
+
+// LockManager grants the key locks of the pessimistic transactions. A request that can not be granted waits in the queue of the key,
+// till the holders release the key, its wait times out, or its context is done. Before waiting, the manager looks for a cycle
+// in the wait-for graph through the request; the requesting transaction is the victim of the deadlock, and waits for nothing.
+type LockManager struct {
+	lock     sync.Mutex
+	keys     map[string]*keyLock
+	heldKeys map[*ReadWriteTransaction]map[string]LockMode
+	waiting  map[*ReadWriteTransaction]string //the key each waiting transaction waits for
+}
+
+func NewLockManager() *LockManager {
+	return &LockManager{
+		keys:     make(map[string]*keyLock),
+		heldKeys: make(map[*ReadWriteTransaction]map[string]LockMode),
+		waiting:  make(map[*ReadWriteTransaction]string),
+	}
+}
+
+// Acquire takes the lock of the key in the mode for the owner, waiting at most timeout (0 waits till the context is done).
+// A shared lock held by the owner is upgraded by an exclusive request, and a lock held in the requested mode, or a stronger one, is kept as is.
+// It returns errors.DeadlockErr if waiting would close a cycle of waiting transactions, errors.LockWaitTimeoutErr
+// once the timeout passes, and ctx.Err() once the context is done.
+func (manager *LockManager) Acquire(ctx context.Context, owner *ReadWriteTransaction, key []byte, mode LockMode, timeout time.Duration) error {
+	request, err := manager.enqueue(owner, string(key), mode)
+	if err != nil || request == nil {
+		return err
+	}
+
+	var timeoutChannel <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChannel = timer.C
+	}
+	select {
+	case <-request.granted:
+		return nil
+	case <-timeoutChannel:
+		err = errors2.LockWaitTimeoutErr
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if manager.dequeue(string(key), request) {
+		return err
+	}
+	//granted in the meantime
+	return nil
+}
+
+// enqueue grants the request right away and returns nil, or queues it and returns it.
+func (manager *LockManager) enqueue(owner *ReadWriteTransaction, key string, mode LockMode) (*lockRequest, error) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	lock, ok := manager.keys[key]
+	if !ok {
+		lock = &keyLock{holders: make(map[*ReadWriteTransaction]LockMode)}
+		manager.keys[key] = lock
+	}
+	held, holds := lock.holders[owner]
+	if holds && (held == ExclusiveLock || mode == SharedLock) {
+		return nil, nil
+	}
+	if manager.grantable(lock, owner, mode, holds) {
+		manager.grant(lock, owner, key, mode)
+		return nil, nil
+	}
+
+	request := &lockRequest{owner: owner, mode: mode, granted: make(chan struct{})}
+	if holds {
+		lock.queue = append([]*lockRequest{request}, lock.queue...)
+	} else {
+		lock.queue = append(lock.queue, request)
+	}
+	manager.waiting[owner] = key
+	if manager.waitsFor(owner, owner, make(map[*ReadWriteTransaction]bool)) {
+		manager.remove(lock, request)
+		delete(manager.waiting, owner)
+		return nil, errors2.DeadlockErr
+	}
+	return request, nil
+}
+
+// grantable returns true if the request is compatible with the other holders of the key and, unless it is an upgrade, nobody waits before it.
+func (manager *LockManager) grantable(lock *keyLock, owner *ReadWriteTransaction, mode LockMode, upgrade bool) bool {
+	if !upgrade && len(lock.queue) > 0 {
+		return false
+	}
+	for holder, held := range lock.holders {
+		if holder != owner && !compatible(held, mode) {
+			return false
+		}
+	}
+	return true
+}
+
+func (manager *LockManager) grant(lock *keyLock, owner *ReadWriteTransaction, key string, mode LockMode) {
+	lock.holders[owner] = mode
+	heldKeys, ok := manager.heldKeys[owner]
+	if !ok {
+		heldKeys = make(map[string]LockMode)
+		manager.heldKeys[owner] = heldKeys
+	}
+	heldKeys[key] = mode
+}
+
+// waitsFor walks the wait-for graph from the transaction, and returns true if it reaches the target.
+// A waiting transaction waits for the incompatible holders of its key, and for the incompatible requests queued before it.
+func (manager *LockManager) waitsFor(transaction, target *ReadWriteTransaction, visited map[*ReadWriteTransaction]bool) bool {
+	key, ok := manager.waiting[transaction]
+	if !ok || visited[transaction] {
+		return false
+	}
+	visited[transaction] = true
+
+	lock := manager.keys[key]
+	var mode LockMode
+	var blockers []*ReadWriteTransaction
+	for index, request := range lock.queue {
+		if request.owner == transaction {
+			mode = request.mode
+			for _, ahead := range lock.queue[:index] {
+				if !compatible(ahead.mode, mode) {
+					blockers = append(blockers, ahead.owner)
+				}
+			}
+			break
+		}
+	}
+	for holder, held := range lock.holders {
+		if holder != transaction && !compatible(held, mode) {
+			blockers = append(blockers, holder)
+		}
+	}
+	for _, blocker := range blockers {
+		if blocker == target || manager.waitsFor(blocker, target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// dequeue removes a request that gave up waiting, and returns false if it was granted in the meantime.
+func (manager *LockManager) dequeue(key string, request *lockRequest) bool {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	select {
+	case <-request.granted:
+		return false
+	default:
+	}
+	lock := manager.keys[key]
+	manager.remove(lock, request)
+	delete(manager.waiting, request.owner)
+	//the requests queued behind it may be grantable now
+	manager.grantQueued(lock, key)
+	return true
+}
+
+func (manager *LockManager) remove(lock *keyLock, request *lockRequest) {
+	for index, queued := range lock.queue {
+		if queued == request {
+			lock.queue = append(lock.queue[:index], lock.queue[index+1:]...)
+			return
+		}
+	}
+}
+
+// grantQueued grants the requests at the front of the queue of the key, as long as they are compatible with the holders.
+func (manager *LockManager) grantQueued(lock *keyLock, key string) {
+	for len(lock.queue) > 0 {
+		request := lock.queue[0]
+		for holder, held := range lock.holders {
+			if holder != request.owner && !compatible(held, request.mode) {
+				return
+			}
+		}
+		lock.queue = lock.queue[1:]
+		manager.grant(lock, request.owner, key, request.mode)
+		delete(manager.waiting, request.owner)
+		close(request.granted)
+	}
+	if len(lock.holders) == 0 && len(lock.queue) == 0 {
+		delete(manager.keys, key)
+	}
+}
+
+// ReleaseAll releases every lock held by the owner, and grants the requests waiting for them.
+func (manager *LockManager) ReleaseAll(owner *ReadWriteTransaction) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	for key := range manager.heldKeys[owner] {
+		lock := manager.keys[key]
+		delete(lock.holders, owner)
+		manager.grantQueued(lock, key)
+	}
+	delete(manager.heldKeys, owner)
+}
+
+// HeldLocks returns the number of the keys locked by the owner.
+func (manager *LockManager) HeldLocks(owner *ReadWriteTransaction) int {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	return len(manager.heldKeys[owner])
+}
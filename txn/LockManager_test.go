@@ -0,0 +1,187 @@
+package txn
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/txn/errors"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGrantsSharedLocksOfAKeyToMultipleTransactions(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	manager := NewLockManager()
+
+	aTransaction, anotherTransaction := NewReadWriteTransaction(oracle), NewReadWriteTransaction(oracle)
+	assert.Nil(t, manager.Acquire(context.Background(), aTransaction, []byte("HDD"), SharedLock, time.Second))
+	assert.Nil(t, manager.Acquire(context.Background(), anotherTransaction, []byte("HDD"), SharedLock, time.Second))
+
+	assert.Equal(t, 1, manager.HeldLocks(aTransaction))
+	assert.Equal(t, 1, manager.HeldLocks(anotherTransaction))
+}
+
+func TestGrantsAnExclusiveLockOnceTheHolderReleasesIt(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	manager := NewLockManager()
+
+	aTransaction, anotherTransaction := NewReadWriteTransaction(oracle), NewReadWriteTransaction(oracle)
+	assert.Nil(t, manager.Acquire(context.Background(), aTransaction, []byte("HDD"), SharedLock, time.Second))
+
+	granted := make(chan error)
+	go func() {
+		granted <- manager.Acquire(context.Background(), anotherTransaction, []byte("HDD"), ExclusiveLock, time.Second)
+	}()
+	select {
+	case <-granted:
+		t.Fatal("exclusive lock granted while a shared lock is held")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	manager.ReleaseAll(aTransaction)
+	assert.Nil(t, <-granted)
+	assert.Equal(t, 0, manager.HeldLocks(aTransaction))
+	assert.Equal(t, 1, manager.HeldLocks(anotherTransaction))
+}
+
+func TestTimesOutWaitingForAKeyLock(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	manager := NewLockManager()
+
+	aTransaction, anotherTransaction := NewReadWriteTransaction(oracle), NewReadWriteTransaction(oracle)
+	assert.Nil(t, manager.Acquire(context.Background(), aTransaction, []byte("HDD"), ExclusiveLock, time.Second))
+
+	err := manager.Acquire(context.Background(), anotherTransaction, []byte("HDD"), SharedLock, 10*time.Millisecond)
+	assert.Equal(t, errors.LockWaitTimeoutErr, err)
+	assert.Equal(t, 0, manager.HeldLocks(anotherTransaction))
+
+	manager.ReleaseAll(aTransaction)
+	assert.Nil(t, manager.Acquire(context.Background(), anotherTransaction, []byte("HDD"), SharedLock, 10*time.Millisecond))
+}
+
+func TestDiscardsATransactionWhoseContextIsDoneBeforeReadingALockedKey(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+
+	transaction := NewReadWriteTransaction(oracle)
+	//a commit timestamp handed out but never applied
+	writer := NewReadWriteTransaction(oracle)
+	_ = writer.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+	_, err := oracle.maybeCommitTimestampFor(writer)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = transaction.GetForUpdate(ctx, []byte("HDD"), ExclusiveLock)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, oracle.lockManager.HeldLocks(transaction))
+
+	_, err = transaction.Commit(context.Background())
+	assert.Equal(t, errors.DiscardedTxnErr, err)
+}
+
+func TestDiscardsATransactionThatTimesOutWaitingForAKeyLock(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+	oracle.SetLockWaitTimeout(10 * time.Millisecond)
+
+	holder, waiter := NewReadWriteTransaction(oracle), NewReadWriteTransaction(oracle)
+	_, _, err := holder.GetForUpdate(context.Background(), []byte("HDD"), ExclusiveLock)
+	assert.Nil(t, err)
+	_, _, err = waiter.GetForUpdate(context.Background(), []byte("SSD"), ExclusiveLock)
+	assert.Nil(t, err)
+
+	_, _, err = waiter.GetForUpdate(context.Background(), []byte("HDD"), ExclusiveLock)
+	assert.Equal(t, errors.LockWaitTimeoutErr, err)
+	assert.Equal(t, 0, oracle.lockManager.HeldLocks(waiter))
+	_, err = waiter.Commit(context.Background())
+	assert.Equal(t, errors.DiscardedTxnErr, err)
+
+	_, _, err = holder.GetForUpdate(context.Background(), []byte("SSD"), ExclusiveLock)
+	assert.Nil(t, err)
+}
+
+func TestDiscardsATransactionWhoseContextIsDoneWaitingForAKeyLock(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+
+	holder, waiter := NewReadWriteTransaction(oracle), NewReadWriteTransaction(oracle)
+	_, _, err := holder.GetForUpdate(context.Background(), []byte("HDD"), ExclusiveLock)
+	assert.Nil(t, err)
+	_, _, err = waiter.GetForUpdate(context.Background(), []byte("SSD"), ExclusiveLock)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, _, err = waiter.GetForUpdate(ctx, []byte("HDD"), ExclusiveLock)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, oracle.lockManager.HeldLocks(waiter))
+	_, err = waiter.Commit(context.Background())
+	assert.Equal(t, errors.DiscardedTxnErr, err)
+
+	_, _, err = holder.GetForUpdate(context.Background(), []byte("SSD"), ExclusiveLock)
+	assert.Nil(t, err)
+}
+
+func TestAbortsTheTransactionThatClosesADeadlock(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+
+	aTransaction, anotherTransaction := NewReadWriteTransaction(oracle), NewReadWriteTransaction(oracle)
+	_, _, err := aTransaction.GetForUpdate(context.Background(), []byte("HDD"), ExclusiveLock)
+	assert.Nil(t, err)
+	_, _, err = anotherTransaction.GetForUpdate(context.Background(), []byte("SSD"), ExclusiveLock)
+	assert.Nil(t, err)
+
+	waiting := make(chan error)
+	go func() {
+		_, _, err := aTransaction.GetForUpdate(context.Background(), []byte("SSD"), ExclusiveLock)
+		waiting <- err
+	}()
+	assert.Eventually(t, func() bool {
+		oracle.lockManager.lock.Lock()
+		defer oracle.lockManager.lock.Unlock()
+		_, ok := oracle.lockManager.waiting[aTransaction]
+		return ok
+	}, time.Second, time.Millisecond)
+
+	_, _, err = anotherTransaction.GetForUpdate(context.Background(), []byte("HDD"), ExclusiveLock)
+	assert.Equal(t, errors.DeadlockErr, err)
+	assert.Nil(t, <-waiting)
+
+	_, err = anotherTransaction.Commit(context.Background())
+	assert.Equal(t, errors.DiscardedTxnErr, err)
+}
+
+func TestIncrementsAHotCounterWithExclusiveLocksWithoutConflicts(t *testing.T) {
+	const goroutines, incrementsPerGoroutine = 8, 25
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("counter"), []byte("0"))
+	})
+
+	var wg sync.WaitGroup
+	for goroutine := 0; goroutine < goroutines; goroutine++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for count := 0; count < incrementsPerGoroutine; count++ {
+				transaction := NewReadWriteTransaction(oracle)
+				value, _, err := transaction.GetForUpdate(context.Background(), []byte("counter"), ExclusiveLock)
+				assert.Nil(t, err)
+				counter, _ := strconv.Atoi(string(value.Slice()))
+				_ = transaction.PutOrUpdate([]byte("counter"), []byte(strconv.Itoa(counter+1)))
+
+				doneChannel, err := transaction.Commit(context.Background())
+				assert.Nil(t, err)
+				assert.Nil(t, <-doneChannel)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, ok := NewReadOnlyTransaction(oracle).Get([]byte("counter"))
+	assert.True(t, ok)
+	assert.Equal(t, strconv.Itoa(goroutines*incrementsPerGoroutine), string(value.Slice()))
+}
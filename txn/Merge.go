@@ -0,0 +1,124 @@
+package txn
+
+import (
+	"IsoTransact/mvcc"
+)
+
+// read returns the value of the key at the timestamp, a tombstone included. A merge operand is folded onto the versions below it,
+// read newest first down to a regular value or a tombstone, or to the oldest version of the key.
+func read(engine mvcc.StorageEngine, key []byte, timestamp uint64) (mvcc.Value, bool, error) {
+	value, ok, err := engine.Get(*mvcc.NewVersionedKey(key, timestamp))
+	if err != nil || !ok || !value.IsMergeOperand() {
+		return value, ok, err
+	}
+
+	//the smallest key greater than the key, so that the range holds the versions of the key only
+	end := append(append([]byte{}, key...), 0)
+	iterator := engine.NewReverseRangeIterator(key, end, timestamp)
+	defer iterator.Close()
+
+	folder := newBackwardMergeFolder()
+	for !folder.complete && iterator.Next() {
+		folder.add(iterator.Key().GetVersion(), iterator.Value())
+	}
+	if err := iterator.Err(); err != nil {
+		return mvcc.Value{}, false, err
+	}
+	value, err = folder.fold()
+	if err != nil {
+		return mvcc.Value{}, false, err
+	}
+	return value, true, nil
+}
+
+func isRegistered(operatorName string) bool {
+	_, ok := mvcc.LookupMergeOperator(operatorName)
+	return ok
+}
+
+// mergeFolder folds the versions of a key, given in the increasing order, into the value a reader sees at the highest one.
+// An operand of an operator that is not registered sets err, till a regular value or a tombstone above it hides it.
+type mergeFolder struct {
+	value   mvcc.Value
+	version uint64
+	found   bool
+	err     error
+}
+
+func newMergeFolder() *mergeFolder {
+	return &mergeFolder{value: mvcc.NewTombstone()}
+}
+
+func (folder *mergeFolder) add(version uint64, value mvcc.Value) {
+	//the same version may be read from more than one source of the engine, an operand is merged once
+	if folder.found && folder.version == version {
+		return
+	}
+	if folder.err == nil || !value.IsMergeOperand() {
+		folder.value, folder.err = mvcc.ResolveMerge(folder.value, value)
+	}
+	folder.version, folder.found = version, true
+}
+
+// backwardMergeFolder folds the versions of a key, given in the decreasing order, into the value a reader sees at the highest one:
+// it keeps the merge operands down to the first regular value or tombstone, and ignores the versions below it.
+// An operand given again as a regular value, collapsed by the version GC with the versions below it, replaces them.
+type backwardMergeFolder struct {
+	operands []mvcc.Value //newest first
+	versions []uint64     //the versions of the operands
+	base     mvcc.Value
+	baseAt   uint64 //the version of the base, once complete
+	version  uint64
+	found    bool
+	complete bool
+}
+
+func newBackwardMergeFolder() *backwardMergeFolder {
+	return &backwardMergeFolder{base: mvcc.NewTombstone()}
+}
+
+func (folder *backwardMergeFolder) add(version uint64, value mvcc.Value) {
+	//the same version may be read from more than one source of the engine, an operand is merged once
+	if folder.found && version >= folder.version {
+		if !value.IsMergeOperand() {
+			folder.collapse(version, value)
+		}
+		return
+	}
+	if folder.complete {
+		return
+	}
+	folder.version, folder.found = version, true
+	if value.IsMergeOperand() {
+		folder.operands = append(folder.operands, value)
+		folder.versions = append(folder.versions, version)
+		return
+	}
+	folder.base, folder.baseAt, folder.complete = value, version, true
+}
+
+// collapse takes the value of a version read again as the base, in place of the versions at or below it;
+// a base above it already holds the versions below.
+func (folder *backwardMergeFolder) collapse(version uint64, value mvcc.Value) {
+	if folder.complete && version <= folder.baseAt {
+		return
+	}
+	above := len(folder.versions)
+	for above > 0 && folder.versions[above-1] <= version {
+		above--
+	}
+	folder.operands, folder.versions = folder.operands[:above], folder.versions[:above]
+	folder.base, folder.baseAt, folder.complete = value, version, true
+}
+
+// fold returns mvcc.UnknownMergeOperatorErr if one of the operands names an operator that is not registered.
+func (folder *backwardMergeFolder) fold() (mvcc.Value, error) {
+	value := folder.base
+	for index := len(folder.operands) - 1; index >= 0; index-- {
+		var err error
+		if value, err = mvcc.ResolveMerge(value, folder.operands[index]); err != nil {
+			return mvcc.Value{}, err
+		}
+	}
+	return value, nil
+}
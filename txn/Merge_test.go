@@ -0,0 +1,235 @@
+package txn
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/txn/errors"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func sumOperand(value int64) mvcc.Value {
+	return mvcc.NewMergeOperand(mvcc.SumOperator, EncodeInt64(value))
+}
+
+func TestMergesConcurrentlyIntoAKeyWithoutConflicts(t *testing.T) {
+	for _, isolationLevel := range []IsolationLevel{Serializable, SnapshotIsolation} {
+		const goroutines, mergesPerGoroutine = 8, 25
+		oracle := NewOracleWithIsolationLevel(NewTransactionExecutor(mvcc.NewMemTable(10)), isolationLevel)
+
+		var wg sync.WaitGroup
+		for goroutine := 0; goroutine < goroutines; goroutine++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for count := 0; count < mergesPerGoroutine; count++ {
+					transaction := NewReadWriteTransaction(oracle)
+					assert.Nil(t, transaction.Merge([]byte("counter"), sumOperand(3)))
+					doneChannel, err := transaction.Commit(context.Background())
+					assert.Nil(t, err)
+					assert.Nil(t, <-doneChannel)
+				}
+			}()
+		}
+		wg.Wait()
+
+		value, _ := NewReadOnlyTransaction(oracle).Get([]byte("counter"))
+		assert.Equal(t, EncodeInt64(3*goroutines*mergesPerGoroutine), value.Slice())
+	}
+}
+
+func TestFoldsTheMergeOperandsOntoTheValueAtTheSnapshot(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("disks"), mvcc.EncodeList([]byte("HDD")))
+	})
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.Merge([]byte("disks"), mvcc.NewMergeOperand(mvcc.AppendOperator, mvcc.EncodeList([]byte("SSD"))))
+	})
+
+	snapshot := NewReadOnlyTransaction(oracle)
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.Merge([]byte("disks"), mvcc.NewMergeOperand(mvcc.AppendOperator, mvcc.EncodeList([]byte("NVMe"))))
+	})
+
+	value, _ := snapshot.Get([]byte("disks"))
+	assert.Equal(t, mvcc.EncodeList([]byte("HDD"), []byte("SSD")), value.Slice())
+
+	transaction := NewReadOnlyTransaction(oracle)
+	value, _ = transaction.Get([]byte("disks"))
+	assert.Equal(t, mvcc.EncodeList([]byte("HDD"), []byte("SSD"), []byte("NVMe")), value.Slice())
+
+	iterator := transaction.Iterator(nil, nil)
+	defer iterator.Close()
+	assert.True(t, iterator.Next())
+	assert.Equal(t, mvcc.EncodeList([]byte("HDD"), []byte("SSD"), []byte("NVMe")), iterator.Value().Slice())
+}
+
+func TestReadsTheMergesOfTheTransactionFoldedOntoTheCommittedValue(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("counter"), EncodeInt64(10))
+	})
+
+	transaction := NewReadWriteTransaction(oracle)
+	assert.Nil(t, transaction.Merge([]byte("counter"), sumOperand(5)))
+	assert.Nil(t, transaction.Merge([]byte("counter"), sumOperand(2)))
+	assert.Nil(t, transaction.Merge([]byte("fresh"), sumOperand(1)))
+
+	value, _ := transaction.Get([]byte("counter"))
+	assert.Equal(t, EncodeInt64(17), value.Slice())
+
+	iterator := transaction.Iterator(nil, nil)
+	assert.Equal(t, []string{"counter", "fresh"}, keysOf(iterator))
+	iterator = transaction.Iterator([]byte("fresh"), nil)
+	assert.True(t, iterator.Next())
+	assert.Equal(t, EncodeInt64(1), iterator.Value().Slice())
+	iterator.Close()
+
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, <-doneChannel)
+
+	value, _ = NewReadOnlyTransaction(oracle).Get([]byte("counter"))
+	assert.Equal(t, EncodeInt64(17), value.Slice())
+}
+
+func TestMergesOntoAWriteAndMixesMergesWithOperationsInATransaction(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("counter"), EncodeInt64(10))
+	})
+
+	transaction := NewReadWriteTransaction(oracle)
+	_ = transaction.PutOrUpdate([]byte("written"), EncodeInt64(1))
+	assert.Nil(t, transaction.Merge([]byte("written"), sumOperand(2)))
+	assert.Nil(t, transaction.Merge([]byte("counter"), sumOperand(5)))
+	assert.Nil(t, transaction.Merge([]byte("counter"), mvcc.NewMergeOperand(mvcc.MaxOperator, EncodeInt64(12))))
+	increment, _ := transaction.Increment([]byte("counter"), 1)
+
+	value, _ := transaction.Get([]byte("written"))
+	assert.Equal(t, EncodeInt64(3), value.Slice())
+
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, <-doneChannel)
+
+	//(10 + 5) max 12, plus 1
+	assert.Equal(t, EncodeInt64(16), resultForTest(t, increment).Value)
+	value, _ = NewReadOnlyTransaction(oracle).Get([]byte("counter"))
+	assert.Equal(t, EncodeInt64(16), value.Slice())
+}
+
+func TestRefusesAMergeOperandOfAnOperatorThatIsNotRegistered(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+
+	transaction := NewReadWriteTransaction(oracle)
+	assert.Equal(t, errors.UnknownMergeOperatorErr, transaction.Merge([]byte("counter"), mvcc.NewMergeOperand("unknown", nil)))
+	assert.Equal(t, errors.UnknownMergeOperatorErr, transaction.Merge([]byte("counter"), mvcc.NewValue(EncodeInt64(1))))
+}
+
+func TestReadsTheMergeOperandsAboveTheNearestValueOnly(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("disk"), []byte("HDD"))
+	})
+	//an operand below the value can not be merged, and is never read
+	memTable.PutOrUpdate(*mvcc.NewVersionedKey([]byte("counter"), 1), mvcc.NewMergeOperand("unknown", nil))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("counter"), EncodeInt64(10))
+	})
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.Merge([]byte("counter"), sumOperand(5))
+	})
+
+	transaction := NewReadOnlyTransaction(oracle)
+	value, _ := transaction.Get([]byte("counter"))
+	assert.Equal(t, EncodeInt64(15), value.Slice())
+
+	iterator := transaction.Iterator(nil, []byte("d"))
+	assert.True(t, iterator.Next())
+	assert.Equal(t, EncodeInt64(15), iterator.Value().Slice())
+	iterator.Close()
+
+	iterator = transaction.ReverseIterator(nil, []byte("d"))
+	assert.True(t, iterator.Next())
+	assert.Equal(t, EncodeInt64(15), iterator.Value().Slice())
+	iterator.Close()
+	assert.Nil(t, transaction.Err())
+}
+
+func TestFailsToReadAMergeOperandOfAnOperatorThatIsNotRegistered(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("counter"), EncodeInt64(10))
+	})
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("disk"), []byte("HDD"))
+	})
+	memTable.PutOrUpdate(*mvcc.NewVersionedKey([]byte("counter"), 2), mvcc.NewMergeOperand("unknown", nil))
+
+	transaction := NewReadOnlyTransaction(oracle)
+	_, ok := transaction.Get([]byte("counter"))
+	assert.False(t, ok)
+	assert.Equal(t, errors.UnknownMergeOperatorErr, transaction.Err())
+
+	for _, reverse := range []bool{false, true} {
+		transaction = NewReadOnlyTransaction(oracle)
+		iterator := transaction.newIterator(nil, []byte("d"), reverse)
+		assert.False(t, iterator.Next())
+		assert.Equal(t, errors.UnknownMergeOperatorErr, iterator.Err())
+		iterator.Close()
+		assert.Equal(t, errors.UnknownMergeOperatorErr, transaction.Err())
+	}
+
+	readWriteTransaction := NewReadWriteTransaction(oracle)
+	_, _ = readWriteTransaction.Increment([]byte("counter"), 1)
+	doneChannel, err := readWriteTransaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, errors.UnknownMergeOperatorErr, <-doneChannel)
+}
+
+func TestReadsTheMergeOperandsWhileTheVersionGCCollapsesThem(t *testing.T) {
+	const rounds, operands, readers = 20, 32, 4
+	for round := 0; round < rounds; round++ {
+		memTable := mvcc.NewMemTable(10)
+		memTable.PutOrUpdate(*mvcc.NewVersionedKey([]byte("counter"), 1), mvcc.NewValue(EncodeInt64(100)))
+		for version := uint64(2); version <= operands+1; version++ {
+			memTable.PutOrUpdate(*mvcc.NewVersionedKey([]byte("counter"), version), sumOperand(1))
+		}
+		//a reader stepping past the removed versions finds the versions of the preceding key
+		memTable.PutOrUpdate(*mvcc.NewVersionedKey([]byte("count"), 1), mvcc.NewValue(EncodeInt64(7)))
+
+		var wg, started sync.WaitGroup
+		collected := make(chan struct{})
+		for reader := 0; reader < readers; reader++ {
+			wg.Add(1)
+			started.Add(1)
+			go func() {
+				defer wg.Done()
+				for first := true; ; first = false {
+					select {
+					case <-collected:
+						return
+					default:
+					}
+					value, ok, err := read(memTable, []byte("counter"), operands+1)
+					assert.Nil(t, err)
+					assert.True(t, ok)
+					assert.Equal(t, EncodeInt64(100+operands), value.Slice())
+					if first {
+						started.Done()
+					}
+				}
+			}()
+		}
+		started.Wait()
+		removed, _ := memTable.DiscardVersionsBelow(operands + 1)
+		assert.Equal(t, operands, removed)
+		close(collected)
+		wg.Wait()
+	}
+}
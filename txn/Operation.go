@@ -0,0 +1,170 @@
+package txn
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/txn/errors"
+	"bytes"
+	"context"
+	"encoding/binary"
+)
+
+type operationKind uint8
+
+const (
+	compareAndSwap operationKind = iota
+	increment
+	putIfAbsent
+	//write is a PutOrUpdate or a Delete that follows an operation executed at apply time, it is executed after it
+	write
+	//merge is a Merge that can not be merged onto the value written earlier in the batch, it is merged onto the committed value
+	merge
+)
+
+// Operation is a read-modify-write of a key: ReadWriteTransaction.CompareAndSwap, Increment or PutIfAbsent.
+// It reads the key as of its execution, and not at the begin timestamp of the transaction, so it never conflicts on the read.
+// An operation on a key written earlier in the transaction is executed against that write right away; any other operation
+// is executed by the TransactionExecutor when it applies the batch, against the latest committed value of the key.
+// Either way, its result is known only once the commit of the transaction is applied.
+type Operation struct {
+	kind     operationKind
+	expected []byte
+	operand  mvcc.Value
+	delta    int64
+	result   OperationResult
+	err      error
+	done     chan struct{}
+}
+
+// OperationResult tells if the operation wrote the key, and gives the value of the key after the operation:
+// the written value if it did, the value it found otherwise (nil if the key did not exist).
+type OperationResult struct {
+	Applied bool
+	Value   []byte
+}
+
+func newOperation(kind operationKind) *Operation {
+	return &Operation{kind: kind, done: make(chan struct{})}
+}
+
+func newCompareAndSwap(expected, value []byte) *Operation {
+	operation := newOperation(compareAndSwap)
+	operation.expected, operation.operand = expected, mvcc.NewValue(value)
+	return operation
+}
+
+func newIncrement(delta int64) *Operation {
+	operation := newOperation(increment)
+	operation.delta = delta
+	return operation
+}
+
+func newPutIfAbsent(value []byte) *Operation {
+	operation := newOperation(putIfAbsent)
+	operation.operand = mvcc.NewValue(value)
+	return operation
+}
+
+func newWrite(value mvcc.Value) *Operation {
+	operation := newOperation(write)
+	operation.operand = value
+	return operation
+}
+
+func newMerge(operand mvcc.Value) *Operation {
+	operation := newOperation(merge)
+	operation.operand = operand
+	return operation
+}
+
+// Done returns the channel that is closed once the commit of the transaction is applied, or has failed.
+func (operation *Operation) Done() <-chan struct{} {
+	return operation.done
+}
+
+// Result waits for the commit of the transaction to be applied, and returns the result of the operation.
+// It returns the error of the commit if the transaction did not commit (errors.DiscardedTxnErr for a discarded transaction),
+// errors.NotAnInt64Err for an Increment of a key holding something other than an int64, and ctx.Err() if the context is done first.
+func (operation *Operation) Result(ctx context.Context) (OperationResult, error) {
+	select {
+	case <-operation.done:
+		return operation.result, operation.err
+	case <-ctx.Done():
+		return OperationResult{}, ctx.Err()
+	}
+}
+
+// execute runs the operation against the value of the key, a tombstone if the key does not exist,
+// and returns the value of the key after it along with true if the operation wrote the key.
+// The error is that of a merge onto the value, which fails the commit rather than the operation.
+func (operation *Operation) execute(current mvcc.Value) (mvcc.Value, bool, error) {
+	present := !current.IsTombstone()
+	var currentSlice []byte
+	if present {
+		currentSlice = current.Slice()
+	}
+
+	switch operation.kind {
+	case compareAndSwap:
+		if (present && operation.expected != nil && bytes.Equal(currentSlice, operation.expected)) || (!present && operation.expected == nil) {
+			return operation.wrote(operation.operand)
+		}
+	case increment:
+		counter := int64(0)
+		if present {
+			decoded, err := DecodeInt64(currentSlice)
+			if err != nil {
+				operation.err = err
+				return current, false, nil
+			}
+			counter = decoded
+		}
+		return operation.wrote(mvcc.NewValue(EncodeInt64(counter + operation.delta)))
+	case putIfAbsent:
+		if !present {
+			return operation.wrote(operation.operand)
+		}
+	case write:
+		return operation.operand, true, nil
+	case merge:
+		merged, err := mvcc.ResolveMerge(current, operation.operand)
+		if err != nil {
+			return current, false, err
+		}
+		return merged, true, nil
+	}
+	operation.result = OperationResult{Applied: false, Value: currentSlice}
+	return current, false, nil
+}
+
+func (operation *Operation) wrote(value mvcc.Value) (mvcc.Value, bool, error) {
+	operation.result = OperationResult{Applied: true, Value: value.Slice()}
+	return value, true, nil
+}
+
+// finish publishes the result of the operation, or the error of the commit that failed.
+func (operation *Operation) finish(err error) {
+	if err != nil {
+		operation.result, operation.err = OperationResult{}, err
+	}
+	close(operation.done)
+}
+
+// operandBytes is the number of bytes the operation adds to a batch.
+func (operation *Operation) operandBytes() int64 {
+	return int64(len(operation.expected) + len(operation.operand.Slice()))
+}
+
+// EncodeInt64 encodes the value the way Increment does: 8 bytes, big-endian.
+func EncodeInt64(value int64) []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, uint64(value))
+	return encoded
+}
+
+// DecodeInt64 decodes a value encoded by EncodeInt64, and returns errors.NotAnInt64Err for anything that is not 8 bytes long.
+func DecodeInt64(value []byte) (int64, error) {
+	if len(value) != 8 {
+		return 0, errors.NotAnInt64Err
+	}
+	return int64(binary.BigEndian.Uint64(value)), nil
+}
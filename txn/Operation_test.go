@@ -0,0 +1,152 @@
+package txn
+
+import (
+	"IsoTransact/mvcc"
+	"IsoTransact/txn/errors"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func resultForTest(t *testing.T, operation *Operation) OperationResult {
+	result, err := operation.Result(context.Background())
+	assert.Nil(t, err)
+	return result
+}
+
+func TestComparesAndSwapsAgainstTheValueCommittedAfterTheBeginOfTheTransaction(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+
+	aTransaction, anotherTransaction := NewReadWriteTransaction(oracle), NewReadWriteTransaction(oracle)
+	swap, _ := aTransaction.CompareAndSwap([]byte("HDD"), []byte("Hard disk"), []byte("Hard disk drive"))
+	staleSwap, _ := anotherTransaction.CompareAndSwap([]byte("HDD"), []byte("Hard disk"), []byte("HDD"))
+
+	doneChannel, err := aTransaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, <-doneChannel)
+	doneChannel, err = anotherTransaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, <-doneChannel)
+
+	assert.Equal(t, OperationResult{Applied: true, Value: []byte("Hard disk drive")}, resultForTest(t, swap))
+	assert.Equal(t, OperationResult{Applied: false, Value: []byte("Hard disk drive")}, resultForTest(t, staleSwap))
+
+	value, _ := NewReadOnlyTransaction(oracle).Get([]byte("HDD"))
+	assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+}
+
+func TestIncrementsAHotCounterConcurrentlyWithoutConflicts(t *testing.T) {
+	for _, isolationLevel := range []IsolationLevel{Serializable, SnapshotIsolation} {
+		const goroutines, incrementsPerGoroutine = 8, 25
+		oracle := NewOracleWithIsolationLevel(NewTransactionExecutor(mvcc.NewMemTable(10)), isolationLevel)
+
+		var wg sync.WaitGroup
+		for goroutine := 0; goroutine < goroutines; goroutine++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for count := 0; count < incrementsPerGoroutine; count++ {
+					transaction := NewReadWriteTransaction(oracle)
+					_, _ = transaction.Increment([]byte("counter"), 2)
+					doneChannel, err := transaction.Commit(context.Background())
+					assert.Nil(t, err)
+					assert.Nil(t, <-doneChannel)
+				}
+			}()
+		}
+		wg.Wait()
+
+		value, _ := NewReadOnlyTransaction(oracle).Get([]byte("counter"))
+		counter, err := DecodeInt64(value.Slice())
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2*goroutines*incrementsPerGoroutine), counter)
+	}
+}
+
+func TestPutsIfAbsentOnlyOnceAcrossConcurrentTransactions(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+
+	aTransaction, anotherTransaction := NewReadWriteTransaction(oracle), NewReadWriteTransaction(oracle)
+	aPut, _ := aTransaction.PutIfAbsent([]byte("HDD"), []byte("Hard disk"))
+	anotherPut, _ := anotherTransaction.PutIfAbsent([]byte("HDD"), []byte("Hard disk drive"))
+
+	for _, transaction := range []*ReadWriteTransaction{aTransaction, anotherTransaction} {
+		doneChannel, err := transaction.Commit(context.Background())
+		assert.Nil(t, err)
+		assert.Nil(t, <-doneChannel)
+	}
+
+	assert.Equal(t, OperationResult{Applied: true, Value: []byte("Hard disk")}, resultForTest(t, aPut))
+	assert.Equal(t, OperationResult{Applied: false, Value: []byte("Hard disk")}, resultForTest(t, anotherPut))
+}
+
+func TestExecutesTheOperationsOnAKeyInTheOrderOfTheTransaction(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("counter"), EncodeInt64(10))
+	})
+
+	transaction := NewReadWriteTransaction(oracle)
+	increment, _ := transaction.Increment([]byte("counter"), 5)
+	value, _ := transaction.Get([]byte("counter"))
+	assert.Equal(t, EncodeInt64(10), value.Slice())
+
+	_ = transaction.PutOrUpdate([]byte("counter"), EncodeInt64(100))
+	value, _ = transaction.Get([]byte("counter"))
+	assert.Equal(t, EncodeInt64(100), value.Slice())
+
+	anotherIncrement, _ := transaction.Increment([]byte("counter"), 1)
+	_ = transaction.PutOrUpdate([]byte("disk"), EncodeInt64(1))
+	diskIncrement, _ := transaction.Increment([]byte("disk"), 1)
+	value, _ = transaction.Get([]byte("disk"))
+	assert.Equal(t, EncodeInt64(2), value.Slice())
+
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, <-doneChannel)
+
+	assert.Equal(t, EncodeInt64(15), resultForTest(t, increment).Value)
+	assert.Equal(t, EncodeInt64(101), resultForTest(t, anotherIncrement).Value)
+	assert.Equal(t, EncodeInt64(2), resultForTest(t, diskIncrement).Value)
+
+	value, _ = NewReadOnlyTransaction(oracle).Get([]byte("counter"))
+	assert.Equal(t, EncodeInt64(101), value.Slice())
+}
+
+func TestFailsTheIncrementOfAValueThatIsNotAnInt64AndAppliesTheRestOfTheBatch(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+
+	transaction := NewReadWriteTransaction(oracle)
+	increment, _ := transaction.Increment([]byte("HDD"), 1)
+	_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, <-doneChannel)
+
+	_, err = increment.Result(context.Background())
+	assert.Equal(t, errors.NotAnInt64Err, err)
+
+	readOnlyTransaction := NewReadOnlyTransaction(oracle)
+	value, _ := readOnlyTransaction.Get([]byte("HDD"))
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+	value, _ = readOnlyTransaction.Get([]byte("SSD"))
+	assert.Equal(t, []byte("Solid state"), value.Slice())
+}
+
+func TestFailsTheOperationsOfADiscardedTransaction(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+
+	transaction := NewReadWriteTransaction(oracle)
+	increment, _ := transaction.Increment([]byte("counter"), 1)
+	transaction.Discard()
+
+	_, err := increment.Result(context.Background())
+	assert.Equal(t, errors.DiscardedTxnErr, err)
+}
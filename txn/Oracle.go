@@ -3,32 +3,85 @@ package txn
 import (
 	errors2 "IsoTransact/txn/errors"
 	"context"
+	"sort"
 	"sync"
+	"time"
 )
 
+// CommittedTransaction is what the oracle keeps of a committed transaction till no open transaction began before its commit:
+// the keys it wrote and their fingerprints.
 type CommittedTransaction struct {
 	commitTimestamp uint64
-	transaction     *ReadWriteTransaction
+	fingerprints    []uint64
+	keys            [][]byte
 }
 
 type Oracle struct {
 	timeStampGeneratorLock sync.Mutex
 	nextTimestamp          uint64
-	committedTransactions  []CommittedTransaction
+	committedTransactions  []CommittedTransaction //in the increasing order of their commit timestamps
+	lastCommitByKey        map[uint64]uint64      //fingerprint -> the last commit timestamp of the committedTransactions writing the key
+	committedKeys          *committedKeyIndex     //the keys of the committedTransactions in order, for the ranges read
 
 	beginTimestampMark  *TransactionTimestampMark
 	commitTimestampMark *TransactionTimestampMark
 
 	transactionExecutor *TransactionExecutor
-	executorLock        sync.Mutex
+	//executorLock is held from taking a commit timestamp till the batch is queued for the executor,
+	//it is a channel so that a commit can give up waiting for it when its context is done
+	executorLock   chan struct{}
+	isolationLevel IsolationLevel
+	maxBatchPairs  int
+	maxBatchBytes  int64
+
+	lockManager     *LockManager
+	lockWaitTimeout time.Duration
+
+	openTransactionsLock sync.Mutex
+	openTransactions     map[interface{}]OpenTransaction
+
+	//historicalReadsLock guards the timestamps pinned by the read-only transactions at a past timestamp,
+	//and the highest discard watermark claimed, below which the versions may already be discarded
+	historicalReadsLock sync.Mutex
+	historicalReads     map[uint64]int
+	discardedTill       uint64
+}
+
+// OpenTransaction describes a transaction whose begin timestamp is not finished yet.
+type OpenTransaction struct {
+	BeginTimestamp uint64
+	ReadWrite      bool
+	OpenedAt       time.Time
 }
 
 func NewOracle(transactionExecutor *TransactionExecutor) *Oracle {
+	return NewOracleWithIsolationLevel(transactionExecutor, Serializable)
+}
+
+func NewOracleWithIsolationLevel(transactionExecutor *TransactionExecutor, isolationLevel IsolationLevel) *Oracle {
+	return NewRecoveredOracle(transactionExecutor, 0, 0, isolationLevel)
+}
+
+// NewRecoveredOracle creates an oracle that resumes handing out commit timestamps after lastCommitTimestamp,
+// the highest commit timestamp replayed from the write-ahead log. The reads at a past timestamp below discardedTill,
+// the highest discard watermark the storage may have discarded versions below before the restart, are refused.
+func NewRecoveredOracle(transactionExecutor *TransactionExecutor, lastCommitTimestamp uint64, discardedTill uint64, isolationLevel IsolationLevel) *Oracle {
 	oracle := &Oracle{
-		nextTimestamp:       1,
+		nextTimestamp:       lastCommitTimestamp + 1,
 		transactionExecutor: transactionExecutor,
+		isolationLevel:      isolationLevel,
 		beginTimestampMark:  NewTransactionTimestampMark(),
 		commitTimestampMark: NewTransactionTimestampMark(),
+		openTransactions:    make(map[interface{}]OpenTransaction),
+		lastCommitByKey:     make(map[uint64]uint64),
+		committedKeys:       newCommittedKeyIndex(),
+		executorLock:        make(chan struct{}, 1),
+		historicalReads:     make(map[uint64]int),
+		maxBatchPairs:       DefaultMaxBatchPairs,
+		maxBatchBytes:       DefaultMaxBatchBytes,
+		lockManager:         NewLockManager(),
+		lockWaitTimeout:     DefaultLockWaitTimeout,
+		discardedTill:       discardedTill,
 	}
 
 	oracle.beginTimestampMark.Finish(oracle.nextTimestamp - 1)
@@ -36,7 +89,9 @@ func NewOracle(transactionExecutor *TransactionExecutor) *Oracle {
 	return oracle
 }
 
-func (oracle *Oracle) beginTimestamp() uint64 {
+// beginTimestamp returns ctx.Err() if the context is done before all the commits till the begin timestamp are applied,
+// in which case the begin timestamp is already finished.
+func (oracle *Oracle) beginTimestamp(ctx context.Context) (uint64, error) {
 	oracle.timeStampGeneratorLock.Lock()
 	beginTimestamp := oracle.nextTimestamp - 1
 	oracle.beginTimestampMark.Begin(beginTimestamp)
@@ -45,8 +100,11 @@ func (oracle *Oracle) beginTimestamp() uint64 {
 	//Before returning the beginTimestamp, the system waits to
 	//ensure that all the commits till beginTimestamp are applied.
 	//NOTE: The wait here is on commitTimestampMark not beginTimestampMark
-	_ = oracle.commitTimestampMark.WaitForMark(context.Background(), beginTimestamp)
-	return beginTimestamp
+	if err := oracle.commitTimestampMark.WaitForMark(ctx, beginTimestamp); err != nil {
+		oracle.beginTimestampMark.Finish(beginTimestamp)
+		return 0, err
+	}
+	return beginTimestamp, nil
 }
 
 func (oracle *Oracle) maybeCommitTimestampFor(rwTransaction *ReadWriteTransaction) (uint64, error) {
@@ -69,53 +127,316 @@ func (oracle *Oracle) maybeCommitTimestampFor(rwTransaction *ReadWriteTransactio
 	return commitTimestamp, nil
 }
 
+// hasConflictFor checks the transaction against the transactions committed after it began:
+// under SnapshotIsolation against their writes, under Serializable against its reads and the ranges it read.
+// A key is checked with a lookup in lastCommitByKey, and a range with a seek in committedKeys, whatever the number of the committed transactions.
+// A key written by the operations executed at apply time, or merged into, is not read at the begin timestamp, and does not conflict.
 func (oracle *Oracle) hasConflictFor(transaction *ReadWriteTransaction) bool {
-	for _, committedTransaction := range oracle.committedTransactions {
-		//There is temporal overlap
-		if committedTransaction.commitTimestamp > transaction.beginTimestamp {
-			//Check for spatial overlap between committed transactions written value and current transactions read value
-			for _, key := range transaction.reads {
-				if committedTransaction.transaction.batch.Contains(key) {
-					return true
-				}
+	if oracle.isolationLevel == SnapshotIsolation {
+		for _, pair := range transaction.batch.pairs {
+			if len(pair.pending) > 0 || pair.value.IsMergeOperand() {
+				continue
+			}
+			keyFingerprint := fingerprint(pair.key)
+			if oracle.lastCommitByKey[keyFingerprint] > transaction.readTimestampOf(keyFingerprint) {
+				return true
 			}
 		}
+		return false
+	}
+	for _, readFingerprint := range transaction.reads {
+		if oracle.lastCommitByKey[readFingerprint] > transaction.readTimestampOf(readFingerprint) {
+			return true
+		}
+	}
+	for _, readRange := range transaction.readRanges {
+		if oracle.committedKeys.lastCommitTimestampIn(readRange.start, readRange.end) > transaction.beginTimestamp {
+			return true
+		}
 	}
 	return false
 }
 
-// Begin phase of RW transaction ends here
+// Begin phase of RW transaction ends here, either on commit or when the transaction is abandoned.
+// The mark counts the transactions at a timestamp, so the begin timestamp is finished only once.
+// The key locks of the transaction are released along, once the commit timestamp is about to be handed out:
+// a transaction that gets one of the locks then reads at or after that commit timestamp (see ReadWriteTransaction.GetForUpdate).
 func (oracle *Oracle) finishBeginTimestampForReadWriteTransaction(transaction *ReadWriteTransaction) {
+	oracle.lockManager.ReleaseAll(transaction)
+	if transaction.beginFinished {
+		return
+	}
+	transaction.beginFinished = true
+	oracle.untrackOpenTransaction(transaction)
 	oracle.beginTimestampMark.Finish(transaction.beginTimestamp)
 }
 
+// cleanupCommittedTransactions forgets the transactions committed at or before the begin timestamp of every open transaction.
 func (oracle *Oracle) cleanupCommittedTransactions() {
-	updatedCommittedTransactions := make([]CommittedTransaction, 0)
 	maxBeginTransactionTimestamp := oracle.beginTimestampMark.DoneTill()
 
+	cleaned := 0
 	for _, transaction := range oracle.committedTransactions {
 		if transaction.commitTimestamp > maxBeginTransactionTimestamp {
-			updatedCommittedTransactions = append(updatedCommittedTransactions, transaction)
+			break
+		}
+		for _, keyFingerprint := range transaction.fingerprints {
+			if oracle.lastCommitByKey[keyFingerprint] == transaction.commitTimestamp {
+				delete(oracle.lastCommitByKey, keyFingerprint)
+			}
+		}
+		for _, key := range transaction.keys {
+			oracle.committedKeys.remove(key, transaction.commitTimestamp)
 		}
+		cleaned++
 	}
-	oracle.committedTransactions = updatedCommittedTransactions
+	oracle.committedTransactions = oracle.committedTransactions[cleaned:]
+}
+
+// abandonCommit undoes maybeCommitTimestampFor for a transaction whose batch never reached the executor:
+// the transaction is not tracked for conflicts anymore, and its commit timestamp is finished without any write,
+// so that the readers waiting on the commitTimestampMark do not wait for it.
+func (oracle *Oracle) abandonCommit(transaction *ReadWriteTransaction, commitTimestamp uint64) {
+	oracle.timeStampGeneratorLock.Lock()
+	defer oracle.timeStampGeneratorLock.Unlock()
+
+	for index, committedTransaction := range oracle.committedTransactions {
+		if committedTransaction.commitTimestamp != commitTimestamp {
+			continue
+		}
+		oracle.committedTransactions = append(oracle.committedTransactions[:index], oracle.committedTransactions[index+1:]...)
+		//the keys fall back to the last of the remaining transactions that wrote them
+		for _, keyFingerprint := range committedTransaction.fingerprints {
+			if oracle.lastCommitByKey[keyFingerprint] == commitTimestamp {
+				delete(oracle.lastCommitByKey, keyFingerprint)
+			}
+		}
+		for _, key := range committedTransaction.keys {
+			oracle.committedKeys.remove(key, commitTimestamp)
+		}
+		for _, remaining := range oracle.committedTransactions {
+			for _, keyFingerprint := range remaining.fingerprints {
+				if _, ok := oracle.lastCommitByKey[keyFingerprint]; !ok || remaining.commitTimestamp > oracle.lastCommitByKey[keyFingerprint] {
+					oracle.lastCommitByKey[keyFingerprint] = remaining.commitTimestamp
+				}
+			}
+			for _, key := range remaining.keys {
+				if remaining.commitTimestamp > oracle.committedKeys.lastCommitTimestamp(key) {
+					oracle.committedKeys.put(key, remaining.commitTimestamp)
+				}
+			}
+		}
+		break
+	}
+	oracle.commitTimestampMark.Finish(commitTimestamp)
 }
 
 func (oracle *Oracle) trackReadyToCommitTimestamp(transaction *ReadWriteTransaction, timestamp uint64) {
-	oracle.committedTransactions = append(oracle.committedTransactions, CommittedTransaction{
-		transaction:     transaction,
+	pairs := transaction.batch.pairsInRange(nil, nil)
+	committedTransaction := CommittedTransaction{
 		commitTimestamp: timestamp,
-	})
+		fingerprints:    make([]uint64, 0, len(pairs)),
+		keys:            make([][]byte, 0, len(pairs)),
+	}
+	for _, pair := range pairs {
+		keyFingerprint := fingerprint(pair.key)
+		committedTransaction.fingerprints = append(committedTransaction.fingerprints, keyFingerprint)
+		committedTransaction.keys = append(committedTransaction.keys, pair.key)
+		oracle.lastCommitByKey[keyFingerprint] = timestamp
+		oracle.committedKeys.put(pair.key, timestamp)
+	}
+	oracle.committedTransactions = append(oracle.committedTransactions, committedTransaction)
 }
 
 func (oracle *Oracle) finishBeginTimestampForReadonlyTransaction(transaction *ReadOnlyTransaction) {
+	if transaction.beginFinished {
+		return
+	}
+	transaction.beginFinished = true
+	oracle.untrackOpenTransaction(transaction)
+	if transaction.historical {
+		oracle.unpinHistoricalTimestamp(transaction.beginTimestamp)
+		return
+	}
 	oracle.beginTimestampMark.Finish(transaction.beginTimestamp)
 }
 
-func (oracle *Oracle) Stop() {
+// SetBatchLimits limits the keys, and the bytes of keys and values, written by a transaction (see NewBatchWithLimits);
+// a limit of 0 or less keeps the default. It is called before the first transaction begins.
+func (oracle *Oracle) SetBatchLimits(maxPairs int, maxBytes int64) {
+	if maxPairs > 0 {
+		oracle.maxBatchPairs = maxPairs
+	}
+	if maxBytes > 0 {
+		oracle.maxBatchBytes = maxBytes
+	}
+}
+
+// SetLockWaitTimeout bounds the wait for a key lock taken with ReadWriteTransaction.GetForUpdate; 0 or less keeps the default.
+// It is called before the first transaction begins.
+func (oracle *Oracle) SetLockWaitTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		oracle.lockWaitTimeout = timeout
+	}
+}
+
+// pinHistoricalTimestamp keeps the discard watermark at or below the timestamp, till it is unpinned.
+// It fails if no commit timestamp at or above the timestamp is handed out yet, or if a discard watermark above it was already handed out.
+// It waits till the commits at or below the timestamp are applied, and returns ctx.Err() if the context is done before.
+func (oracle *Oracle) pinHistoricalTimestamp(ctx context.Context, timestamp uint64) error {
+	oracle.timeStampGeneratorLock.Lock()
+	lastCommitTimestamp := oracle.nextTimestamp - 1
+	oracle.timeStampGeneratorLock.Unlock()
+	if timestamp > lastCommitTimestamp {
+		return errors2.UncommittedTimestampErr
+	}
+	if err := oracle.commitTimestampMark.WaitForMark(ctx, timestamp); err != nil {
+		return err
+	}
+	oracle.historicalReadsLock.Lock()
+	defer oracle.historicalReadsLock.Unlock()
+
+	if timestamp < oracle.discardedTill {
+		return errors2.DiscardedTimestampErr
+	}
+	oracle.historicalReads[timestamp]++
+	return nil
+}
+
+func (oracle *Oracle) unpinHistoricalTimestamp(timestamp uint64) {
+	oracle.historicalReadsLock.Lock()
+	defer oracle.historicalReadsLock.Unlock()
+
+	oracle.historicalReads[timestamp]--
+	if oracle.historicalReads[timestamp] == 0 {
+		delete(oracle.historicalReads, timestamp)
+	}
+}
+
+// CommittedTimestamp returns the last commit timestamp handed out, once the commits till it are applied.
+// It returns the timestamp till which the commits are applied if the oracle stops in the meantime.
+func (oracle *Oracle) CommittedTimestamp() uint64 {
+	timestamp, err := oracle.CommittedTimestampWithContext(context.Background())
+	if err != nil {
+		return oracle.commitTimestampMark.DoneTill()
+	}
+	return timestamp
+}
+
+// CommittedTimestampWithContext returns ctx.Err() if the context is done before the commits till the last commit timestamp are applied,
+// and TimestampMarkStoppedErr if the oracle stops in the meantime.
+func (oracle *Oracle) CommittedTimestampWithContext(ctx context.Context) (uint64, error) {
+	oracle.timeStampGeneratorLock.Lock()
+	lastCommitTimestamp := oracle.nextTimestamp - 1
+	oracle.timeStampGeneratorLock.Unlock()
+
+	if err := oracle.commitTimestampMark.WaitForMark(ctx, lastCommitTimestamp); err != nil {
+		return 0, err
+	}
+	return lastCommitTimestamp, nil
+}
+
+func (oracle *Oracle) trackOpenTransaction(transaction interface{}, beginTimestamp uint64, readWrite bool) {
+	oracle.openTransactionsLock.Lock()
+	defer oracle.openTransactionsLock.Unlock()
+
+	oracle.openTransactions[transaction] = OpenTransaction{BeginTimestamp: beginTimestamp, ReadWrite: readWrite, OpenedAt: time.Now()}
+}
+
+func (oracle *Oracle) untrackOpenTransaction(transaction interface{}) {
+	oracle.openTransactionsLock.Lock()
+	defer oracle.openTransactionsLock.Unlock()
+
+	delete(oracle.openTransactions, transaction)
+}
+
+// OpenTransactionsOlderThan returns the transactions that were opened more than the given duration ago and are neither
+// committed nor discarded. Such a transaction holds back the beginTimestampMark, and with it the cleanup of the committed
+// transactions and the discard of the old versions, so an entry that keeps showing up is most likely a leaked transaction.
+func (oracle *Oracle) OpenTransactionsOlderThan(age time.Duration) []OpenTransaction {
+	oracle.openTransactionsLock.Lock()
+	defer oracle.openTransactionsLock.Unlock()
+
+	var openTransactions []OpenTransaction
+	for _, openTransaction := range oracle.openTransactions {
+		if time.Since(openTransaction.OpenedAt) > age {
+			openTransactions = append(openTransactions, openTransaction)
+		}
+	}
+	sort.Slice(openTransactions, func(i, j int) bool {
+		return openTransactions[i].OpenedAt.Before(openTransactions[j].OpenedAt)
+	})
+	return openTransactions
+}
+
+// DiscardWatermark returns the timestamp at or above which every current and future transaction reads.
+// All the begin timestamps till beginTimestampMark.DoneTill() are finished, and a new transaction never begins
+// below it, so the versions shadowed by a newer version at or below the watermark can not be observed anymore.
+// A read-only transaction at a past timestamp holds the watermark at its timestamp.
+func (oracle *Oracle) DiscardWatermark() uint64 {
+	oracle.historicalReadsLock.Lock()
+	defer oracle.historicalReadsLock.Unlock()
+
+	return oracle.discardWatermark()
+}
+
+// ClaimDiscardWatermark returns the discard watermark for the storage to discard the versions below it right after,
+// and refuses the reads at a past timestamp below it from then on.
+func (oracle *Oracle) ClaimDiscardWatermark() uint64 {
+	oracle.historicalReadsLock.Lock()
+	defer oracle.historicalReadsLock.Unlock()
+
+	watermark := oracle.discardWatermark()
+	if watermark > oracle.discardedTill {
+		oracle.discardedTill = watermark
+	}
+	return watermark
+}
+
+// discardWatermark computes the discard watermark, the caller holds the historicalReadsLock.
+func (oracle *Oracle) discardWatermark() uint64 {
+	watermark := oracle.beginTimestampMark.DoneTill()
+	for timestamp := range oracle.historicalReads {
+		if timestamp < watermark {
+			watermark = timestamp
+		}
+	}
+	return watermark
+}
+
+// Drain waits till every open transaction is finished and every commit timestamp handed out is applied,
+// or till the context is done. The caller makes sure that no new transaction begins in the meantime.
+func (oracle *Oracle) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for oracle.numberOfOpenTransactions() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	oracle.timeStampGeneratorLock.Lock()
+	lastCommitTimestamp := oracle.nextTimestamp - 1
+	oracle.timeStampGeneratorLock.Unlock()
+	return oracle.commitTimestampMark.WaitForMark(ctx, lastCommitTimestamp)
+}
+
+func (oracle *Oracle) numberOfOpenTransactions() int {
+	oracle.openTransactionsLock.Lock()
+	defer oracle.openTransactionsLock.Unlock()
+
+	return len(oracle.openTransactions)
+}
+
+// Stop stops the executor before the marks, as the executor finishes commit timestamps till it stops.
+// The transactions still running after the stop fail to commit with ExecutorStoppedErr. It is safe to call more than once.
+func (oracle *Oracle) Stop() error {
+	err := oracle.transactionExecutor.Stop()
 	oracle.beginTimestampMark.Stop()
 	oracle.commitTimestampMark.Stop()
-	oracle.transactionExecutor.Stop()
+	return err
 }
 
 func (oracle *Oracle) CommittedTransactionLength() int {
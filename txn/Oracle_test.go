@@ -1,16 +1,20 @@
 package txn
 
 import (
+	"IsoTransact/lsm"
 	"IsoTransact/mvcc"
 	"IsoTransact/txn/errors"
+	"context"
 	"github.com/stretchr/testify/assert"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestGetsTheBeginTimestamp(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
 	oracle := NewOracle(NewTransactionExecutor(memTable))
-	assert.Equal(t, uint64(0), oracle.beginTimestamp())
+	assert.Equal(t, uint64(0), beginTimestampForTest(oracle))
 }
 
 func TestGetsTheBeginTimestampAfterACommit(t *testing.T) {
@@ -24,8 +28,8 @@ func TestGetsTheBeginTimestampAfterACommit(t *testing.T) {
 	oracle.commitTimestampMark.Finish(commitTimestamp)
 
 	assert.Equal(t, uint64(1), commitTimestamp)
-	assert.Equal(t, uint64(1), oracle.beginTimestamp())
-	assert.Equal(t, uint64(1), oracle.beginTimestamp())
+	assert.Equal(t, uint64(1), beginTimestampForTest(oracle))
+	assert.Equal(t, uint64(1), beginTimestampForTest(oracle))
 }
 
 func TestGetsCommitTimestampFor2Transactions(t *testing.T) {
@@ -100,3 +104,279 @@ func TestErrorsForOneTransaction(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, errors.ConflictErr, err)
 }
+
+func TestErrorsForATransactionThatReadAKeyDeletedByAConcurrentTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable))
+
+	aTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction := NewReadWriteTransaction(oracle)
+
+	_ = aTransaction.Delete([]byte("HDD"))
+	commitTimestamp, _ := oracle.maybeCommitTimestampFor(aTransaction)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	anotherTransaction.Get([]byte("HDD"))
+	_ = anotherTransaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+
+	_, err := oracle.maybeCommitTimestampFor(anotherTransaction)
+	assert.Error(t, err)
+	assert.Equal(t, errors.ConflictErr, err)
+}
+
+func TestErrorsForATransactionThatScannedARangeIntoWhichAConcurrentTransactionInserted(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("order:user1:1"), []byte("HDD"))
+		_ = transaction.PutOrUpdate([]byte("order:user1:2"), []byte("SSD"))
+	})
+
+	aTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction := NewReadWriteTransaction(oracle)
+
+	assert.Equal(t, []string{"order:user1:1", "order:user1:2"}, keysOf(aTransaction.PrefixIterator([]byte("order:user1:"))))
+	_ = aTransaction.PutOrUpdate([]byte("orderCount:user1"), []byte("2"))
+
+	_ = anotherTransaction.PutOrUpdate([]byte("order:user1:3"), []byte("NVMe"))
+	commitTimestamp, err := oracle.maybeCommitTimestampFor(anotherTransaction)
+	assert.Nil(t, err)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	_, err = oracle.maybeCommitTimestampFor(aTransaction)
+	assert.Equal(t, errors.ConflictErr, err)
+}
+
+func TestDoesNotErrorForATransactionThatScannedARangeOutsideTheWritesOfAConcurrentTransaction(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	commitForTest(t, oracle, func(transaction *ReadWriteTransaction) {
+		_ = transaction.PutOrUpdate([]byte("order:user1:1"), []byte("HDD"))
+	})
+
+	aTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction := NewReadWriteTransaction(oracle)
+
+	assert.Equal(t, []string{"order:user1:1"}, keysOf(aTransaction.Iterator([]byte("order:user1:"), []byte("order:user2:"))))
+	_ = aTransaction.PutOrUpdate([]byte("orderCount:user1"), []byte("1"))
+
+	_ = anotherTransaction.PutOrUpdate([]byte("order:user2:1"), []byte("NVMe"))
+	commitTimestamp, err := oracle.maybeCommitTimestampFor(anotherTransaction)
+	assert.Nil(t, err)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	_, err = oracle.maybeCommitTimestampFor(aTransaction)
+	assert.Nil(t, err)
+}
+
+func TestDoesNotConflictWithADiscardedTransaction(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+
+	aTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction := NewReadWriteTransaction(oracle)
+
+	_ = aTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	aTransaction.Discard()
+	_, err := aTransaction.Commit(context.Background())
+	assert.Equal(t, errors.DiscardedTxnErr, err)
+
+	anotherTransaction.Get([]byte("HDD"))
+	_ = anotherTransaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	_, err = oracle.maybeCommitTimestampFor(anotherTransaction)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, oracle.CommittedTransactionLength())
+}
+
+func beginTimestampForTest(oracle *Oracle) uint64 {
+	beginTimestamp, _ := oracle.beginTimestamp(context.Background())
+	return beginTimestamp
+}
+
+func stuckTransactionExecutorForTest() *TransactionExecutor {
+	//no spin, the queue never drains
+	return &TransactionExecutor{batchChannel: make(chan TimestampedBatch), engine: lsm.NewInMemoryTree(mvcc.NewMemTable(10))}
+}
+
+func TestGivesUpBeginningATransactionOnceTheContextIsDone(t *testing.T) {
+	oracle := NewOracle(stuckTransactionExecutorForTest())
+	transaction := NewReadWriteTransaction(oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	_, _ = oracle.maybeCommitTimestampFor(transaction)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := NewReadOnlyTransactionWithContext(ctx, oracle)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	assert.Eventually(t, func() bool {
+		return oracle.beginTimestampMark.DoneTill() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestAbandonsACommitThatCouldNotBeQueuedBeforeTheContextIsDone(t *testing.T) {
+	oracle := NewOracle(stuckTransactionExecutorForTest())
+	transaction := NewReadWriteTransaction(oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := transaction.Commit(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, oracle.CommittedTransactionLength())
+
+	assert.Eventually(t, func() bool {
+		return oracle.commitTimestampMark.DoneTill() == 1
+	}, time.Second, time.Millisecond)
+
+	//the abandoned commit does not conflict with a transaction that read its key
+	anotherTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction.Get([]byte("HDD"))
+	_ = anotherTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+	_, err = oracle.maybeCommitTimestampFor(anotherTransaction)
+	assert.Nil(t, err)
+}
+
+func TestGivesUpCommittingWhileAnotherCommitHoldsTheExecutor(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	oracle.executorLock <- struct{}{}
+
+	transaction := NewReadWriteTransaction(oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := transaction.Commit(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, oracle.CommittedTransactionLength())
+}
+
+func TestHoldsTheDiscardWatermarkAtAPinnedPastTimestamp(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+	for count := 1; count <= 3; count++ {
+		transaction := NewReadWriteTransaction(oracle)
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk:"+strconv.Itoa(count)))
+		assert.Nil(t, commitAndWait(transaction))
+	}
+
+	transaction, err := NewReadOnlyTransactionAt(context.Background(), oracle, 1)
+	assert.Nil(t, err)
+	value, _ := transaction.Get([]byte("HDD"))
+	assert.Equal(t, []byte("Hard disk:1"), value.Slice())
+	assert.Equal(t, uint64(1), oracle.DiscardWatermark())
+
+	transaction.FinishBeginTimestampForReadonlyTransaction()
+	assert.Eventually(t, func() bool {
+		return oracle.DiscardWatermark() > 1
+	}, time.Second, time.Millisecond)
+
+	//nothing is discarded till the storage claims the watermark
+	transaction, err = NewReadOnlyTransactionAt(context.Background(), oracle, 1)
+	assert.Nil(t, err)
+	transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	assert.True(t, oracle.ClaimDiscardWatermark() > 1)
+	_, err = NewReadOnlyTransactionAt(context.Background(), oracle, 1)
+	assert.Equal(t, errors.DiscardedTimestampErr, err)
+}
+
+func TestConflictsWithAnEarlierCommitOfAKeyOnceALaterCommitOfTheKeyIsAbandoned(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+
+	reader := NewReadWriteTransaction(oracle)
+	reader.Get([]byte("HDD"))
+	_ = reader.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+
+	for count := 1; count <= 2; count++ {
+		writer := NewReadWriteTransaction(oracle)
+		_ = writer.PutOrUpdate([]byte("HDD"), []byte("Hard disk:"+strconv.Itoa(count)))
+		commitTimestamp, err := oracle.maybeCommitTimestampFor(writer)
+		assert.Nil(t, err)
+		if count == 2 {
+			oracle.abandonCommit(writer, commitTimestamp)
+			continue
+		}
+		oracle.commitTimestampMark.Finish(commitTimestamp)
+	}
+
+	_, err := oracle.maybeCommitTimestampFor(reader)
+	assert.Equal(t, errors.ConflictErr, err)
+}
+
+func TestDoesNotConflictWithACommitWhoseKeysSpanARangeReadByTheTransaction(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+
+	aTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction := NewReadWriteTransaction(oracle)
+
+	assert.Equal(t, 0, len(keysOf(aTransaction.PrefixIterator([]byte("order:user1:")))))
+	_ = aTransaction.PutOrUpdate([]byte("orderCount:user1"), []byte("0"))
+
+	//the keys are on both sides of the range, none is in it
+	_ = anotherTransaction.PutOrUpdate([]byte("order:user0:1"), []byte("HDD"))
+	_ = anotherTransaction.PutOrUpdate([]byte("order:user2:1"), []byte("SSD"))
+	commitTimestamp, err := oracle.maybeCommitTimestampFor(anotherTransaction)
+	assert.Nil(t, err)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	_, err = oracle.maybeCommitTimestampFor(aTransaction)
+	assert.Nil(t, err)
+}
+
+// benchmarkConflictCheck checks a transaction that read 16 keys, or 16 ranges, against the given number of transactions committed after it began.
+// The keys of every committed transaction lie on both sides of the ranges read, none in them.
+func benchmarkConflictCheck(b *testing.B, committedTransactions int, readRanges bool) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+	defer oracle.Stop()
+
+	transaction := NewReadWriteTransaction(oracle)
+	for count := 0; count < 16; count++ {
+		if readRanges {
+			transaction.PrefixIterator([]byte("Read:" + strconv.Itoa(count) + ":")).Close()
+		} else {
+			transaction.Get([]byte("Read:" + strconv.Itoa(count)))
+		}
+	}
+	for count := 0; count < committedTransactions; count++ {
+		writer := NewReadWriteTransaction(oracle)
+		_ = writer.PutOrUpdate([]byte("Append:"+strconv.Itoa(count)), []byte("Value"))
+		for key := 0; key < 3; key++ {
+			_ = writer.PutOrUpdate([]byte("Write:"+strconv.Itoa(count)+":"+strconv.Itoa(key)), []byte("Value"))
+		}
+		commitTimestamp, _ := oracle.maybeCommitTimestampFor(writer)
+		oracle.commitTimestampMark.Finish(commitTimestamp)
+	}
+
+	b.ResetTimer()
+	for count := 0; count < b.N; count++ {
+		if oracle.hasConflictFor(transaction) {
+			b.Fatal("unexpected conflict")
+		}
+	}
+}
+
+func BenchmarkChecksConflictsAgainstConcurrentlyCommittedTransactions(b *testing.B) {
+	for _, committedTransactions := range []int{10, 100, 1000, 10000} {
+		b.Run("committed="+strconv.Itoa(committedTransactions), func(b *testing.B) {
+			benchmarkConflictCheck(b, committedTransactions, false)
+		})
+		b.Run("ranges/committed="+strconv.Itoa(committedTransactions), func(b *testing.B) {
+			benchmarkConflictCheck(b, committedTransactions, true)
+		})
+	}
+}
+
+func TestChecksTheRangesReadInTheSameTimeWhateverTheNumberOfCommittedTransactions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("benchmarks the conflict check")
+	}
+	nanosecondsPerCheck := func(committedTransactions int) int64 {
+		return testing.Benchmark(func(b *testing.B) {
+			benchmarkConflictCheck(b, committedTransactions, true)
+		}).NsPerOp()
+	}
+
+	few, many := nanosecondsPerCheck(10), nanosecondsPerCheck(10000)
+	//a seek grows with the depth of the index only, a scan of the committed transactions would take about 1000 times as long
+	assert.Less(t, many, 20*few)
+}
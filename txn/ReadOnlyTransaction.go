@@ -1,24 +1,123 @@
 package txn
 
-import "IsoTransact/mvcc"
+import (
+	"IsoTransact/mvcc"
+	"context"
+)
 
 type ReadOnlyTransaction struct {
 	beginTimestamp uint64
-	memTable       *mvcc.MemTable
+	engine         mvcc.StorageEngine
 	oracle         *Oracle
+	beginFinished  bool
+	historical     bool  //reads at a past timestamp, see NewReadOnlyTransactionAt
+	readErr        error //the first error of reading the engine, see Err
 }
 
+// NewReadOnlyTransaction returns nil if the oracle is stopped before the commits till the begin timestamp are applied;
+// NewReadOnlyTransactionWithContext returns the error instead.
 func NewReadOnlyTransaction(oracle *Oracle) *ReadOnlyTransaction {
-	return &ReadOnlyTransaction{
-		beginTimestamp: oracle.beginTimestamp(),
+	transaction, _ := NewReadOnlyTransactionWithContext(context.Background(), oracle)
+	return transaction
+}
+
+// NewReadOnlyTransactionWithContext returns ctx.Err() if the context is done before the commits till the begin timestamp are applied.
+func NewReadOnlyTransactionWithContext(ctx context.Context, oracle *Oracle) (*ReadOnlyTransaction, error) {
+	beginTimestamp, err := oracle.beginTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transaction := &ReadOnlyTransaction{
+		beginTimestamp: beginTimestamp,
+		oracle:         oracle,
+		engine:         oracle.transactionExecutor.engine,
+	}
+	oracle.trackOpenTransaction(transaction, transaction.beginTimestamp, false)
+	return transaction, nil
+}
+
+// NewReadOnlyTransactionAt returns a transaction that reads at a past commit timestamp, holding the discard watermark at the timestamp
+// till it is finished. It returns errors.DiscardedTimestampErr if the versions at the timestamp may already be garbage collected,
+// and errors.UncommittedTimestampErr if the timestamp is beyond Oracle.CommittedTimestamp. It returns ctx.Err() if the context is done
+// before the commits till the timestamp are applied.
+func NewReadOnlyTransactionAt(ctx context.Context, oracle *Oracle, timestamp uint64) (*ReadOnlyTransaction, error) {
+	if err := oracle.pinHistoricalTimestamp(ctx, timestamp); err != nil {
+		return nil, err
+	}
+	transaction := &ReadOnlyTransaction{
+		beginTimestamp: timestamp,
 		oracle:         oracle,
-		memTable:       oracle.transactionExecutor.memtable,
+		engine:         oracle.transactionExecutor.engine,
+		historical:     true,
 	}
+	oracle.trackOpenTransaction(transaction, transaction.beginTimestamp, false)
+	return transaction, nil
 }
 
+// Get reads the key at the begin timestamp of the transaction, with the merge operands folded onto the value below them.
+// A key that fails to be read is not found, see Err.
 func (transaction *ReadOnlyTransaction) Get(key []byte) (mvcc.Value, bool) {
-	versionedKey := mvcc.NewVersionedKey(key, transaction.beginTimestamp)
-	return transaction.memTable.Get(*versionedKey)
+	value, ok, err := read(transaction.engine, key, transaction.beginTimestamp)
+	if err != nil {
+		transaction.failRead(err)
+		return mvcc.Value{}, false
+	}
+	return visible(value, ok)
+}
+
+// History returns, newest first, up to limit versions of the key that are visible at the begin timestamp of the transaction;
+// a limit of 0 or less returns all of them. The versions already removed by the version GC or a compaction are not returned.
+func (transaction *ReadOnlyTransaction) History(key []byte, limit int) ([]KeyVersion, error) {
+	versions, err := history(transaction.engine, key, transaction.beginTimestamp, limit)
+	if err != nil {
+		transaction.failRead(err)
+	}
+	return versions, err
+}
+
+// Err returns the first error the transaction met reading the engine, a failure to read a table or errors.UnknownMergeOperatorErr
+// for a merge operand of an operator that is not registered. The reads after it can not be trusted:
+// Get does not find the key it fails to read, and an iterator stops at the failure. KeyValueDB.Get returns it after the callback.
+func (transaction *ReadOnlyTransaction) Err() error {
+	return transaction.readErr
+}
+
+func (transaction *ReadOnlyTransaction) failRead(err error) {
+	if transaction.readErr == nil {
+		transaction.readErr = err
+	}
+}
+
+// Iterator returns an iterator over the keys in [start, end) in the increasing order; a nil start or end leaves that side unbounded.
+func (transaction *ReadOnlyTransaction) Iterator(start, end []byte) *Iterator {
+	return transaction.newIterator(start, end, false)
+}
+
+// ReverseIterator returns an iterator over the keys in [start, end) in the decreasing order.
+func (transaction *ReadOnlyTransaction) ReverseIterator(start, end []byte) *Iterator {
+	return transaction.newIterator(start, end, true)
+}
+
+// PrefixIterator returns an iterator over the keys that begin with the prefix in the increasing order.
+func (transaction *ReadOnlyTransaction) PrefixIterator(prefix []byte) *Iterator {
+	return transaction.newIterator(prefix, prefixEnd(prefix), false)
+}
+
+// ReversePrefixIterator returns an iterator over the keys that begin with the prefix in the decreasing order.
+func (transaction *ReadOnlyTransaction) ReversePrefixIterator(prefix []byte) *Iterator {
+	return transaction.newIterator(prefix, prefixEnd(prefix), true)
+}
+
+func (transaction *ReadOnlyTransaction) newIterator(start, end []byte, reverse bool) *Iterator {
+	return newIterator(newSnapshotIterator(transaction.engine, transaction.beginTimestamp, start, end, reverse, transaction.failRead), nil)
+}
+
+// visible hides a tombstone, the version of a deleted key, from the readers.
+func visible(value mvcc.Value, ok bool) (mvcc.Value, bool) {
+	if !ok || value.IsTombstone() {
+		return mvcc.Value{}, false
+	}
+	return value, true
 }
 
 func (transaction *ReadOnlyTransaction) FinishBeginTimestampForReadonlyTransaction() {
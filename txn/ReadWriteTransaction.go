@@ -3,35 +3,172 @@ package txn
 import (
 	"IsoTransact/mvcc"
 	"IsoTransact/txn/errors"
+	"context"
 )
 
 type ReadWriteTransaction struct {
 	beginTimestamp uint64
-	memTable       *mvcc.MemTable
+	engine         mvcc.StorageEngine
 	batch          *Batch
-	reads          [][]byte
+	reads          []uint64          //fingerprints of the keys read
+	lockedAt       map[uint64]uint64 //fingerprint of a key locked by GetForUpdate -> the timestamp it is read at
+	readRanges     []keyRange
 	oracle         *Oracle
+	requireSync    bool
+	trackReads     bool
+	beginFinished  bool
+	discarded      bool
+	readErr        error //the first error of reading the engine, see Err
 }
 
+// NewReadWriteTransaction returns nil if the oracle is stopped before the commits till the begin timestamp are applied;
+// NewReadWriteTransactionWithContext returns the error instead.
 func NewReadWriteTransaction(oracle *Oracle) *ReadWriteTransaction {
-	return &ReadWriteTransaction{
-		beginTimestamp: oracle.beginTimestamp(),
-		batch:          NewBatch(),
+	transaction, _ := NewReadWriteTransactionWithContext(context.Background(), oracle)
+	return transaction
+}
+
+// NewReadWriteTransactionWithContext returns ctx.Err() if the context is done before the commits till the begin timestamp are applied.
+func NewReadWriteTransactionWithContext(ctx context.Context, oracle *Oracle) (*ReadWriteTransaction, error) {
+	beginTimestamp, err := oracle.beginTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transaction := &ReadWriteTransaction{
+		beginTimestamp: beginTimestamp,
+		batch:          NewBatchWithLimits(oracle.maxBatchPairs, oracle.maxBatchBytes),
 		oracle:         oracle,
-		memTable:       oracle.transactionExecutor.memtable,
+		engine:         oracle.transactionExecutor.engine,
+		trackReads:     oracle.isolationLevel == Serializable,
 	}
+	oracle.trackOpenTransaction(transaction, transaction.beginTimestamp, true)
+	return transaction, nil
 }
 
+// Get reads the key at the begin timestamp of the transaction, or at the timestamp it was locked at by GetForUpdate.
+// The outcome of an Operation executed at apply time is not visible to the reads of the transaction,
+// while its own Merge is folded onto the value read.
 func (transaction *ReadWriteTransaction) Get(key []byte) (mvcc.Value, bool) {
-	if value, ok := transaction.batch.Get(key); ok {
-		return mvcc.NewValue(value), true
+	value, ok := transaction.batch.Get(key)
+	if ok && !value.IsMergeOperand() {
+		return visible(value, true)
+	}
+	keyFingerprint := fingerprint(key)
+	if transaction.trackReads {
+		transaction.reads = append(transaction.reads, keyFingerprint)
+	}
+
+	committed, found, err := read(transaction.engine, key, transaction.readTimestampOf(keyFingerprint))
+	if err != nil {
+		transaction.failRead(err)
+		return mvcc.Value{}, false
+	}
+	if !ok {
+		return visible(committed, found)
+	}
+	if !found {
+		committed = mvcc.NewTombstone()
+	}
+	merged, err := mvcc.ResolveMerge(committed, value)
+	if err != nil {
+		transaction.failRead(err)
+		return mvcc.Value{}, false
+	}
+	return visible(merged, true)
+}
+
+// GetForUpdate locks the key in the mode and reads it, pessimistically: the lock is held till the transaction commits
+// or is discarded. The key is read at the last commit timestamp as of taking the lock, rather than at the begin timestamp,
+// and only the commits of the key after that timestamp conflict with the transaction; the commits of the transactions
+// holding the lock before are no conflict. Transactions that write the key without locking it still do,
+// and the optimistic conflict check keeps catching them.
+// It returns errors.LockWaitTimeoutErr if the lock is not granted in time, errors.DeadlockErr if waiting for the lock
+// would deadlock, and ctx.Err() if the context is done before the lock is granted or before the commits till the timestamp
+// the key is read at are applied. The transaction is discarded then, releasing the locks it holds, and has to be run again.
+func (transaction *ReadWriteTransaction) GetForUpdate(ctx context.Context, key []byte, mode LockMode) (mvcc.Value, bool, error) {
+	if transaction.discarded {
+		return mvcc.Value{}, false, errors.DiscardedTxnErr
+	}
+	if err := transaction.oracle.lockManager.Acquire(ctx, transaction, key, mode, transaction.oracle.lockWaitTimeout); err != nil {
+		transaction.Discard()
+		return mvcc.Value{}, false, err
+	}
+
+	keyFingerprint := fingerprint(key)
+	if _, ok := transaction.lockedAt[keyFingerprint]; !ok {
+		if transaction.lockedAt == nil {
+			transaction.lockedAt = make(map[uint64]uint64)
+		}
+		lockedAt, err := transaction.oracle.CommittedTimestampWithContext(ctx)
+		if err != nil {
+			transaction.Discard()
+			return mvcc.Value{}, false, err
+		}
+		transaction.lockedAt[keyFingerprint] = lockedAt
+	}
+	value, ok := transaction.Get(key)
+	return value, ok, transaction.readErr
+}
+
+// Err returns the first error the transaction met reading the engine, see ReadOnlyTransaction.Err. Commit returns it, without committing.
+func (transaction *ReadWriteTransaction) Err() error {
+	return transaction.readErr
+}
+
+func (transaction *ReadWriteTransaction) failRead(err error) {
+	if transaction.readErr == nil {
+		transaction.readErr = err
+	}
+}
+
+// readTimestampOf returns the timestamp the key is read at, and above which a commit of the key conflicts with the transaction.
+func (transaction *ReadWriteTransaction) readTimestampOf(keyFingerprint uint64) uint64 {
+	if lockedAt, ok := transaction.lockedAt[keyFingerprint]; ok {
+		return lockedAt
+	}
+	return transaction.beginTimestamp
+}
+
+// Iterator returns an iterator over the keys in [start, end) in the increasing order; a nil start or end leaves that side unbounded.
+// The iterator sees the uncommitted writes of the transaction. Under Serializable, the whole range counts as read by the transaction,
+// so that a key committed into the range by a concurrent transaction conflicts with this one, even if the key did not exist when the range was read.
+func (transaction *ReadWriteTransaction) Iterator(start, end []byte) *Iterator {
+	return transaction.newIterator(start, end, false)
+}
+
+// ReverseIterator returns an iterator over the keys in [start, end) in the decreasing order.
+func (transaction *ReadWriteTransaction) ReverseIterator(start, end []byte) *Iterator {
+	return transaction.newIterator(start, end, true)
+}
+
+// PrefixIterator returns an iterator over the keys that begin with the prefix in the increasing order.
+func (transaction *ReadWriteTransaction) PrefixIterator(prefix []byte) *Iterator {
+	return transaction.newIterator(prefix, prefixEnd(prefix), false)
+}
+
+// ReversePrefixIterator returns an iterator over the keys that begin with the prefix in the decreasing order.
+func (transaction *ReadWriteTransaction) ReversePrefixIterator(prefix []byte) *Iterator {
+	return transaction.newIterator(prefix, prefixEnd(prefix), true)
+}
+
+func (transaction *ReadWriteTransaction) newIterator(start, end []byte, reverse bool) *Iterator {
+	if transaction.trackReads {
+		transaction.readRanges = append(transaction.readRanges, keyRange{start: start, end: end})
 	}
-	transaction.reads = append(transaction.reads, key)
+	return newIterator(
+		newSnapshotIterator(transaction.engine, transaction.beginTimestamp, start, end, reverse, transaction.failRead),
+		transaction.batch.visiblePairsInRange(start, end),
+	)
+}
 
-	versionedKey := mvcc.NewVersionedKey(key, transaction.beginTimestamp)
-	return transaction.memTable.Get(*versionedKey)
+// keyRange is a range of keys [start, end), a nil start or end leaves that side unbounded.
+type keyRange struct {
+	start []byte
+	end   []byte
 }
 
+// PutOrUpdate writes the value of the key, replacing the value of an earlier write to the key in the transaction.
+// It returns errors.TransactionTooLargeErr, without writing, once the batch of the transaction is at its limits.
 func (transaction *ReadWriteTransaction) PutOrUpdate(key []byte, value []byte) error {
 	err := transaction.batch.Add(key, value)
 	if err != nil {
@@ -40,15 +177,100 @@ func (transaction *ReadWriteTransaction) PutOrUpdate(key []byte, value []byte) e
 	return nil
 }
 
-func (transaction *ReadWriteTransaction) Commit() (<-chan struct{}, error) {
+// Delete writes a tombstone for the key. The transactions beginning at or after the commit of this transaction
+// do not find the key, while the ones that began before it keep reading the older version.
+func (transaction *ReadWriteTransaction) Delete(key []byte) error {
+	return transaction.batch.Delete(key)
+}
+
+// CompareAndSwap writes the value if the key holds the expected value as of the apply of the commit; a nil expected value
+// expects the key not to exist. The returned Operation gives the result once the commit is applied.
+// It returns errors.TransactionTooLargeErr, without writing, once the batch of the transaction is at its limits.
+func (transaction *ReadWriteTransaction) CompareAndSwap(key, expected, value []byte) (*Operation, error) {
+	return transaction.addOperation(key, newCompareAndSwap(expected, value))
+}
+
+// Increment adds the delta to the int64 held by the key as of the apply of the commit, taking a key that does not exist for 0;
+// the values are encoded with EncodeInt64. The returned Operation gives the incremented value once the commit is applied.
+// It returns errors.TransactionTooLargeErr, without writing, once the batch of the transaction is at its limits.
+func (transaction *ReadWriteTransaction) Increment(key []byte, delta int64) (*Operation, error) {
+	return transaction.addOperation(key, newIncrement(delta))
+}
+
+// PutIfAbsent writes the value if the key does not exist as of the apply of the commit.
+// The returned Operation gives the result once the commit is applied.
+// It returns errors.TransactionTooLargeErr, without writing, once the batch of the transaction is at its limits.
+func (transaction *ReadWriteTransaction) PutIfAbsent(key, value []byte) (*Operation, error) {
+	return transaction.addOperation(key, newPutIfAbsent(value))
+}
+
+func (transaction *ReadWriteTransaction) addOperation(key []byte, operation *Operation) (*Operation, error) {
+	if err := transaction.batch.addOperation(key, operation); err != nil {
+		return nil, err
+	}
+	return operation, nil
+}
+
+// Merge writes the merge operand (see mvcc.NewMergeOperand) as a version of the key, without reading the key:
+// the readers fold it onto the value below it, with the operator it names. Merges never conflict, as nothing is read.
+// It returns errors.UnknownMergeOperatorErr for an operand of an operator that is not registered, and
+// errors.TransactionTooLargeErr, without writing, once the batch of the transaction is at its limits.
+func (transaction *ReadWriteTransaction) Merge(key []byte, operand mvcc.Value) error {
+	if !operand.IsMergeOperand() {
+		return errors.UnknownMergeOperatorErr
+	}
+	if operatorName, _ := operand.MergeOperand(); !isRegistered(operatorName) {
+		return errors.UnknownMergeOperatorErr
+	}
+	return transaction.batch.Merge(key, operand)
+}
+
+// RequireSync makes the commit of this transaction fsync the write-ahead log before its done channel fires,
+// irrespective of the durability the database was opened with.
+func (transaction *ReadWriteTransaction) RequireSync() {
+	transaction.requireSync = true
+}
+
+// Commit queues the batch of the transaction for the executor, and returns the channel that fires once the batch is applied.
+// If the context is done before the batch is queued, the commit is abandoned: the oracle forgets the transaction
+// and ctx.Err() is returned. Once queued, the batch is applied irrespective of the context.
+// Commit returns errors.MemTableFullErr, without a commit timestamp, while the engine is at its memory limit (see lsm.Tree.IsFull),
+// and the error of a read that failed (see Err).
+// The operations of a transaction that fails to commit finish with the error of the commit.
+func (transaction *ReadWriteTransaction) Commit(ctx context.Context) (doneChannel <-chan error, err error) {
+	//the locks are released along with the begin timestamp on a successful commit, and here on a failed one
+	defer transaction.oracle.lockManager.ReleaseAll(transaction)
+	defer func() {
+		if err != nil {
+			transaction.batch.finishOperations(err)
+		}
+	}()
+
+	if transaction.discarded {
+		return nil, errors.DiscardedTxnErr
+	}
+	if transaction.readErr != nil {
+		return nil, transaction.readErr
+	}
 	if transaction.batch.IsEmpty() {
 		return nil, errors.EmptyTxnError
 	}
+	if transaction.oracle.transactionExecutor.isFull() {
+		return nil, errors.MemTableFullErr
+	}
 
 	// Send the transaction to the executor in the increasing order of the commitTimestamp.
 	// If a commit with the commitTimestamp 102 is applied, it is assumed that the commit with commitTimestamp 101 is already available.
-	transaction.oracle.executorLock.Lock()
-	defer transaction.oracle.executorLock.Unlock()
+	// Submit only queues the batch, so the lock is held for the duration of the enqueue and not the apply;
+	// the executor groups the queued batches.
+	select {
+	case transaction.oracle.executorLock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() {
+		<-transaction.oracle.executorLock
+	}()
 
 	commitTimestamp, err := transaction.oracle.maybeCommitTimestampFor(transaction)
 	if err != nil {
@@ -57,7 +279,29 @@ func (transaction *ReadWriteTransaction) Commit() (<-chan struct{}, error) {
 	commitCallback := func() {
 		transaction.oracle.commitTimestampMark.Finish(commitTimestamp)
 	}
-	return transaction.oracle.transactionExecutor.Submit(transaction.batch.ToTimestampedBatch(commitTimestamp, commitCallback)), nil
+	doneChannel, err = transaction.oracle.transactionExecutor.Submit(ctx, transaction.batch.ToTimestampedBatch(commitTimestamp, transaction.requireSync, commitCallback))
+	if err != nil {
+		transaction.oracle.abandonCommit(transaction, commitTimestamp)
+		return nil, err
+	}
+	return doneChannel, nil
+}
+
+// Discard drops the writes of the transaction and finishes its begin timestamp; the transaction can not be committed after it.
+// The Oracle does not learn about a discarded transaction, so it never conflicts with other transactions.
+func (transaction *ReadWriteTransaction) Discard() {
+	if transaction.discarded {
+		return
+	}
+	transaction.discarded = true
+	transaction.batch.finishOperations(errors.DiscardedTxnErr)
+	transaction.batch = NewBatchWithLimits(transaction.oracle.maxBatchPairs, transaction.oracle.maxBatchBytes)
+	transaction.FinishBeginTimestampForReadWriteTransaction()
+}
+
+// Rollback is the same as Discard.
+func (transaction *ReadWriteTransaction) Rollback() {
+	transaction.Discard()
 }
 
 func (transaction *ReadWriteTransaction) FinishBeginTimestampForReadWriteTransaction() {
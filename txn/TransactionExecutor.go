@@ -2,57 +2,279 @@ package txn
 
 import (
 	"IsoTransact/mvcc"
+	"IsoTransact/wal"
+	"context"
+	"errors"
+	"sync"
 )
 
+// maxGroupSize caps the number of batches that are applied (and logged) together as a single group.
+const maxGroupSize = 256
+
+var ExecutorStoppedErr = errors.New("transaction executor is stopped")
+
 type TransactionExecutor struct {
 	batchChannel chan TimestampedBatch
 	stopChannel  chan struct{}
-	memtable     *mvcc.MemTable
+	stopOnce     sync.Once
+	stopped      chan struct{}
+	submitLock   sync.RWMutex //held by Submit, so that Stop can wait out the submits that raced with it
+	engine       mvcc.StorageEngine
+	log          *wal.WAL
+}
+
+// freezingEngine is a StorageEngine that freezes its active memtable from time to time, like lsm.Tree.
+type freezingEngine interface {
+	MaybeFreeze() bool
+}
+
+// boundedEngine is a StorageEngine with a memory limit, like lsm.Tree.
+type boundedEngine interface {
+	IsFull() bool
 }
 
 func NewTransactionExecutor(memtable *mvcc.MemTable) *TransactionExecutor {
+	return NewDurableTransactionExecutor(memtable, nil)
+}
+
+// NewDurableTransactionExecutor creates an executor that appends every batch to the write-ahead log before applying it to the engine.
+// The log is rotated every time the engine freezes its active memtable.
+// A nil log keeps the executor purely in-memory.
+func NewDurableTransactionExecutor(engine mvcc.StorageEngine, log *wal.WAL) *TransactionExecutor {
 	transactionExecutor := &TransactionExecutor{
-		batchChannel: make(chan TimestampedBatch),
+		batchChannel: make(chan TimestampedBatch, maxGroupSize),
 		stopChannel:  make(chan struct{}),
-		memtable:     memtable,
+		stopped:      make(chan struct{}),
+		engine:       engine,
+		log:          log,
 	}
 	go transactionExecutor.spin()
 	return transactionExecutor
 }
 
+// spin applies the queued batches till the executor is stopped. The batchChannel is never closed,
+// the senders learn about the stop from the stopChannel instead (see Submit).
 func (executor *TransactionExecutor) spin() {
+	defer close(executor.stopped)
 	for {
 		select {
 		case timestampedBatch := <-executor.batchChannel:
-			executor.applyToStorage(timestampedBatch)
-			executor.markApplied(timestampedBatch)
+			executor.apply(executor.collectGroup(timestampedBatch))
 		case <-executor.stopChannel:
-			close(executor.batchChannel)
 			return
 		}
 	}
 }
 
+// failQueuedBatches notifies the batches that were queued, but not applied, before the stop.
+// It is called by Stop once spin has returned and no Submit is in progress.
+// Their commit timestamps are finished, so that nobody waits for them on the commitTimestampMark.
+func (executor *TransactionExecutor) failQueuedBatches() {
+	for {
+		select {
+		case timestampedBatch := <-executor.batchChannel:
+			timestampedBatch.commitCallback()
+			executor.markApplied(timestampedBatch, ExecutorStoppedErr)
+		default:
+			return
+		}
+	}
+}
+
+// collectGroup coalesces the batches that arrived while the executor was busy applying the previous group.
+// Batches are submitted in the increasing order of their commit timestamps, so the group is ordered as well.
+func (executor *TransactionExecutor) collectGroup(first TimestampedBatch) []TimestampedBatch {
+	group := []TimestampedBatch{first}
+	for len(group) < maxGroupSize {
+		select {
+		case timestampedBatch := <-executor.batchChannel:
+			group = append(group, timestampedBatch)
+		default:
+			return group
+		}
+	}
+	return group
+}
+
+func (executor *TransactionExecutor) apply(group []TimestampedBatch) {
+	//a group that could not be logged is not applied, but its commit timestamps are still finished,
+	//otherwise the readers waiting on the commitTimestampMark would wait forever.
+	executor.resolveOperations(group)
+	err := executor.appendToLog(group)
+	if err == nil {
+		for _, timestampedBatch := range group {
+			if timestampedBatch.err == nil {
+				executor.applyToStorage(timestampedBatch)
+			}
+		}
+		executor.maybeFreezeMemTable()
+	}
+	for _, timestampedBatch := range group {
+		timestampedBatch.commitCallback()
+		if timestampedBatch.err != nil {
+			executor.markApplied(timestampedBatch, timestampedBatch.err)
+		} else {
+			executor.markApplied(timestampedBatch, err)
+		}
+	}
+}
+
+// resolveOperations executes the pending operations of the batches of the group, in the order of their commit timestamps,
+// against the value of the key committed last: by an earlier batch of the group, or else in the engine.
+// The log gets the values the operations wrote, so the replay does not execute them again.
+// A key none of whose operations wrote is left out of the batch. The merge operands are written as is.
+// A failure to read the engine, or to merge onto an operand of an unregistered operator, fails the batch alone:
+// it is neither logged nor applied, and the later batches of the group do not see its writes.
+func (executor *TransactionExecutor) resolveOperations(group []TimestampedBatch) {
+	written := make(map[string]mvcc.Value)
+	for index, timestampedBatch := range group {
+		var batchErr error
+		fail := func(err error) {
+			if err != nil && batchErr == nil {
+				batchErr = err
+			}
+		}
+		//committed returns the value of the key committed last, with the merge operands folded onto the value below them
+		committed := func(key []byte) mvcc.Value {
+			value, ok := written[string(key)]
+			if ok && !value.IsMergeOperand() {
+				return value
+			}
+			base, found, err := read(executor.engine, key, timestampedBatch.timestamp)
+			fail(err)
+			if !found {
+				base = mvcc.NewTombstone()
+			}
+			if ok {
+				merged, err := mvcc.ResolveMerge(base, value)
+				fail(err)
+				return merged
+			}
+			return base
+		}
+
+		pairs := timestampedBatch.AllPairs()
+		resolved := make([]KeyValuePair, 0, len(pairs))
+		writes := make([]KeyValuePair, 0, len(pairs)) //the values the later batches see, the merge operands folded onto the earlier writes
+		for _, pair := range pairs {
+			if len(pair.pending) == 0 {
+				resolved = append(resolved, pair)
+				value := pair.value
+				if previous, ok := written[string(pair.key)]; ok && value.IsMergeOperand() {
+					var mergeable bool
+					if value, mergeable = mvcc.MergeOnto(previous, pair.value); !mergeable {
+						var err error
+						value, err = mvcc.ResolveMerge(committed(pair.key), pair.value)
+						fail(err)
+					}
+				}
+				writes = append(writes, *newKeyValuePair(pair.key, value))
+				continue
+			}
+			value, wrote, err := pair.resolve(committed(pair.key))
+			fail(err)
+			if wrote {
+				resolved = append(resolved, *newKeyValuePair(pair.key, value))
+				writes = append(writes, *newKeyValuePair(pair.key, value))
+			}
+		}
+		if batchErr != nil {
+			group[index].err = batchErr
+			continue
+		}
+		for _, write := range writes {
+			written[string(write.key)] = write.value
+		}
+		group[index].resolved = resolved
+	}
+}
+
+func (executor *TransactionExecutor) appendToLog(group []TimestampedBatch) error {
+	if executor.log == nil {
+		return nil
+	}
+	requireSync := false
+	records := make([]*wal.Record, 0, len(group))
+	for _, timestampedBatch := range group {
+		if timestampedBatch.err != nil {
+			continue
+		}
+		record := wal.NewRecord(timestampedBatch.timestamp)
+		for _, keyValuePair := range timestampedBatch.resolved {
+			record.Add(keyValuePair.getKey(), keyValuePair.getValue())
+		}
+		records = append(records, record)
+		requireSync = requireSync || timestampedBatch.requireSync
+	}
+	return executor.log.AppendAll(records, requireSync)
+}
+
 func (executor *TransactionExecutor) applyToStorage(timestampedBatch TimestampedBatch) {
-	for _, keyValuePair := range timestampedBatch.AllPairs() {
-		executor.memtable.PutOrUpdate(
-			*mvcc.NewVersionedKey(keyValuePair.getKey(), timestampedBatch.timestamp),
-			mvcc.NewValue(keyValuePair.getValue()),
-		)
+	entries := make([]mvcc.Entry, 0, len(timestampedBatch.resolved))
+	for _, keyValuePair := range timestampedBatch.resolved {
+		entries = append(entries, mvcc.NewEntry(keyValuePair.getKey(), keyValuePair.getValue()))
+	}
+	executor.engine.ApplyBatch(timestampedBatch.timestamp, entries)
+}
+
+// maybeFreezeMemTable rotates the log along with the memtable, so that the segments before the rotation
+// hold the records of the frozen memtables only, and can be removed once those memtables are flushed.
+// A failed rotation leaves the log without an open segment, which fails the subsequent appends.
+func (executor *TransactionExecutor) maybeFreezeMemTable() {
+	engine, ok := executor.engine.(freezingEngine)
+	if ok && engine.MaybeFreeze() && executor.log != nil {
+		_ = executor.log.Rotate()
 	}
-	timestampedBatch.commitCallback()
 }
 
-func (executor *TransactionExecutor) markApplied(batch TimestampedBatch) {
-	batch.doneChannel <- struct{}{}
+// isFull returns true if the engine is at its memory limit, an engine without one is never full.
+func (executor *TransactionExecutor) isFull() bool {
+	engine, ok := executor.engine.(boundedEngine)
+	return ok && engine.IsFull()
+}
+
+func (executor *TransactionExecutor) markApplied(batch TimestampedBatch, err error) {
+	batch.batch.finishOperations(err)
+	batch.doneChannel <- err
 	close(batch.doneChannel)
 }
 
-func (executor *TransactionExecutor) Submit(batch TimestampedBatch) <-chan struct{} {
-	executor.batchChannel <- batch
-	return batch.doneChannel
+// Submit queues the batch for the executor. The batches must be submitted in the increasing order of their commit timestamps.
+// It returns ctx.Err() if the context is done while the queue is full, and ExecutorStoppedErr once the executor is stopped;
+// the batch is not queued then.
+func (executor *TransactionExecutor) Submit(ctx context.Context, batch TimestampedBatch) (<-chan error, error) {
+	executor.submitLock.RLock()
+	defer executor.submitLock.RUnlock()
+
+	select {
+	case <-executor.stopChannel:
+		return nil, ExecutorStoppedErr
+	default:
+	}
+	select {
+	case executor.batchChannel <- batch:
+		return batch.doneChannel, nil
+	case <-executor.stopChannel:
+		return nil, ExecutorStoppedErr
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
-func (executor *TransactionExecutor) Stop() {
-	executor.stopChannel <- struct{}{}
+// Stop stops the executor, then closes the write-ahead log (syncing it) and the engine. It is safe to call more than once.
+// Stop waits for spin to return, after which nothing touches the log or the engine anymore.
+func (executor *TransactionExecutor) Stop() error {
+	var err error
+	executor.stopOnce.Do(func() {
+		close(executor.stopChannel)
+		<-executor.stopped
+		executor.submitLock.Lock()
+		executor.failQueuedBatches()
+		executor.submitLock.Unlock()
+		if executor.log != nil {
+			err = executor.log.Close()
+		}
+		executor.engine.Close()
+	})
+	return err
 }
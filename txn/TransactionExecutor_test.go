@@ -0,0 +1,126 @@
+package txn
+
+import (
+	"IsoTransact/lsm"
+	"IsoTransact/mvcc"
+	"IsoTransact/txn/errors"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCollectsTheQueuedBatchesIntoASingleGroup(t *testing.T) {
+	executor := &TransactionExecutor{
+		batchChannel: make(chan TimestampedBatch, maxGroupSize),
+		engine:       lsm.NewInMemoryTree(mvcc.NewMemTable(10)),
+	}
+	for timestamp := uint64(1); timestamp <= 3; timestamp++ {
+		batch := NewBatch()
+		_ = batch.Add([]byte("Key:"+strconv.Itoa(int(timestamp))), []byte("Value"))
+		executor.batchChannel <- batch.ToTimestampedBatch(timestamp, false, func() {})
+	}
+
+	group := executor.collectGroup(<-executor.batchChannel)
+
+	assert.Equal(t, 3, len(group))
+	assert.Equal(t, uint64(1), group[0].timestamp)
+	assert.Equal(t, uint64(2), group[1].timestamp)
+	assert.Equal(t, uint64(3), group[2].timestamp)
+}
+
+func TestAppliesAGroupAndNotifiesEachBatchInCommitTimestampOrder(t *testing.T) {
+	executor := &TransactionExecutor{engine: lsm.NewInMemoryTree(mvcc.NewMemTable(10))}
+
+	var finishedTimestamps []uint64
+	var group []TimestampedBatch
+	for timestamp := uint64(1); timestamp <= 3; timestamp++ {
+		batch := NewBatch()
+		_ = batch.Add([]byte("HDD"), []byte("Hard disk:"+strconv.Itoa(int(timestamp))))
+		commitTimestamp := timestamp
+		group = append(group, batch.ToTimestampedBatch(timestamp, false, func() {
+			finishedTimestamps = append(finishedTimestamps, commitTimestamp)
+		}))
+	}
+
+	executor.apply(group)
+
+	assert.Equal(t, []uint64{1, 2, 3}, finishedTimestamps)
+	for _, timestampedBatch := range group {
+		assert.Nil(t, <-timestampedBatch.doneChannel)
+	}
+	value, ok, _ := executor.engine.Get(*mvcc.NewVersionedKey([]byte("HDD"), 4))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk:3"), value.Slice())
+}
+
+func TestFailsOnlyTheBatchWhoseOperationFailsInAGroup(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	memTable.PutOrUpdate(*mvcc.NewVersionedKey([]byte("counter"), 1), mvcc.NewMergeOperand("unknown", nil))
+	executor := &TransactionExecutor{engine: memTable}
+
+	before, failing, after := NewBatch(), NewBatch(), NewBatch()
+	_ = before.Add([]byte("HDD"), []byte("Hard disk"))
+	_ = failing.Add([]byte("SSD"), []byte("Solid state drive"))
+	_ = failing.addOperation([]byte("counter"), newIncrement(1))
+	_ = after.addOperation([]byte("SSD"), newPutIfAbsent([]byte("Flash")))
+	group := []TimestampedBatch{
+		before.ToTimestampedBatch(2, false, func() {}),
+		failing.ToTimestampedBatch(3, false, func() {}),
+		after.ToTimestampedBatch(4, false, func() {}),
+	}
+
+	executor.apply(group)
+
+	assert.Nil(t, <-group[0].doneChannel)
+	assert.Equal(t, errors.UnknownMergeOperatorErr, <-group[1].doneChannel)
+	assert.Nil(t, <-group[2].doneChannel)
+	value, ok, _ := memTable.Get(*mvcc.NewVersionedKey([]byte("HDD"), 4))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+	//the later batch does not see the writes of the failed one
+	value, ok, _ = memTable.Get(*mvcc.NewVersionedKey([]byte("SSD"), 4))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("Flash"), value.Slice())
+}
+
+func TestCommitsConcurrentTransactionsThroughTheExecutor(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)))
+
+	var wg sync.WaitGroup
+	wg.Add(50)
+	for count := 1; count <= 50; count++ {
+		go func(index int) {
+			defer wg.Done()
+			transaction := NewReadWriteTransaction(oracle)
+			_ = transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(index)), []byte("Value:"+strconv.Itoa(index)))
+			doneChannel, err := transaction.Commit(context.Background())
+			assert.Nil(t, err)
+			assert.Nil(t, <-doneChannel)
+		}(count)
+	}
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		return oracle.commitTimestampMark.DoneTill() == uint64(50)
+	}, time.Second, time.Millisecond)
+	engine := oracle.transactionExecutor.engine
+	for count := 1; count <= 50; count++ {
+		value, ok, _ := engine.Get(*mvcc.NewVersionedKey([]byte("Key:"+strconv.Itoa(count)), 51))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("Value:"+strconv.Itoa(count)), value.Slice())
+	}
+}
+
+func TestFailsToSubmitABatchOnceTheExecutorIsStopped(t *testing.T) {
+	executor := NewTransactionExecutor(mvcc.NewMemTable(10))
+	assert.Nil(t, executor.Stop())
+	assert.Nil(t, executor.Stop())
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+	_, err := executor.Submit(context.Background(), batch.ToTimestampedBatch(1, false, func() {}))
+	assert.Equal(t, ExecutorStoppedErr, err)
+}
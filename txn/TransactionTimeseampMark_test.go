@@ -126,3 +126,27 @@ func TestTransactionMarkAndTimeoutWaitingForAnUnfinishedTimestamp(t *testing.T)
 	assert.Error(t, err)
 	cancelFunction()
 }
+
+func TestTransactionTimestampMarkIgnoresTheTimestampsOnceStopped(t *testing.T) {
+	transactionTimestampMark := NewTransactionTimestampMark()
+	transactionTimestampMark.Begin(1)
+	transactionTimestampMark.Stop()
+	transactionTimestampMark.Stop()
+
+	transactionTimestampMark.Begin(2)
+	transactionTimestampMark.Finish(1)
+	assert.Equal(t, TimestampMarkStoppedErr, transactionTimestampMark.WaitForMark(context.Background(), 1))
+}
+
+func TestTransactionTimestampMarkWakesUpTheWaitersOnStop(t *testing.T) {
+	transactionTimestampMark := NewTransactionTimestampMark()
+	transactionTimestampMark.Begin(1)
+
+	errChannel := make(chan error)
+	go func() {
+		errChannel <- transactionTimestampMark.WaitForMark(context.Background(), 1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	transactionTimestampMark.Stop()
+	assert.Equal(t, TimestampMarkStoppedErr, <-errChannel)
+}
@@ -2,11 +2,15 @@ package txn
 
 import (
 	"context"
+	"errors"
 	"github.com/emirpasic/gods/maps/treemap"
 	"github.com/emirpasic/gods/utils"
+	"sync"
 	"sync/atomic"
 )
 
+var TimestampMarkStoppedErr = errors.New("transaction timestamp mark is stopped")
+
 type timeMessage struct {
 	timestamp uint64
 	done      bool
@@ -23,6 +27,7 @@ type TransactionTimestampMark struct {
 	timestampChannel                      chan timeMessage
 	callBackChannel                       chan callbackMessage
 	stopChannel                           chan struct{}
+	stopOnce                              sync.Once
 	pendingTransactionRequestsByTimestamp *treemap.Map
 	notificationChannelsByTimestamp       map[uint64][]chan struct{}
 }
@@ -39,16 +44,28 @@ func NewTransactionTimestampMark() *TransactionTimestampMark {
 	return transactionMark
 }
 
+// Begin and Finish are dropped once the mark is stopped, so that the transactions still running
+// while the database is torn down do not block (or panic) on the mark.
 func (this *TransactionTimestampMark) Begin(timestamp uint64) {
-	this.timestampChannel <- timeMessage{timestamp: timestamp, done: false}
+	this.send(timeMessage{timestamp: timestamp, done: false})
 }
 
 func (this *TransactionTimestampMark) Finish(timestamp uint64) {
-	this.timestampChannel <- timeMessage{timestamp: timestamp, done: true}
+	this.send(timeMessage{timestamp: timestamp, done: true})
+}
+
+func (this *TransactionTimestampMark) send(message timeMessage) {
+	select {
+	case this.timestampChannel <- message:
+	case <-this.stopChannel:
+	}
 }
 
+// Stop stops the mark, waking up everyone waiting on it. It is safe to call more than once.
 func (this *TransactionTimestampMark) Stop() {
-	this.stopChannel <- struct{}{}
+	this.stopOnce.Do(func() {
+		close(this.stopChannel)
+	})
 }
 
 func (this *TransactionTimestampMark) DoneTill() uint64 {
@@ -63,12 +80,22 @@ func (this *TransactionTimestampMark) WaitForMark(
 		return nil
 	}
 	waitChannel := make(chan struct{})
-	this.callBackChannel <- callbackMessage{timestamp: timestamp, outNotification: waitChannel}
+	select {
+	case this.callBackChannel <- callbackMessage{timestamp: timestamp, outNotification: waitChannel}:
+	case <-this.stopChannel:
+		return TimestampMarkStoppedErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	case <-waitChannel:
+		//the wait channels are also closed when the mark stops
+		if this.DoneTill() < timestamp {
+			return TimestampMarkStoppedErr
+		}
 		return nil
 	}
 }
@@ -143,9 +170,6 @@ func (this *TransactionTimestampMark) spin() {
 		case tsMessage := <-this.timestampChannel:
 			this.process(tsMessage)
 		case <-this.stopChannel:
-			close(this.timestampChannel)
-			close(this.callBackChannel)
-			close(this.stopChannel)
 			closeAll(this.notificationChannelsByTimestamp)
 			return
 		}
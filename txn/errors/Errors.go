@@ -1,6 +1,18 @@
 package errors
 
-import "errors"
+import (
+	"IsoTransact/mvcc"
+	"errors"
+)
 
 var ConflictErr = errors.New("transaction conflicts with other concurrent transaction, retry")
 var EmptyTxnError = errors.New("empty write batch, nothing to commit")
+var DiscardedTxnErr = errors.New("transaction is discarded, nothing to commit")
+var DiscardedTimestampErr = errors.New("versions at the timestamp are garbage collected, read at a later timestamp")
+var UncommittedTimestampErr = errors.New("timestamp is not committed yet")
+var MemTableFullErr = errors.New("memtables are full, retry once they are flushed")
+var TransactionTooLargeErr = errors.New("transaction too large, it writes more keys or bytes than a batch holds")
+var DeadlockErr = errors.New("transaction is aborted to break a deadlock of key locks, retry")
+var LockWaitTimeoutErr = errors.New("timed out waiting for a key lock")
+var NotAnInt64Err = errors.New("value is not an int64 encoded by txn.EncodeInt64, can not increment it")
+var UnknownMergeOperatorErr = mvcc.UnknownMergeOperatorErr
@@ -0,0 +1,45 @@
+package wal
+
+import (
+	"errors"
+	"time"
+)
+
+var InvalidDurabilityErr = errors.New("durability requires a positive interval or byte threshold for the chosen sync mode")
+
+// SyncMode decides when the log is fsynced, and with it what the done channel of a commit promises.
+// The done channel always fires after the batch is written to the log and applied to the memtable;
+// it additionally waits for an fsync only when the batch is synced as part of its own append.
+type SyncMode uint8
+
+const (
+	// NoSync never fsyncs; a done commit survives a process crash but not a machine crash.
+	NoSync SyncMode = iota
+	// SyncEveryCommit fsyncs every batch before its done channel fires; a done commit is durable.
+	SyncEveryCommit
+	// SyncOnInterval fsyncs in the background every Interval; a done commit may be lost if the machine crashes within Interval.
+	SyncOnInterval
+	// SyncEveryBytes fsyncs once at least Bytes have been written since the last fsync;
+	// the batch that crosses the threshold is durable when done fires, the ones before it may be lost on a machine crash.
+	SyncEveryBytes
+)
+
+type Durability struct {
+	Mode     SyncMode
+	Interval time.Duration
+	Bytes    int64
+}
+
+func DefaultDurability() Durability {
+	return Durability{Mode: SyncEveryCommit}
+}
+
+func (durability Durability) validate() error {
+	if durability.Mode == SyncOnInterval && durability.Interval <= 0 {
+		return InvalidDurabilityErr
+	}
+	if durability.Mode == SyncEveryBytes && durability.Bytes <= 0 {
+		return InvalidDurabilityErr
+	}
+	return nil
+}
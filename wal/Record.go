@@ -0,0 +1,109 @@
+package wal
+
+import (
+	"IsoTransact/mvcc"
+	"encoding/binary"
+	"errors"
+)
+
+var CorruptRecordErr = errors.New("write-ahead log record is corrupt")
+
+type Entry struct {
+	key   []byte
+	value mvcc.Value
+}
+
+func (entry Entry) GetKey() []byte {
+	return entry.key
+}
+
+func (entry Entry) GetValue() mvcc.Value {
+	return entry.value
+}
+
+// Record is the unit appended to the log: all the key/value pairs of one committed batch along with its commit timestamp.
+type Record struct {
+	timestamp uint64
+	entries   []Entry
+}
+
+func NewRecord(timestamp uint64) *Record {
+	return &Record{timestamp: timestamp}
+}
+
+func (record *Record) Add(key []byte, value mvcc.Value) {
+	record.entries = append(record.entries, Entry{key: key, value: value})
+}
+
+func (record *Record) GetTimestamp() uint64 {
+	return record.timestamp
+}
+
+func (record *Record) GetEntries() []Entry {
+	return record.entries
+}
+
+// encode lays out the payload as:
+// timestamp (8 bytes) | number of entries (uvarint) | [key length (uvarint) | key | value kind (1 byte) | value length (uvarint) | value]...
+func (record *Record) encode() []byte {
+	size := 8 + binary.MaxVarintLen64
+	for _, entry := range record.entries {
+		size = size + 2*binary.MaxVarintLen64 + 1 + len(entry.key) + len(entry.value.Slice())
+	}
+
+	buffer := make([]byte, size)
+	binary.BigEndian.PutUint64(buffer, record.timestamp)
+	offset := 8
+	offset = offset + binary.PutUvarint(buffer[offset:], uint64(len(record.entries)))
+	for _, entry := range record.entries {
+		offset = offset + binary.PutUvarint(buffer[offset:], uint64(len(entry.key)))
+		offset = offset + copy(buffer[offset:], entry.key)
+		buffer[offset] = byte(entry.value.Kind())
+		offset++
+		offset = offset + binary.PutUvarint(buffer[offset:], uint64(len(entry.value.Slice())))
+		offset = offset + copy(buffer[offset:], entry.value.Slice())
+	}
+	return buffer[:offset]
+}
+
+func decodeRecord(payload []byte) (*Record, error) {
+	if len(payload) < 8 {
+		return nil, CorruptRecordErr
+	}
+	record := NewRecord(binary.BigEndian.Uint64(payload))
+	offset := 8
+
+	readBytes := func() ([]byte, bool) {
+		length, read := binary.Uvarint(payload[offset:])
+		if read <= 0 || uint64(len(payload)-offset-read) < length {
+			return nil, false
+		}
+		offset = offset + read
+		bytes := payload[offset : offset+int(length)]
+		offset = offset + int(length)
+		return bytes, true
+	}
+
+	numberOfEntries, read := binary.Uvarint(payload[offset:])
+	if read <= 0 {
+		return nil, CorruptRecordErr
+	}
+	offset = offset + read
+	for count := uint64(0); count < numberOfEntries; count++ {
+		key, ok := readBytes()
+		if !ok || offset >= len(payload) {
+			return nil, CorruptRecordErr
+		}
+		kind := mvcc.ValueKind(payload[offset])
+		offset++
+		value, ok := readBytes()
+		if !ok {
+			return nil, CorruptRecordErr
+		}
+		record.Add(key, mvcc.NewValueOfKind(kind, value))
+	}
+	if offset != len(payload) {
+		return nil, CorruptRecordErr
+	}
+	return record, nil
+}
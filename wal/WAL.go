@@ -0,0 +1,378 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerSize    = 8 //checksum (4 bytes) | payload length (4 bytes)
+	segmentSuffix = ".wal"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+var BrokenLogErr = errors.New("write-ahead log is not appended to after a failed fsync")
+var CorruptSegmentErr = errors.New("write-ahead log segment holds an invalid record before the last segment")
+
+// WAL is an append-only log of checksummed records, split into segment files named by increasing ids.
+// Every committed batch is appended to the WAL before it is applied to the memtable,
+// so that the memtable can be rebuilt by replaying the WAL after a restart.
+// The WAL is rotated to a new segment whenever the memtable is frozen, so that the segments holding
+// the records of a memtable that is flushed to a table can be removed.
+type WAL struct {
+	lock          sync.Mutex
+	directory     string
+	file          *os.File
+	segments      []segment
+	size          int64
+	unsyncedBytes int64
+	durability    Durability
+	broken        bool
+	stopChannel   chan struct{}
+}
+
+type segment struct {
+	id           uint64
+	maxTimestamp uint64
+}
+
+// Open opens (or creates) the WAL in the directory and invokes replay for every valid record, in the order of appending.
+// A torn record at the tail of the last segment (a partially written header or payload, or a checksum mismatch) marks the end of the log:
+// the file is truncated to the last valid record. The segments before it are synced before the log rotates away from them,
+// so an invalid record in one of them is a corruption that fails Open with CorruptSegmentErr. New records are appended to the last segment.
+// The durability decides when the appended records are fsynced.
+func Open(directory string, durability Durability, replay func(record *Record)) (*WAL, error) {
+	if err := durability.validate(); err != nil {
+		return nil, err
+	}
+	segmentIds, err := listSegments(directory)
+	if err != nil {
+		return nil, err
+	}
+	wal := &WAL{directory: directory, durability: durability, stopChannel: make(chan struct{})}
+	for index, segmentId := range segmentIds {
+		maxTimestamp, err := replaySegment(segmentPath(directory, segmentId), index == len(segmentIds)-1, replay)
+		if err != nil {
+			return nil, err
+		}
+		wal.segments = append(wal.segments, segment{id: segmentId, maxTimestamp: maxTimestamp})
+	}
+	if len(wal.segments) == 0 {
+		wal.segments = append(wal.segments, segment{id: 1})
+	}
+	if err := wal.openLastSegment(); err != nil {
+		return nil, err
+	}
+	if durability.Mode == SyncOnInterval {
+		go wal.spin()
+	}
+	return wal, nil
+}
+
+func segmentPath(directory string, segmentId uint64) string {
+	return filepath.Join(directory, fmt.Sprintf("%06d%s", segmentId, segmentSuffix))
+}
+
+func listSegments(directory string) ([]uint64, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	var segmentIds []uint64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentSuffix) {
+			continue
+		}
+		segmentId, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segmentIds = append(segmentIds, segmentId)
+	}
+	sort.Slice(segmentIds, func(i, j int) bool {
+		return segmentIds[i] < segmentIds[j]
+	})
+	return segmentIds, nil
+}
+
+// replaySegment replays the records of the segment, and truncates the last one at a torn record.
+func replaySegment(filePath string, last bool, replay func(record *Record)) (uint64, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	maxTimestamp := uint64(0)
+	validSize, torn, err := readAll(file, func(record *Record) {
+		if record.GetTimestamp() > maxTimestamp {
+			maxTimestamp = record.GetTimestamp()
+		}
+		replay(record)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !torn {
+		return maxTimestamp, nil
+	}
+	if !last {
+		return 0, fmt.Errorf("replaying segment %s at offset %d: %w", filePath, validSize, CorruptSegmentErr)
+	}
+	return maxTimestamp, file.Truncate(validSize)
+}
+
+func (wal *WAL) openLastSegment() error {
+	file, err := os.OpenFile(segmentPath(wal.directory, wal.currentSegment().id), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	wal.file, wal.size = file, size
+	return nil
+}
+
+func (wal *WAL) currentSegment() *segment {
+	return &wal.segments[len(wal.segments)-1]
+}
+
+func (wal *WAL) spin() {
+	ticker := time.NewTicker(wal.durability.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = wal.Sync()
+		case <-wal.stopChannel:
+			return
+		}
+	}
+}
+
+// readAll replays the valid records from the start of the file, and returns their size along with true
+// if an invalid record follows them.
+func readAll(file *os.File, replay func(record *Record)) (int64, bool, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, false, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	reader := bufio.NewReader(file)
+	header := make([]byte, headerSize)
+	validSize := int64(0)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return validSize, false, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return validSize, true, nil
+			}
+			return 0, false, err
+		}
+		checksum, length := binary.BigEndian.Uint32(header), binary.BigEndian.Uint32(header[4:])
+		//the length is not covered by the checksum, a length running past the end of the file is a torn header
+		if int64(length) > info.Size()-validSize-headerSize {
+			return validSize, true, nil
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return validSize, true, nil
+			}
+			return 0, false, err
+		}
+		if crc32.Checksum(payload, castagnoliTable) != checksum {
+			return validSize, true, nil
+		}
+		record, err := decodeRecord(payload)
+		if err != nil {
+			return 0, false, err
+		}
+		replay(record)
+		validSize = validSize + headerSize + int64(length)
+	}
+}
+
+// Append writes the record to the end of the log.
+// The file is synced before returning if forceSync is set, or if the durability asks for it.
+func (wal *WAL) Append(record *Record, forceSync bool) error {
+	return wal.AppendAll([]*Record{record}, forceSync)
+}
+
+// AppendAll writes all the records to the end of the log with a single write, followed by at most one sync.
+// Once a sync has failed, the log returns BrokenLogErr for every append.
+func (wal *WAL) AppendAll(records []*Record, forceSync bool) error {
+	var frame []byte
+	for _, record := range records {
+		frame = appendFrame(frame, record.encode())
+	}
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if wal.broken {
+		return BrokenLogErr
+	}
+	sizeBeforeAppend := wal.size
+	if _, err := wal.file.Write(frame); err != nil {
+		//drop whatever part of the frame made it to the file, so that the next record starts at a record boundary
+		wal.truncate(sizeBeforeAppend)
+		return err
+	}
+	wal.size = wal.size + int64(len(frame))
+	wal.unsyncedBytes = wal.unsyncedBytes + int64(len(frame))
+	for _, record := range records {
+		if record.GetTimestamp() > wal.currentSegment().maxTimestamp {
+			wal.currentSegment().maxTimestamp = record.GetTimestamp()
+		}
+	}
+
+	if forceSync || wal.shouldSyncAfterAppend() {
+		if err := wal.sync(); err != nil {
+			//the records are not committed, they must not be replayed after a restart
+			wal.truncate(sizeBeforeAppend)
+			return err
+		}
+	}
+	return nil
+}
+
+func (wal *WAL) truncate(size int64) {
+	_ = wal.file.Truncate(size)
+	_, _ = wal.file.Seek(size, io.SeekStart)
+	wal.unsyncedBytes = wal.unsyncedBytes - (wal.size - size)
+	wal.size = size
+}
+
+func appendFrame(buffer []byte, payload []byte) []byte {
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header, crc32.Checksum(payload, castagnoliTable))
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(append(buffer, header...), payload...)
+}
+
+func (wal *WAL) shouldSyncAfterAppend() bool {
+	switch wal.durability.Mode {
+	case SyncEveryCommit:
+		return true
+	case SyncEveryBytes:
+		return wal.unsyncedBytes >= wal.durability.Bytes
+	default:
+		return false
+	}
+}
+
+// Sync fsyncs all the records appended so far.
+func (wal *WAL) Sync() error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	return wal.sync()
+}
+
+func (wal *WAL) sync() error {
+	if wal.broken {
+		return BrokenLogErr
+	}
+	if wal.unsyncedBytes == 0 {
+		return nil
+	}
+	if err := wal.file.Sync(); err != nil {
+		//the pages that failed to be written back may be dropped, and a later fsync would not report it
+		wal.broken = true
+		return err
+	}
+	wal.unsyncedBytes = 0
+	return nil
+}
+
+// Rotate syncs and closes the current segment; the records appended from now on go to a new segment.
+func (wal *WAL) Rotate() error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if err := wal.sync(); err != nil {
+		return err
+	}
+	if err := wal.file.Close(); err != nil {
+		return err
+	}
+	wal.segments = append(wal.segments, segment{id: wal.currentSegment().id + 1})
+	return wal.openLastSegment()
+}
+
+// RemoveSegmentsTill removes the segments, other than the current one, that hold no record with a timestamp greater than the given timestamp.
+func (wal *WAL) RemoveSegmentsTill(timestamp uint64) error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	retainedSegments := make([]segment, 0, len(wal.segments))
+	for index, segment := range wal.segments {
+		if index < len(wal.segments)-1 && segment.maxTimestamp <= timestamp {
+			if err := os.Remove(segmentPath(wal.directory, segment.id)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		retainedSegments = append(retainedSegments, segment)
+	}
+	wal.segments = retainedSegments
+	return nil
+}
+
+func (wal *WAL) NumberOfSegments() int {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	return len(wal.segments)
+}
+
+func (wal *WAL) UnsyncedBytes() int64 {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	return wal.unsyncedBytes
+}
+
+// Size returns the size of the current segment.
+func (wal *WAL) Size() int64 {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	return wal.size
+}
+
+// Close syncs the pending records, whatever the durability, and closes the file.
+func (wal *WAL) Close() error {
+	if wal.durability.Mode == SyncOnInterval {
+		wal.stopChannel <- struct{}{}
+	}
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if err := wal.sync(); err != nil {
+		_ = wal.file.Close()
+		return err
+	}
+	return wal.file.Close()
+}
@@ -0,0 +1,341 @@
+package wal
+
+import (
+	"IsoTransact/mvcc"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func openForTest(t *testing.T, directory string) (*WAL, []*Record) {
+	return openWithDurabilityForTest(t, directory, DefaultDurability())
+}
+
+func openWithDurabilityForTest(t *testing.T, directory string, durability Durability) (*WAL, []*Record) {
+	var records []*Record
+	wal, err := Open(directory, durability, func(record *Record) {
+		records = append(records, record)
+	})
+	assert.Nil(t, err)
+	return wal, records
+}
+
+func TestAppendsRecordsAndReplaysThemOnOpen(t *testing.T) {
+	directory := t.TempDir()
+	wal, records := openForTest(t, directory)
+	assert.Equal(t, 0, len(records))
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	record.Add([]byte("SSD"), mvcc.NewValue([]byte("Solid state drive")))
+	assert.Nil(t, wal.Append(record, false))
+
+	record = NewRecord(2)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk drive")))
+	assert.Nil(t, wal.Append(record, false))
+	assert.Nil(t, wal.Close())
+
+	wal, records = openForTest(t, directory)
+	defer wal.Close()
+
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, uint64(1), records[0].GetTimestamp())
+	assert.Equal(t, 2, len(records[0].GetEntries()))
+	assert.Equal(t, []byte("SSD"), records[0].GetEntries()[1].GetKey())
+	assert.Equal(t, []byte("Solid state drive"), records[0].GetEntries()[1].GetValue().Slice())
+	assert.Equal(t, uint64(2), records[1].GetTimestamp())
+	assert.Equal(t, []byte("Hard disk drive"), records[1].GetEntries()[0].GetValue().Slice())
+}
+
+func TestTruncatesATornRecordAtTheTail(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := openForTest(t, directory)
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+	sizeAfterFirstRecord := wal.Size()
+
+	record = NewRecord(2)
+	record.Add([]byte("SSD"), mvcc.NewValue([]byte("Solid state drive")))
+	assert.Nil(t, wal.Append(record, false))
+	assert.Nil(t, wal.Close())
+
+	assert.Nil(t, os.Truncate(segmentPath(directory, 1), sizeAfterFirstRecord+5))
+
+	wal, records := openForTest(t, directory)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, sizeAfterFirstRecord, wal.Size())
+
+	record = NewRecord(2)
+	record.Add([]byte("NVMe"), mvcc.NewValue([]byte("Non-volatile memory")))
+	assert.Nil(t, wal.Append(record, false))
+	assert.Nil(t, wal.Close())
+
+	wal, records = openForTest(t, directory)
+	defer wal.Close()
+
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, []byte("NVMe"), records[1].GetEntries()[0].GetKey())
+}
+
+func TestTruncatesARecordWithAChecksumMismatchAtTheTail(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := openForTest(t, directory)
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+	sizeAfterFirstRecord := wal.Size()
+
+	record = NewRecord(2)
+	record.Add([]byte("SSD"), mvcc.NewValue([]byte("Solid state drive")))
+	assert.Nil(t, wal.Append(record, false))
+	totalSize := wal.Size()
+	assert.Nil(t, wal.Close())
+
+	contents, err := os.ReadFile(segmentPath(directory, 1))
+	assert.Nil(t, err)
+	contents[totalSize-1] = contents[totalSize-1] ^ 0xFF
+	assert.Nil(t, os.WriteFile(segmentPath(directory, 1), contents, 0644))
+
+	wal, records := openForTest(t, directory)
+	defer wal.Close()
+
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, uint64(1), records[0].GetTimestamp())
+	assert.Equal(t, sizeAfterFirstRecord, wal.Size())
+}
+
+func TestDoesNotSyncWithNoSyncDurability(t *testing.T) {
+	wal, _ := openWithDurabilityForTest(t, t.TempDir(), Durability{Mode: NoSync})
+	defer wal.Close()
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+
+	assert.Equal(t, wal.Size(), wal.UnsyncedBytes())
+}
+
+func TestSyncsAnAppendThatForcesTheSyncWithNoSyncDurability(t *testing.T) {
+	wal, _ := openWithDurabilityForTest(t, t.TempDir(), Durability{Mode: NoSync})
+	defer wal.Close()
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+
+	record = NewRecord(2)
+	record.Add([]byte("SSD"), mvcc.NewValue([]byte("Solid state drive")))
+	assert.Nil(t, wal.Append(record, true))
+
+	assert.Equal(t, int64(0), wal.UnsyncedBytes())
+}
+
+func TestSyncsEveryCommitWithSyncEveryCommitDurability(t *testing.T) {
+	wal, _ := openWithDurabilityForTest(t, t.TempDir(), Durability{Mode: SyncEveryCommit})
+	defer wal.Close()
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+
+	assert.Equal(t, int64(0), wal.UnsyncedBytes())
+}
+
+func TestSyncsOnceTheByteThresholdIsCrossedWithSyncEveryBytesDurability(t *testing.T) {
+	wal, _ := openWithDurabilityForTest(t, t.TempDir(), Durability{Mode: SyncEveryBytes, Bytes: 64})
+	defer wal.Close()
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+	assert.Equal(t, wal.Size(), wal.UnsyncedBytes())
+
+	record = NewRecord(2)
+	record.Add([]byte("SSD"), mvcc.NewValue([]byte("Solid state drive, a storage device with no moving parts")))
+	assert.Nil(t, wal.Append(record, false))
+	assert.Equal(t, int64(0), wal.UnsyncedBytes())
+}
+
+func TestSyncsInTheBackgroundWithSyncOnIntervalDurability(t *testing.T) {
+	wal, _ := openWithDurabilityForTest(t, t.TempDir(), Durability{Mode: SyncOnInterval, Interval: 5 * time.Millisecond})
+	defer wal.Close()
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+
+	assert.Eventually(t, func() bool {
+		return wal.UnsyncedBytes() == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestFailsToOpenWithAnIntervalDurabilityWithoutAnInterval(t *testing.T) {
+	_, err := Open(t.TempDir(), Durability{Mode: SyncOnInterval}, func(record *Record) {})
+
+	assert.Error(t, err)
+	assert.Equal(t, InvalidDurabilityErr, err)
+}
+
+func TestAppendsAGroupOfRecordsAndReplaysThemInOrder(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := openWithDurabilityForTest(t, directory, Durability{Mode: NoSync})
+
+	var records []*Record
+	for timestamp := uint64(1); timestamp <= 3; timestamp++ {
+		record := NewRecord(timestamp)
+		record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+		records = append(records, record)
+	}
+	assert.Nil(t, wal.AppendAll(records, true))
+	assert.Equal(t, int64(0), wal.UnsyncedBytes())
+	assert.Nil(t, wal.Close())
+
+	wal, replayed := openForTest(t, directory)
+	defer wal.Close()
+
+	assert.Equal(t, 3, len(replayed))
+	for index, record := range replayed {
+		assert.Equal(t, uint64(index+1), record.GetTimestamp())
+	}
+}
+
+func TestFailsToOpenWithAnInvalidRecordBeforeTheLastSegment(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := openForTest(t, directory)
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+	record = NewRecord(2)
+	record.Add([]byte("SSD"), mvcc.NewValue([]byte("Solid state drive")))
+	assert.Nil(t, wal.Append(record, false))
+	sizeOfFirstSegment := wal.Size()
+	assert.Nil(t, wal.Rotate())
+
+	record = NewRecord(3)
+	record.Add([]byte("NVMe"), mvcc.NewValue([]byte("Non-volatile memory")))
+	assert.Nil(t, wal.Append(record, false))
+	assert.Nil(t, wal.Close())
+
+	contents, err := os.ReadFile(segmentPath(directory, 1))
+	assert.Nil(t, err)
+	contents[sizeOfFirstSegment-1] = contents[sizeOfFirstSegment-1] ^ 0xFF
+	assert.Nil(t, os.WriteFile(segmentPath(directory, 1), contents, 0644))
+
+	_, err = Open(directory, DefaultDurability(), func(record *Record) {})
+	assert.ErrorIs(t, err, CorruptSegmentErr)
+
+	assert.Nil(t, os.Truncate(segmentPath(directory, 1), sizeOfFirstSegment-5))
+	_, err = Open(directory, DefaultDurability(), func(record *Record) {})
+	assert.ErrorIs(t, err, CorruptSegmentErr)
+}
+
+func TestRotatesToANewSegmentAndReplaysAllTheSegmentsInOrder(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := openForTest(t, directory)
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+	assert.Nil(t, wal.Rotate())
+
+	record = NewRecord(2)
+	record.Add([]byte("SSD"), mvcc.NewValue([]byte("Solid state drive")))
+	assert.Nil(t, wal.Append(record, false))
+	assert.Equal(t, 2, wal.NumberOfSegments())
+	assert.Nil(t, wal.Close())
+
+	wal, records := openForTest(t, directory)
+	defer wal.Close()
+
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, uint64(1), records[0].GetTimestamp())
+	assert.Equal(t, uint64(2), records[1].GetTimestamp())
+}
+
+func TestRemovesTheSegmentsHoldingOnlyRecordsTillATimestamp(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := openForTest(t, directory)
+
+	for timestamp := uint64(1); timestamp <= 3; timestamp++ {
+		record := NewRecord(timestamp)
+		record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+		assert.Nil(t, wal.Append(record, false))
+		assert.Nil(t, wal.Rotate())
+	}
+	assert.Equal(t, 4, wal.NumberOfSegments())
+
+	assert.Nil(t, wal.RemoveSegmentsTill(2))
+	assert.Equal(t, 2, wal.NumberOfSegments())
+	assert.Nil(t, wal.Close())
+
+	wal, records := openForTest(t, directory)
+	defer wal.Close()
+
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, uint64(3), records[0].GetTimestamp())
+}
+
+func TestReplaysATombstone(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := openForTest(t, directory)
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewTombstone())
+	assert.Nil(t, wal.Append(record, false))
+	assert.Nil(t, wal.Close())
+
+	wal, records := openForTest(t, directory)
+	defer wal.Close()
+
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, true, records[0].GetEntries()[0].GetValue().IsTombstone())
+}
+
+func TestStopsAppendingAfterAFailedSync(t *testing.T) {
+	wal, _ := openForTest(t, t.TempDir())
+	defer wal.Close()
+
+	reader, writer, err := os.Pipe()
+	assert.Nil(t, err)
+	defer reader.Close()
+	segmentFile := wal.file
+	defer segmentFile.Close()
+	wal.file = writer //a pipe accepts the write and fails the fsync
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.NotNil(t, wal.Append(record, true))
+	assert.Equal(t, int64(0), wal.Size())
+	assert.Equal(t, int64(0), wal.UnsyncedBytes())
+
+	assert.Equal(t, BrokenLogErr, wal.Append(record, false))
+	assert.Equal(t, BrokenLogErr, wal.Sync())
+}
+
+func TestTruncatesARecordWithALengthBeyondTheEndOfTheSegment(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := openForTest(t, directory)
+
+	record := NewRecord(1)
+	record.Add([]byte("HDD"), mvcc.NewValue([]byte("Hard disk")))
+	assert.Nil(t, wal.Append(record, false))
+	sizeAfterFirstRecord := wal.Size()
+	assert.Nil(t, wal.Close())
+
+	file, err := os.OpenFile(segmentPath(directory, 1), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = file.Write([]byte{0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xF0, 1, 2, 3})
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	wal, records := openForTest(t, directory)
+	defer wal.Close()
+
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, sizeAfterFirstRecord, wal.Size())
+}